@@ -0,0 +1,13 @@
+package impair_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestImpair(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Adapters - Impair Suite")
+}
@@ -0,0 +1,552 @@
+package impair
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/factory"
+	"github.com/myshkin5/netspel/utils"
+)
+
+const (
+	prefix = ".impair."
+
+	WriterType        = prefix + "writer-type"
+	Seed              = prefix + "seed"
+	Loss              = prefix + "loss"
+	BurstStart        = prefix + "burst-start"
+	BurstEnd          = prefix + "burst-end"
+	BurstLoss         = prefix + "burst-loss"
+	Delay             = prefix + "delay"
+	Jitter            = prefix + "jitter"
+	DelayDistribution = prefix + "delay-distribution"
+	Duplicate         = prefix + "duplicate"
+	Reorder           = prefix + "reorder"
+	Bandwidth         = prefix + "bandwidth"
+	QueueLimit        = prefix + "queue-limit"
+
+	DefaultWriterType        = ""
+	DefaultSeed              = 1
+	DefaultLoss              = 0.0
+	DefaultBurstStart        = 0.0
+	DefaultBurstEnd          = 1.0
+	DefaultBurstLoss         = 1.0
+	DefaultDelay             = 0
+	DefaultJitter            = 0
+	DefaultDelayDistribution = Uniform
+	DefaultDuplicate         = 0.0
+	DefaultReorder           = 0.0
+	DefaultBandwidth         = 0
+	DefaultQueueLimit        = 1000
+
+	Uniform = "uniform"
+	Normal  = "normal"
+)
+
+// ConfigKeys are read by the impair writer and, apart from the writer type,
+// by the proxy.
+var ConfigKeys = []factory.ConfigKey{
+	{Path: WriterType, Type: factory.StringType, Required: true, Names: factory.KindWriter,
+		Doc: "The type of the writer impaired, such as udp or tcp."},
+	{Path: Seed, Type: factory.IntType, Default: fmt.Sprint(DefaultSeed),
+		Doc: "The seed of the random choices."},
+	{Path: Loss, Type: factory.FloatType, Default: fmt.Sprint(DefaultLoss), Range: factory.Between(0, 1),
+		Doc: "The probability a message is lost in the good state."},
+	{Path: BurstStart, Type: factory.FloatType, Default: fmt.Sprint(DefaultBurstStart), Range: factory.Between(0, 1),
+		Doc: "The probability of moving from the good state to the bad state."},
+	{Path: BurstEnd, Type: factory.FloatType, Default: fmt.Sprint(DefaultBurstEnd), Range: factory.Between(0, 1),
+		Doc: "The probability of moving from the bad state back to the good state."},
+	{Path: BurstLoss, Type: factory.FloatType, Default: fmt.Sprint(DefaultBurstLoss), Range: factory.Between(0, 1),
+		Doc: "The probability a message is lost in the bad state."},
+	{Path: Duplicate, Type: factory.FloatType, Default: fmt.Sprint(DefaultDuplicate), Range: factory.Between(0, 1),
+		Doc: "The probability a message is written twice."},
+	{Path: Delay, Type: factory.DurationType, Default: fmt.Sprint(time.Duration(DefaultDelay)), Range: factory.AtLeast(0),
+		Doc: "The delay added to each message."},
+	{Path: Jitter, Type: factory.DurationType, Default: fmt.Sprint(time.Duration(DefaultJitter)), Range: factory.AtLeast(0),
+		Doc: "The variation of the delay."},
+	{Path: DelayDistribution, Type: factory.StringType, Default: DefaultDelayDistribution, Values: []string{Uniform, Normal},
+		Doc: "The distribution of the jitter."},
+	{Path: Reorder, Type: factory.FloatType, Default: fmt.Sprint(DefaultReorder), Range: factory.Between(0, 1),
+		Doc: "The probability a message is written after the next message."},
+	{Path: Bandwidth, Type: factory.IntType, Default: fmt.Sprint(DefaultBandwidth), Range: factory.AtLeast(0),
+		Doc: "The bandwidth limit in bits per second. When zero, bandwidth isn't limited."},
+	{Path: QueueLimit, Type: factory.IntType, Default: fmt.Sprint(DefaultQueueLimit), Range: factory.AtLeast(1),
+		Doc: "The count of messages that may be queued or delayed before further messages are dropped."},
+}
+
+func init() {
+	factory.RegisterWriter(factory.Descriptor{
+		Name:        "impair",
+		Description: "Wraps another writer with loss, duplication, delay, jitter, reordering and a bandwidth limit.",
+		Config:      ConfigKeys,
+	}, func() factory.Writer {
+		return &Writer{}
+	})
+}
+
+// Writer impairs the messages written to another writer, like tc netem but
+// in user space. Messages may be lost, duplicated, delayed, reordered and
+// limited to a bandwidth. Only the messages written are impaired, not the
+// replies read back.
+type Writer struct {
+	inner     io.WriteCloser
+	innerType string
+	minSize   int
+	maxSize   int
+
+	stream          bool
+	retransmitDelay time.Duration
+
+	random            *rand.Rand
+	loss              gilbertElliott
+	delay             time.Duration
+	jitter            time.Duration
+	delayDistribution string
+	duplicate         float64
+	reorder           float64
+	bandwidth         int
+	queueLimit        int
+	scheduled         bool
+
+	mutex    sync.Mutex
+	space    *sync.Cond
+	queue    schedule
+	held     *pending
+	order    uint64
+	linkFree time.Time
+	lastAt   time.Time
+	err      error
+	closing  bool
+	wake     chan struct{}
+	done     chan struct{}
+
+	lost       uint64
+	duplicated uint64
+	reordered  uint64
+	queueDrops uint64
+}
+
+// WrappedType returns the type of the writer impaired.
+func (w *Writer) WrappedType(config jsonstruct.JSONStruct) string {
+	return config.StringWithDefault(WriterType, DefaultWriterType)
+}
+
+// SetMessageSizes passes the message sizes on to the writer impaired.
+func (w *Writer) SetMessageSizes(min, max int) {
+	w.minSize, w.maxSize = min, max
+}
+
+func (w *Writer) Init(config jsonstruct.JSONStruct) error {
+	err := w.initImpairments(config)
+	if err != nil {
+		return err
+	}
+
+	w.innerType = w.WrappedType(config)
+	if w.innerType == "" {
+		return fmt.Errorf("The writer type to impair is required, %s", WriterType)
+	}
+	inner, err := factory.CreateWriter(w.innerType)
+	if err != nil {
+		return err
+	}
+	if _, ok := inner.(*Writer); ok {
+		return fmt.Errorf("An impaired writer can't impair another, %s", w.innerType)
+	}
+	if sized, ok := inner.(factory.SizedAdapter); ok && w.maxSize > 0 {
+		sized.SetMessageSizes(w.minSize, w.maxSize)
+	}
+	err = inner.Init(config)
+	if err != nil {
+		return err
+	}
+	w.inner = inner
+
+	w.start()
+	return nil
+}
+
+// Wrap impairs the messages written to inner as configured under .impair,
+// ignoring the writer type. It impairs connections that aren't writers, such
+// as the proxy's.
+func Wrap(inner io.WriteCloser, config jsonstruct.JSONStruct) (*Writer, error) {
+	w := &Writer{inner: inner}
+	err := w.initImpairments(config)
+	if err != nil {
+		return nil, err
+	}
+
+	w.start()
+	return w, nil
+}
+
+// WrapStream impairs writes to a byte stream, such as a TCP connection, which
+// can't lose, duplicate or reorder bytes. A lost write is delayed by the
+// retransmit delay instead, as a retransmitted segment would be. Jitter never
+// reorders writes and writes block rather than being dropped while the queue
+// is full.
+func WrapStream(inner io.WriteCloser, config jsonstruct.JSONStruct, retransmitDelay time.Duration) (*Writer, error) {
+	w := &Writer{inner: inner, stream: true, retransmitDelay: retransmitDelay}
+	err := w.initImpairments(config)
+	if err != nil {
+		return nil, err
+	}
+	if w.duplicate > 0 || w.reorder > 0 {
+		return nil, fmt.Errorf("Streams can't be duplicated or reordered, %s %g and %s %g", Duplicate, w.duplicate, Reorder, w.reorder)
+	}
+
+	w.space = sync.NewCond(&w.mutex)
+	w.start()
+	return w, nil
+}
+
+func (w *Writer) initImpairments(config jsonstruct.JSONStruct) error {
+	w.random = rand.New(rand.NewSource(int64(config.IntWithDefault(Seed, DefaultSeed))))
+
+	probabilities := []struct {
+		key          string
+		defaultValue float64
+		value        *float64
+	}{
+		{Loss, DefaultLoss, &w.loss.loss},
+		{BurstStart, DefaultBurstStart, &w.loss.burstStart},
+		{BurstEnd, DefaultBurstEnd, &w.loss.burstEnd},
+		{BurstLoss, DefaultBurstLoss, &w.loss.burstLoss},
+		{Duplicate, DefaultDuplicate, &w.duplicate},
+		{Reorder, DefaultReorder, &w.reorder},
+	}
+	for _, p := range probabilities {
+		var err error
+		*p.value, err = utils.Float64WithDefault(config, p.key, p.defaultValue)
+		if err != nil {
+			return err
+		}
+		if *p.value < 0 || *p.value > 1 {
+			return fmt.Errorf("Probabilities must be between 0 and 1, %s %g", p.key, *p.value)
+		}
+	}
+
+	var err error
+	w.delay, err = config.DurationWithDefault(Delay, DefaultDelay)
+	if err != nil {
+		return err
+	}
+	w.jitter, err = config.DurationWithDefault(Jitter, DefaultJitter)
+	if err != nil {
+		return err
+	}
+	if w.delay < 0 || w.jitter < 0 {
+		return fmt.Errorf("Delay and jitter must not be negative, %s and %s", w.delay, w.jitter)
+	}
+	w.delayDistribution = config.StringWithDefault(DelayDistribution, DefaultDelayDistribution)
+	if w.delayDistribution != Uniform && w.delayDistribution != Normal {
+		return fmt.Errorf("Unknown delay distribution, %s", w.delayDistribution)
+	}
+
+	w.bandwidth = config.IntWithDefault(Bandwidth, DefaultBandwidth)
+	if w.bandwidth < 0 {
+		return fmt.Errorf("Bandwidth must not be negative, %d", w.bandwidth)
+	}
+	w.queueLimit = config.IntWithDefault(QueueLimit, DefaultQueueLimit)
+	if w.queueLimit < 1 {
+		return fmt.Errorf("Queue limit must be at least 1, %d", w.queueLimit)
+	}
+
+	w.scheduled = w.stream || w.delay > 0 || w.jitter > 0 || w.reorder > 0 || w.bandwidth > 0
+
+	return nil
+}
+
+func (w *Writer) start() {
+	if !w.scheduled {
+		return
+	}
+
+	w.wake = make(chan struct{}, 1)
+	w.done = make(chan struct{})
+	go w.send()
+}
+
+// Write always reports the whole message as written, even when it is lost,
+// just as a network would. When messages are delayed, an error writing an
+// earlier message is returned by the next call once the current message has
+// been scheduled, along with the current message's count.
+func (w *Writer) Write(message []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	err := w.err
+	w.err = nil
+
+	if w.loss.lose(w.random) {
+		w.lost++
+		if w.stream {
+			w.schedule(message, w.retransmitDelay)
+		}
+		return len(message), err
+	}
+	copies := 1
+	if w.duplicate > 0 && w.random.Float64() < w.duplicate {
+		w.duplicated++
+		copies = 2
+	}
+
+	for i := 0; i < copies; i++ {
+		if !w.scheduled {
+			_, writeErr := w.inner.Write(message)
+			if writeErr != nil {
+				return 0, writeErr
+			}
+			continue
+		}
+		w.schedule(message, 0)
+	}
+
+	return len(message), err
+}
+
+// Read returns the replies read by the impaired writer, or io.EOF when it
+// doesn't read replies.
+func (w *Writer) Read(message []byte) (int, error) {
+	reader, ok := w.inner.(io.Reader)
+	if !ok {
+		return 0, io.EOF
+	}
+	return reader.Read(message)
+}
+
+// Close waits for delayed messages to be written before closing the impaired
+// writer.
+func (w *Writer) Close() error {
+	if w.scheduled {
+		w.mutex.Lock()
+		if w.held != nil {
+			w.push(w.held)
+			w.held = nil
+		}
+		w.closing = true
+		if w.space != nil {
+			w.space.Broadcast()
+		}
+		w.mutex.Unlock()
+		w.signal()
+		<-w.done
+	}
+
+	return w.inner.Close()
+}
+
+// Stats adds the counts of impaired messages to the impaired writer's stats.
+func (w *Writer) Stats() []factory.Stat {
+	lost := "impair lost"
+	if w.stream {
+		lost = "impair retransmitted"
+	}
+
+	w.mutex.Lock()
+	stats := []factory.Stat{
+		{Name: lost, Value: w.lost},
+		{Name: "impair duplicated", Value: w.duplicated},
+		{Name: "impair reordered", Value: w.reordered},
+		{Name: "impair queue drops", Value: w.queueDrops},
+	}
+	w.mutex.Unlock()
+
+	if collector, ok := w.inner.(factory.StatsCollector); ok {
+		stats = append(stats, collector.Stats()...)
+	}
+	return stats
+}
+
+// schedule queues a copy of the message to be written once it has been
+// serialized at the bandwidth limit and delayed, plus any extra delay. A
+// reordered message is held back and written just after the next message.
+func (w *Writer) schedule(message []byte, extra time.Duration) {
+	for w.stream && w.queue.Len() >= w.queueLimit && !w.closing {
+		w.space.Wait()
+	}
+	if w.queue.Len() >= w.queueLimit {
+		w.queueDrops++
+		return
+	}
+
+	at := time.Now()
+	if w.bandwidth > 0 {
+		if w.linkFree.After(at) {
+			at = w.linkFree
+		}
+		at = at.Add(time.Duration(len(message)) * 8 * time.Second / time.Duration(w.bandwidth))
+		w.linkFree = at
+	}
+	at = at.Add(w.nextDelay() + extra)
+	if w.stream && at.Before(w.lastAt) {
+		at = w.lastAt
+	}
+	w.lastAt = at
+
+	p := &pending{message: append([]byte(nil), message...), at: at}
+	switch {
+	case w.held != nil:
+		if w.held.at.Before(at) {
+			w.held.at = at
+		}
+		w.push(p)
+		w.push(w.held)
+		w.held = nil
+	case w.reorder > 0 && w.random.Float64() < w.reorder:
+		w.reordered++
+		w.held = p
+		return
+	default:
+		w.push(p)
+	}
+
+	w.signal()
+}
+
+func (w *Writer) nextDelay() time.Duration {
+	if w.jitter == 0 {
+		return w.delay
+	}
+
+	var delay time.Duration
+	switch w.delayDistribution {
+	case Normal:
+		delay = w.delay + time.Duration(w.random.NormFloat64()*float64(w.jitter))
+	default:
+		delay = w.delay + time.Duration((w.random.Float64()*2-1)*float64(w.jitter))
+	}
+	if delay < 0 {
+		return 0
+	}
+	return delay
+}
+
+func (w *Writer) push(p *pending) {
+	p.order = w.order
+	w.order++
+	heap.Push(&w.queue, p)
+}
+
+func (w *Writer) signal() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// send writes each queued message when it is due until the writer is closed
+// and the queue is empty.
+func (w *Writer) send() {
+	defer close(w.done)
+
+	for {
+		w.mutex.Lock()
+		if w.queue.Len() == 0 {
+			closing := w.closing
+			w.mutex.Unlock()
+			if closing {
+				return
+			}
+			<-w.wake
+			continue
+		}
+
+		next := w.queue[0]
+		wait := time.Until(next.at)
+		if wait > 0 {
+			w.mutex.Unlock()
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-w.wake:
+				timer.Stop()
+			}
+			continue
+		}
+		heap.Pop(&w.queue)
+		if w.space != nil {
+			w.space.Signal()
+		}
+		w.mutex.Unlock()
+
+		_, err := w.inner.Write(next.message)
+		if err != nil {
+			w.mutex.Lock()
+			if w.err == nil {
+				w.err = err
+			}
+			w.mutex.Unlock()
+		}
+	}
+}
+
+// gilbertElliott is a two state loss model. Messages are lost with one
+// probability in the good state and another in the bad state. Before each
+// message, the model moves from the good to the bad state with the burst start
+// probability and back with the burst end probability, so losses come in
+// bursts.
+type gilbertElliott struct {
+	loss       float64
+	burstStart float64
+	burstEnd   float64
+	burstLoss  float64
+	bad        bool
+}
+
+func (g *gilbertElliott) lose(random *rand.Rand) bool {
+	if g.bad {
+		if g.burstEnd > 0 && random.Float64() < g.burstEnd {
+			g.bad = false
+		}
+	} else if g.burstStart > 0 && random.Float64() < g.burstStart {
+		g.bad = true
+	}
+
+	if g.bad {
+		return random.Float64() < g.burstLoss
+	}
+	return g.loss > 0 && random.Float64() < g.loss
+}
+
+type pending struct {
+	message []byte
+	at      time.Time
+	order   uint64
+}
+
+// schedule is a heap of pending messages ordered by when they are due and
+// then by when they were queued.
+type schedule []*pending
+
+func (s schedule) Len() int {
+	return len(s)
+}
+
+func (s schedule) Less(i, j int) bool {
+	if s[i].at.Equal(s[j].at) {
+		return s[i].order < s[j].order
+	}
+	return s[i].at.Before(s[j].at)
+}
+
+func (s schedule) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+func (s *schedule) Push(x interface{}) {
+	*s = append(*s, x.(*pending))
+}
+
+func (s *schedule) Pop() interface{} {
+	old := *s
+	p := old[len(old)-1]
+	old[len(old)-1] = nil
+	*s = old[:len(old)-1]
+	return p
+}
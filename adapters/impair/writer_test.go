@@ -0,0 +1,236 @@
+package impair_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/adapters/impair"
+	"github.com/myshkin5/netspel/factory"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var written chan []byte
+
+type recordingWriter struct{}
+
+func (r *recordingWriter) Init(config jsonstruct.JSONStruct) error {
+	return nil
+}
+
+func (r *recordingWriter) Write(message []byte) (int, error) {
+	written <- append([]byte(nil), message...)
+	return len(message), nil
+}
+
+func (r *recordingWriter) Close() error {
+	return nil
+}
+
+// failingWriter fails its first fail writes.
+type failingWriter struct {
+	fail     int
+	attempts chan string
+}
+
+func (f *failingWriter) Write(message []byte) (int, error) {
+	f.attempts <- string(message)
+	if f.fail > 0 {
+		f.fail--
+		return 0, errors.New("Bad stuff")
+	}
+	return len(message), nil
+}
+
+func (f *failingWriter) Close() error {
+	return nil
+}
+
+func init() {
+	factory.RegisterWriter(factory.Descriptor{Name: "recording"}, func() factory.Writer {
+		return &recordingWriter{}
+	})
+}
+
+var _ = Describe("Writer", func() {
+	var (
+		config jsonstruct.JSONStruct
+		writer *impair.Writer
+	)
+
+	BeforeEach(func() {
+		written = make(chan []byte, 10000)
+
+		config = jsonstruct.New()
+		config.SetString(impair.WriterType, "recording")
+		writer = &impair.Writer{}
+	})
+
+	write := func(count int) {
+		for i := 0; i < count; i++ {
+			message := make([]byte, 100)
+			binary.BigEndian.PutUint64(message, uint64(i))
+			bytesWritten, err := writer.Write(message)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bytesWritten).To(Equal(100))
+		}
+	}
+
+	received := func() []uint64 {
+		var numbers []uint64
+		for {
+			select {
+			case message := <-written:
+				numbers = append(numbers, binary.BigEndian.Uint64(message))
+			default:
+				return numbers
+			}
+		}
+	}
+
+	stat := func(name string) uint64 {
+		for _, s := range writer.Stats() {
+			if s.Name == name {
+				return s.Value
+			}
+		}
+		Fail("No stat named " + name)
+		return 0
+	}
+
+	It("requires the writer type to impair", func() {
+		config = jsonstruct.New()
+		Expect(writer.Init(config)).To(MatchError(ContainSubstring(impair.WriterType)))
+	})
+
+	It("rejects probabilities outside of 0 to 1", func() {
+		config.SetString(impair.Loss, "1.5")
+		Expect(writer.Init(config)).To(HaveOccurred())
+	})
+
+	It("passes messages straight through without impairments", func() {
+		Expect(writer.Init(config)).To(Succeed())
+		write(3)
+		Expect(received()).To(Equal([]uint64{0, 1, 2}))
+		Expect(writer.Close()).To(Succeed())
+	})
+
+	It("loses the same messages for the same seed", func() {
+		config.SetString(impair.Loss, "0.3")
+		config.SetInt(impair.Seed, 7)
+		Expect(writer.Init(config)).To(Succeed())
+		write(1000)
+		Expect(writer.Close()).To(Succeed())
+		first := received()
+		Expect(len(first)).To(BeNumerically("~", 700, 60))
+		Expect(stat("impair lost")).To(BeEquivalentTo(1000 - len(first)))
+
+		writer = &impair.Writer{}
+		Expect(writer.Init(config)).To(Succeed())
+		write(1000)
+		Expect(writer.Close()).To(Succeed())
+		Expect(received()).To(Equal(first))
+	})
+
+	It("loses messages in bursts", func() {
+		config.SetString(impair.BurstStart, "0.02")
+		config.SetString(impair.BurstEnd, "0.2")
+		Expect(writer.Init(config)).To(Succeed())
+		write(5000)
+		Expect(writer.Close()).To(Succeed())
+
+		bursts, lost := 0, 0
+		previous := int64(-1)
+		for _, number := range received() {
+			gap := int64(number) - previous - 1
+			if gap > 0 {
+				bursts++
+				lost += int(gap)
+			}
+			previous = int64(number)
+		}
+		Expect(bursts).To(BeNumerically(">", 0))
+		Expect(float64(lost) / float64(bursts)).To(BeNumerically("~", 5, 1.5))
+	})
+
+	It("duplicates messages", func() {
+		config.SetString(impair.Duplicate, "1")
+		Expect(writer.Init(config)).To(Succeed())
+		write(2)
+		Expect(received()).To(Equal([]uint64{0, 0, 1, 1}))
+		Expect(stat("impair duplicated")).To(BeEquivalentTo(2))
+		Expect(writer.Close()).To(Succeed())
+	})
+
+	It("delays messages", func() {
+		config.SetDuration(impair.Delay, 50*time.Millisecond)
+		Expect(writer.Init(config)).To(Succeed())
+
+		start := time.Now()
+		write(1)
+		Expect(written).NotTo(Receive())
+		Eventually(written, time.Second).Should(Receive())
+		Expect(time.Since(start)).To(BeNumerically(">=", 50*time.Millisecond))
+		Expect(writer.Close()).To(Succeed())
+	})
+
+	It("writes delayed messages before closing", func() {
+		config.SetDuration(impair.Delay, 30*time.Millisecond)
+		config.SetDuration(impair.Jitter, 20*time.Millisecond)
+		config.SetString(impair.DelayDistribution, impair.Normal)
+		Expect(writer.Init(config)).To(Succeed())
+
+		write(10)
+		Expect(writer.Close()).To(Succeed())
+		Expect(received()).To(ConsistOf(uint64(0), uint64(1), uint64(2), uint64(3), uint64(4),
+			uint64(5), uint64(6), uint64(7), uint64(8), uint64(9)))
+	})
+
+	It("writes a reordered message after the next message", func() {
+		config.SetString(impair.Reorder, "1")
+		Expect(writer.Init(config)).To(Succeed())
+		write(5)
+		Expect(writer.Close()).To(Succeed())
+		Expect(received()).To(Equal([]uint64{1, 0, 3, 2, 4}))
+		Expect(stat("impair reordered")).To(BeEquivalentTo(3))
+	})
+
+	It("limits the bandwidth and drops messages when the queue is full", func() {
+		// 100 byte messages take 10ms each at 80 kbit/s
+		config.SetInt(impair.Bandwidth, 80000)
+		config.SetInt(impair.QueueLimit, 5)
+		Expect(writer.Init(config)).To(Succeed())
+
+		start := time.Now()
+		write(8)
+		Expect(writer.Close()).To(Succeed())
+		Expect(time.Since(start)).To(BeNumerically(">=", 50*time.Millisecond))
+		Expect(received()).To(Equal([]uint64{0, 1, 2, 3, 4}))
+		Expect(stat("impair queue drops")).To(BeEquivalentTo(3))
+	})
+
+	It("still sends the next message when returning an earlier delayed error", func() {
+		inner := &failingWriter{fail: 1, attempts: make(chan string, 10)}
+		config.SetDuration(impair.Delay, time.Millisecond)
+		wrapped, err := impair.Wrap(inner, config)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = wrapped.Write([]byte("first"))
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(inner.attempts).Should(Receive())
+
+		count, err := wrapped.Write([]byte("second"))
+		Expect(err).To(MatchError("Bad stuff"))
+		Expect(count).To(Equal(len("second")))
+		Expect(wrapped.Close()).To(Succeed())
+		Expect(inner.attempts).To(Receive(Equal("second")))
+	})
+
+	It("rejects impairing itself", func() {
+		config.SetString(impair.WriterType, "impair")
+		Expect(writer.Init(config)).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,223 @@
+package framing
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	LengthPrefixed = "length-prefixed"
+	Newline        = "newline"
+	Fixed          = "fixed"
+
+	lengthSize     = 4
+	MaxFrameLength = 64 * 1024 * 1024
+
+	// escape precedes a newline, written as an n, or an escape within a
+	// newline delimited message
+	escape = '\\'
+)
+
+// Framer writes and reads message boundaries over a byte stream.
+type Framer interface {
+	WriteFrame(writer io.Writer, message []byte) (int, error)
+	ReadFrame(reader *bufio.Reader, message []byte) (int, error)
+}
+
+// Sizes are the smallest and largest messages a scheme writes and expects to
+// read. Both are zero when the scheme doesn't say.
+type Sizes struct {
+	Min int
+	Max int
+}
+
+// New returns the named framing. A fixed record size of zero is matched to the
+// message sizes, which must then all be the same.
+func New(framing string, recordSize int, sizes Sizes) (Framer, error) {
+	switch framing {
+	case LengthPrefixed:
+		return &lengthPrefixed{}, nil
+	case Newline:
+		return &newline{}, nil
+	case Fixed:
+		if recordSize == 0 {
+			recordSize = sizes.Max
+		}
+		if recordSize <= 0 {
+			return nil, fmt.Errorf("Record size must be positive for fixed framing, %d", recordSize)
+		}
+		if sizes.Max > 0 && (sizes.Min != recordSize || sizes.Max != recordSize) {
+			return nil, fmt.Errorf("Fixed framing requires every message to be the record size %d, messages are %d to %d bytes", recordSize, sizes.Min, sizes.Max)
+		}
+		return &fixed{recordSize: recordSize}, nil
+	default:
+		return nil, fmt.Errorf("Unknown framing, %s", framing)
+	}
+}
+
+type lengthPrefixed struct {
+	buffer []byte
+}
+
+func (f *lengthPrefixed) WriteFrame(writer io.Writer, message []byte) (int, error) {
+	if len(message) > MaxFrameLength {
+		return 0, fmt.Errorf("Message exceeds maximum frame length, %d", len(message))
+	}
+
+	f.buffer = append(f.buffer[:0], 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(f.buffer, uint32(len(message)))
+	f.buffer = append(f.buffer, message...)
+
+	count, err := writer.Write(f.buffer)
+	return payloadCount(count, lengthSize), err
+}
+
+func (f *lengthPrefixed) ReadFrame(reader *bufio.Reader, message []byte) (int, error) {
+	var header [lengthSize]byte
+	_, err := io.ReadFull(reader, header[:])
+	if err != nil {
+		return 0, err
+	}
+
+	length := int(binary.BigEndian.Uint32(header[:]))
+	if length > MaxFrameLength {
+		return 0, fmt.Errorf("Frame exceeds maximum frame length, %d", length)
+	}
+
+	count, err := readRecord(reader, message, length)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return count, err
+}
+
+// newline follows each message with a newline. Newlines and escapes within
+// messages are escaped so messages may contain any bytes.
+type newline struct {
+	buffer []byte
+}
+
+func (f *newline) WriteFrame(writer io.Writer, message []byte) (int, error) {
+	f.buffer = f.buffer[:0]
+	remaining := message
+	for {
+		index := bytes.IndexAny(remaining, "\n\\")
+		if index < 0 {
+			break
+		}
+		f.buffer = append(f.buffer, remaining[:index]...)
+		if remaining[index] == '\n' {
+			f.buffer = append(f.buffer, escape, 'n')
+		} else {
+			f.buffer = append(f.buffer, escape, escape)
+		}
+		remaining = remaining[index+1:]
+	}
+	f.buffer = append(f.buffer, remaining...)
+	f.buffer = append(f.buffer, '\n')
+
+	count, err := writer.Write(f.buffer)
+	if count > len(message) {
+		count = len(message)
+	}
+	return count, err
+}
+
+func (f *newline) ReadFrame(reader *bufio.Reader, message []byte) (int, error) {
+	count := 0
+	truncated := false
+	escaped := false
+	for {
+		line, err := reader.ReadSlice('\n')
+		if err == nil {
+			line = line[:len(line)-1]
+		}
+
+		for _, b := range line {
+			if escaped {
+				escaped = false
+				if b == 'n' {
+					b = '\n'
+				}
+			} else if b == escape {
+				escaped = true
+				continue
+			}
+
+			if count < len(message) {
+				message[count] = b
+				count++
+			} else {
+				truncated = true
+			}
+		}
+
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF && count > 0 {
+			return count, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return count, err
+		}
+		if truncated {
+			return count, io.ErrShortBuffer
+		}
+		return count, nil
+	}
+}
+
+// fixed writes every message as a raw record of the same size with no framing
+// overhead, so every message must be the record size.
+type fixed struct {
+	recordSize int
+}
+
+func (f *fixed) WriteFrame(writer io.Writer, message []byte) (int, error) {
+	if len(message) != f.recordSize {
+		return 0, fmt.Errorf("Message size %d doesn't match record size %d", len(message), f.recordSize)
+	}
+	return writer.Write(message)
+}
+
+func (f *fixed) ReadFrame(reader *bufio.Reader, message []byte) (int, error) {
+	return readRecord(reader, message, f.recordSize)
+}
+
+// readRecord reads length bytes into message, discarding whatever does not fit.
+func readRecord(reader *bufio.Reader, message []byte, length int) (int, error) {
+	count := length
+	if count > len(message) {
+		count = len(message)
+	}
+
+	_, err := io.ReadFull(reader, message[:count])
+	if err != nil {
+		return 0, err
+	}
+
+	if count < length {
+		_, err = reader.Discard(length - count)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		return count, io.ErrShortBuffer
+	}
+
+	return count, nil
+}
+
+func payloadCount(count, overhead int) int {
+	count -= overhead
+	if count < 0 {
+		return 0
+	}
+	return count
+}
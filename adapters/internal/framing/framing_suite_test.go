@@ -0,0 +1,13 @@
+package framing_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestFraming(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Adapters - Internal - Framing Suite")
+}
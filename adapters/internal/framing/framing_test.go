@@ -0,0 +1,174 @@
+package framing_test
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	"github.com/myshkin5/netspel/adapters/internal/framing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Framing", func() {
+	var (
+		stream *bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		stream = &bytes.Buffer{}
+	})
+
+	roundTrip := func(framer framing.Framer, messages ...[]byte) {
+		for _, message := range messages {
+			count, err := framer.WriteFrame(stream, message)
+			ExpectWithOffset(1, err).NotTo(HaveOccurred())
+			ExpectWithOffset(1, count).To(Equal(len(message)))
+		}
+
+		reader := bufio.NewReader(stream)
+		buffer := make([]byte, 1024)
+		for _, message := range messages {
+			count, err := framer.ReadFrame(reader, buffer)
+			ExpectWithOffset(1, err).NotTo(HaveOccurred())
+			ExpectWithOffset(1, buffer[:count]).To(Equal(message))
+		}
+
+		_, err := framer.ReadFrame(reader, buffer)
+		ExpectWithOffset(1, err).To(Equal(io.EOF))
+	}
+
+	It("returns an error for unknown framing", func() {
+		_, err := framing.New("smoke-signals", 0, framing.Sizes{})
+		Expect(err).To(HaveOccurred())
+	})
+
+	Context("length prefixed", func() {
+		var (
+			framer framing.Framer
+		)
+
+		BeforeEach(func() {
+			var err error
+			framer, err = framing.New(framing.LengthPrefixed, 0, framing.Sizes{})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("preserves message boundaries", func() {
+			roundTrip(framer, []byte("hello"), []byte{}, []byte("with\nnewlines\r\n"), make([]byte, 1000))
+		})
+
+		It("truncates messages larger than the read buffer", func() {
+			framer.WriteFrame(stream, []byte("too long"))
+			framer.WriteFrame(stream, []byte("next"))
+
+			reader := bufio.NewReader(stream)
+			buffer := make([]byte, 4)
+			count, err := framer.ReadFrame(reader, buffer)
+			Expect(err).To(Equal(io.ErrShortBuffer))
+			Expect(buffer[:count]).To(Equal([]byte("too ")))
+
+			count, err = framer.ReadFrame(reader, buffer)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buffer[:count]).To(Equal([]byte("next")))
+		})
+
+		It("reports a frame cut short", func() {
+			framer.WriteFrame(stream, []byte("hello"))
+			stream.Truncate(stream.Len() - 1)
+
+			_, err := framer.ReadFrame(bufio.NewReader(stream), make([]byte, 1024))
+			Expect(err).To(Equal(io.ErrUnexpectedEOF))
+		})
+	})
+
+	Context("newline delimited", func() {
+		var (
+			framer framing.Framer
+		)
+
+		BeforeEach(func() {
+			var err error
+			framer, err = framing.New(framing.Newline, 0, framing.Sizes{})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("preserves message boundaries", func() {
+			roundTrip(framer, []byte("hello"), []byte{}, []byte("goodbye"))
+		})
+
+		It("escapes newlines and escapes within messages", func() {
+			framer.WriteFrame(stream, []byte("a\nb\\c"))
+			Expect(stream.String()).To(Equal("a\\nb\\\\c\n"))
+			stream.Reset()
+
+			roundTrip(framer, []byte("hello\nthere"), []byte("back\\slash\\n"), []byte("\n\n\\"), []byte{0, 10, 92, 255})
+		})
+
+		It("unescapes across reads of the buffer", func() {
+			message := append(bytes.Repeat([]byte("x"), 15), '\n', 'y')
+			framer.WriteFrame(stream, message)
+
+			buffer := make([]byte, 100)
+			count, err := framer.ReadFrame(bufio.NewReaderSize(stream, 16), buffer)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buffer[:count]).To(Equal(message))
+		})
+
+		It("reads lines longer than the read buffer", func() {
+			message := bytes.Repeat([]byte("x"), 10000)
+			framer.WriteFrame(stream, message)
+
+			buffer := make([]byte, 20000)
+			count, err := framer.ReadFrame(bufio.NewReaderSize(stream, 16), buffer)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buffer[:count]).To(Equal(message))
+		})
+	})
+
+	Context("fixed size", func() {
+		var (
+			framer framing.Framer
+		)
+
+		BeforeEach(func() {
+			var err error
+			framer, err = framing.New(framing.Fixed, 5, framing.Sizes{})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("requires a positive record size", func() {
+			_, err := framing.New(framing.Fixed, 0, framing.Sizes{})
+			Expect(err).To(HaveOccurred())
+			_, err = framing.New(framing.Fixed, -1, framing.Sizes{})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("matches the record size to the message size", func() {
+			framer, err := framing.New(framing.Fixed, 0, framing.Sizes{Min: 3, Max: 3})
+			Expect(err).NotTo(HaveOccurred())
+
+			roundTrip(framer, []byte("one"), []byte("two"))
+		})
+
+		It("requires messages of a single size", func() {
+			_, err := framing.New(framing.Fixed, 0, framing.Sizes{Min: 3, Max: 5})
+			Expect(err).To(MatchError("Fixed framing requires every message to be the record size 5, messages are 3 to 5 bytes"))
+			_, err = framing.New(framing.Fixed, 4, framing.Sizes{Min: 3, Max: 3})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("preserves message boundaries", func() {
+			roundTrip(framer, []byte("hello"), []byte("there"))
+		})
+
+		It("refuses to write messages of another size", func() {
+			_, err := framer.WriteFrame(stream, []byte("hello there"))
+			Expect(err).To(MatchError("Message size 11 doesn't match record size 5"))
+			_, err = framer.WriteFrame(stream, []byte("hi"))
+			Expect(err).To(HaveOccurred())
+			Expect(stream.Len()).To(BeZero())
+		})
+	})
+})
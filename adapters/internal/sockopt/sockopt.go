@@ -0,0 +1,221 @@
+package sockopt
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/factory"
+	"github.com/myshkin5/netspel/logs"
+	"github.com/myshkin5/netspel/utils"
+)
+
+const (
+	prefix = ".socket."
+
+	SendBuffer    = prefix + "send-buffer"
+	ReceiveBuffer = prefix + "receive-buffer"
+	DSCP          = prefix + "dscp"
+	TTL           = prefix + "ttl"
+	ReusePort     = prefix + "reuse-port"
+	BusyPoll      = prefix + "busy-poll"
+	NoDelay       = prefix + "no-delay"
+	Congestion    = prefix + "congestion"
+
+	DefaultSendBuffer    = 0
+	DefaultReceiveBuffer = 0
+	DefaultTTL           = 0
+	DefaultReusePort     = false
+	DefaultBusyPoll      = 0
+	DefaultCongestion    = ""
+
+	unset = -1
+)
+
+// ConfigKeys are read by adapters that set socket options. Options without a
+// default leave the system default in place.
+var ConfigKeys = []factory.ConfigKey{
+	{Path: SendBuffer, Type: factory.IntType, Range: factory.AtLeast(0),
+		Doc: "The size in bytes of the socket send buffer (SO_SNDBUF)."},
+	{Path: ReceiveBuffer, Type: factory.IntType, Range: factory.AtLeast(0),
+		Doc: "The size in bytes of the socket receive buffer (SO_RCVBUF)."},
+	{Path: DSCP, Type: factory.IntType, Range: factory.Between(0, 63),
+		Doc: "The Differentiated Services code point, from 0 to 63, set in the upper six bits of IP_TOS."},
+	{Path: TTL, Type: factory.IntType, Range: factory.Between(0, 255),
+		Doc: "The time-to-live of unicast packets (IP_TTL)."},
+	{Path: ReusePort, Type: factory.BoolType, Default: fmt.Sprint(DefaultReusePort),
+		Doc: "Whether several sockets may bind the same port (SO_REUSEPORT)."},
+	{Path: BusyPoll, Type: factory.DurationType, Range: factory.AtLeast(0),
+		Doc: "How long a blocked read busy polls the device before sleeping (SO_BUSY_POLL)."},
+	{Path: NoDelay, Type: factory.BoolType, Default: "true",
+		Doc: "Whether TCP sends small segments immediately rather than coalescing them (TCP_NODELAY). TCP based adapters only."},
+	{Path: Congestion, Type: factory.StringType,
+		Doc: "The TCP congestion control algorithm, such as cubic or bbr (TCP_CONGESTION). TCP based adapters only."},
+}
+
+// Options holds the socket options set in config. Any option that isn't set
+// leaves the system default in place.
+type Options struct {
+	sendBuffer    int
+	receiveBuffer int
+	dscp          int
+	ttl           int
+	reusePort     bool
+	busyPoll      time.Duration
+	noDelay       bool
+	noDelaySet    bool
+	congestion    string
+}
+
+func New(config jsonstruct.JSONStruct) (*Options, error) {
+	o := &Options{
+		sendBuffer:    config.IntWithDefault(SendBuffer, DefaultSendBuffer),
+		receiveBuffer: config.IntWithDefault(ReceiveBuffer, DefaultReceiveBuffer),
+		dscp:          config.IntWithDefault(DSCP, unset),
+		ttl:           config.IntWithDefault(TTL, DefaultTTL),
+		congestion:    config.StringWithDefault(Congestion, DefaultCongestion),
+	}
+
+	if o.sendBuffer < 0 {
+		return nil, fmt.Errorf("Send buffer size must not be negative, %d", o.sendBuffer)
+	}
+	if o.receiveBuffer < 0 {
+		return nil, fmt.Errorf("Receive buffer size must not be negative, %d", o.receiveBuffer)
+	}
+	if o.dscp != unset && (o.dscp < 0 || o.dscp > 63) {
+		return nil, fmt.Errorf("DSCP must be between 0 and 63, %d", o.dscp)
+	}
+	if o.ttl < 0 || o.ttl > 255 {
+		return nil, fmt.Errorf("TTL must be between 0 and 255, %d", o.ttl)
+	}
+
+	var err error
+	o.reusePort, err = utils.BoolWithDefault(config, ReusePort, DefaultReusePort)
+	if err != nil {
+		return nil, err
+	}
+
+	o.busyPoll, err = config.DurationWithDefault(BusyPoll, DefaultBusyPoll)
+	if err != nil {
+		return nil, err
+	}
+	if o.busyPoll < 0 {
+		return nil, fmt.Errorf("Busy poll must not be negative, %s", o.busyPoll)
+	}
+
+	_, o.noDelaySet = utils.Lookup(config, NoDelay)
+	o.noDelay, err = utils.BoolWithDefault(config, NoDelay, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// ListenConfig returns a ListenConfig that sets the options before the socket
+// is bound, as required by SO_REUSEPORT.
+func (o *Options) ListenConfig() *net.ListenConfig {
+	return &net.ListenConfig{Control: o.Control}
+}
+
+// Dialer returns a Dialer that sets the options before connecting, so buffer
+// sizes are in place when TCP negotiates its window.
+func (o *Options) Dialer() *net.Dialer {
+	return &net.Dialer{Control: o.Control}
+}
+
+// Control sets the options on a socket that has been created but not yet
+// bound or connected.
+func (o *Options) Control(network, address string, c syscall.RawConn) error {
+	var err error
+	controlErr := c.Control(func(fd uintptr) {
+		err = o.apply(fd)
+	})
+	if controlErr != nil {
+		return controlErr
+	}
+	return err
+}
+
+// Apply sets the options on an existing connection. It must be called for
+// every TCP connection, including those accepted from a listener created with
+// ListenConfig, as TCP_NODELAY is enabled by the net package after connecting.
+func (o *Options) Apply(conn net.Conn) error {
+	if tcpConn, ok := conn.(*net.TCPConn); ok && o.noDelaySet {
+		err := tcpConn.SetNoDelay(o.noDelay)
+		if err != nil {
+			return err
+		}
+	}
+
+	syscallConn, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	rawConn, err := syscallConn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	return o.Control("", "", rawConn)
+}
+
+// Listen returns a listener whose accepted connections have the options
+// applied and their effective values logged.
+func (o *Options) Listen(network, address, name string) (net.Listener, error) {
+	listener, err := o.ListenConfig().Listen(context.Background(), network, address)
+	if err != nil {
+		return nil, err
+	}
+	Log(name+" listener", listener)
+
+	return &optionsListener{Listener: listener, options: o, name: name}, nil
+}
+
+// DialContext dials with the options applied and logs their effective values.
+// It fits http.Transport and websocket.Dialer.
+func (o *Options) DialContext(name string) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := o.Dialer().DialContext(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+
+		err = o.Apply(conn)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		Log(name, conn)
+
+		return conn, nil
+	}
+}
+
+type optionsListener struct {
+	net.Listener
+	options *Options
+	name    string
+}
+
+func (l *optionsListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	err = l.options.Apply(conn)
+	if err != nil {
+		logs.Logger.Warning("Unable to set socket options on accepted connection, %s", err.Error())
+	}
+	Log(l.name, conn)
+
+	return conn, nil
+}
+
+func (o *Options) isSet() bool {
+	return o.sendBuffer > 0 || o.receiveBuffer > 0 || o.dscp != unset || o.ttl > 0 ||
+		o.reusePort || o.busyPoll > 0 || o.congestion != ""
+}
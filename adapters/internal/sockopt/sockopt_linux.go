@@ -0,0 +1,150 @@
+package sockopt
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/myshkin5/netspel/logs"
+	"golang.org/x/sys/unix"
+)
+
+func (o *Options) apply(descriptor uintptr) error {
+	fd := int(descriptor)
+	family, err := unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_DOMAIN)
+	if err != nil {
+		return err
+	}
+	socketType, err := unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_TYPE)
+	if err != nil {
+		return err
+	}
+
+	if o.sendBuffer > 0 {
+		err = setInt(fd, unix.SOL_SOCKET, unix.SO_SNDBUF, "SO_SNDBUF", o.sendBuffer)
+		if err != nil {
+			return err
+		}
+	}
+	if o.receiveBuffer > 0 {
+		err = setInt(fd, unix.SOL_SOCKET, unix.SO_RCVBUF, "SO_RCVBUF", o.receiveBuffer)
+		if err != nil {
+			return err
+		}
+	}
+	// Unix domain sockets have no IP header, device or TCP, so only their
+	// buffer sizes apply
+	if family == unix.AF_UNIX {
+		return nil
+	}
+	if o.dscp != unset {
+		// DSCP is the upper six bits of the TOS or traffic class byte
+		if family == unix.AF_INET6 {
+			err = setInt(fd, unix.IPPROTO_IPV6, unix.IPV6_TCLASS, "IPV6_TCLASS", o.dscp<<2)
+		} else {
+			err = setInt(fd, unix.IPPROTO_IP, unix.IP_TOS, "IP_TOS", o.dscp<<2)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if o.ttl > 0 {
+		if family == unix.AF_INET6 {
+			err = setInt(fd, unix.IPPROTO_IPV6, unix.IPV6_UNICAST_HOPS, "IPV6_UNICAST_HOPS", o.ttl)
+		} else {
+			err = setInt(fd, unix.IPPROTO_IP, unix.IP_TTL, "IP_TTL", o.ttl)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if o.reusePort {
+		err = setInt(fd, unix.SOL_SOCKET, unix.SO_REUSEPORT, "SO_REUSEPORT", 1)
+		if err != nil {
+			return err
+		}
+	}
+	if o.busyPoll > 0 {
+		err = setInt(fd, unix.SOL_SOCKET, unix.SO_BUSY_POLL, "SO_BUSY_POLL", int(o.busyPoll/time.Microsecond))
+		if err != nil {
+			return err
+		}
+	}
+	if o.congestion != "" && socketType == unix.SOCK_STREAM {
+		err = unix.SetsockoptString(fd, unix.IPPROTO_TCP, unix.TCP_CONGESTION, o.congestion)
+		if err != nil {
+			return fmt.Errorf("Unable to set TCP_CONGESTION to %s, %s", o.congestion, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func setInt(fd, level, option int, name string, value int) error {
+	err := unix.SetsockoptInt(fd, level, option, value)
+	if err != nil {
+		return fmt.Errorf("Unable to set %s to %d, %s", name, value, err.Error())
+	}
+	return nil
+}
+
+// Log logs the effective values of the options, read back from the socket as
+// the kernel may clamp or adjust what was set. Linux reports buffer sizes
+// doubled to account for its bookkeeping overhead.
+func Log(name string, conn interface{}) {
+	syscallConn, ok := conn.(syscall.Conn)
+	if !ok {
+		return
+	}
+	rawConn, err := syscallConn.SyscallConn()
+	if err != nil {
+		return
+	}
+
+	var values []string
+	rawConn.Control(func(descriptor uintptr) {
+		values = effective(int(descriptor))
+	})
+	logs.Logger.Info("%s socket options: %s", name, strings.Join(values, ", "))
+}
+
+func effective(fd int) []string {
+	var values []string
+	getInt := func(level, option int) int {
+		value, err := unix.GetsockoptInt(fd, level, option)
+		if err != nil {
+			return unset
+		}
+		return value
+	}
+
+	family := getInt(unix.SOL_SOCKET, unix.SO_DOMAIN)
+	values = append(values,
+		fmt.Sprintf("send buffer %d", getInt(unix.SOL_SOCKET, unix.SO_SNDBUF)),
+		fmt.Sprintf("receive buffer %d", getInt(unix.SOL_SOCKET, unix.SO_RCVBUF)))
+	if family == unix.AF_UNIX {
+		return values
+	}
+	if family == unix.AF_INET6 {
+		values = append(values,
+			fmt.Sprintf("DSCP %d", getInt(unix.IPPROTO_IPV6, unix.IPV6_TCLASS)>>2),
+			fmt.Sprintf("TTL %d", getInt(unix.IPPROTO_IPV6, unix.IPV6_UNICAST_HOPS)))
+	} else {
+		values = append(values,
+			fmt.Sprintf("DSCP %d", getInt(unix.IPPROTO_IP, unix.IP_TOS)>>2),
+			fmt.Sprintf("TTL %d", getInt(unix.IPPROTO_IP, unix.IP_TTL)))
+	}
+	values = append(values,
+		fmt.Sprintf("reuse port %t", getInt(unix.SOL_SOCKET, unix.SO_REUSEPORT) == 1),
+		fmt.Sprintf("busy poll %s", time.Duration(getInt(unix.SOL_SOCKET, unix.SO_BUSY_POLL))*time.Microsecond))
+
+	if getInt(unix.SOL_SOCKET, unix.SO_TYPE) == unix.SOCK_STREAM {
+		congestion, _ := unix.GetsockoptString(fd, unix.IPPROTO_TCP, unix.TCP_CONGESTION)
+		values = append(values,
+			fmt.Sprintf("no delay %t", getInt(unix.IPPROTO_TCP, unix.TCP_NODELAY) == 1),
+			fmt.Sprintf("congestion %s", congestion))
+	}
+
+	return values
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package sockopt
+
+import "errors"
+
+// Socket options are only set on Linux. Leaving them all unset is accepted
+// everywhere so adapters work unchanged on other platforms.
+func (o *Options) apply(descriptor uintptr) error {
+	if o.isSet() {
+		return errors.New("Socket options are only supported on Linux")
+	}
+	return nil
+}
+
+func Log(name string, conn interface{}) {
+}
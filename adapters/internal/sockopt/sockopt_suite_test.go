@@ -0,0 +1,13 @@
+package sockopt_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestSockopt(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Adapters - Internal - Socket Options Suite")
+}
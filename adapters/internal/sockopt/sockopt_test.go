@@ -0,0 +1,169 @@
+package sockopt_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/adapters/internal/sockopt"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Socket options", func() {
+	var (
+		config jsonstruct.JSONStruct
+	)
+
+	BeforeEach(func() {
+		config = jsonstruct.New()
+	})
+
+	It("leaves sockets alone when nothing is set", func() {
+		options, err := sockopt.New(config)
+		Expect(err).NotTo(HaveOccurred())
+
+		connection, err := options.ListenConfig().ListenPacket(context.Background(), "udp4", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		defer connection.Close()
+
+		tos, err := ipv4.NewConn(connection.(*net.UDPConn)).TOS()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tos).To(Equal(0))
+	})
+
+	Context("on Linux", func() {
+		BeforeEach(func() {
+			if runtime.GOOS != "linux" {
+				Skip("Socket options are only supported on Linux")
+			}
+		})
+
+		It("sets DSCP and TTL", func() {
+			config.SetInt(sockopt.DSCP, 46)
+			config.SetInt(sockopt.TTL, 7)
+			options, err := sockopt.New(config)
+			Expect(err).NotTo(HaveOccurred())
+
+			connection, err := options.ListenConfig().ListenPacket(context.Background(), "udp4", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			defer connection.Close()
+
+			packetConn := ipv4.NewConn(connection.(*net.UDPConn))
+			tos, err := packetConn.TOS()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tos).To(Equal(46 << 2))
+			ttl, err := packetConn.TTL()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ttl).To(Equal(7))
+		})
+
+		It("allows several sockets to bind the same port with reuse port", func() {
+			config.SetString(sockopt.ReusePort, "true")
+			options, err := sockopt.New(config)
+			Expect(err).NotTo(HaveOccurred())
+
+			first, err := options.ListenConfig().ListenPacket(context.Background(), "udp4", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			defer first.Close()
+
+			second, err := options.ListenConfig().ListenPacket(context.Background(), "udp4", first.LocalAddr().String())
+			Expect(err).NotTo(HaveOccurred())
+			second.Close()
+		})
+
+		It("sets the options on accepted and dialed TCP connections", func() {
+			config.SetInt(sockopt.DSCP, 10)
+			config.SetString(sockopt.NoDelay, "false")
+			options, err := sockopt.New(config)
+			Expect(err).NotTo(HaveOccurred())
+
+			listener, err := options.Listen("tcp4", "127.0.0.1:0", "test listener")
+			Expect(err).NotTo(HaveOccurred())
+			defer listener.Close()
+
+			accepted := make(chan net.Conn, 1)
+			go func() {
+				defer GinkgoRecover()
+				connection, err := listener.Accept()
+				Expect(err).NotTo(HaveOccurred())
+				accepted <- connection
+			}()
+
+			dial := options.DialContext("test dialer")
+			dialed, err := dial(context.Background(), "tcp4", listener.Addr().String())
+			Expect(err).NotTo(HaveOccurred())
+			defer dialed.Close()
+
+			var connection net.Conn
+			Eventually(accepted).Should(Receive(&connection))
+			defer connection.Close()
+
+			for _, c := range []net.Conn{dialed, connection} {
+				tos, err := ipv4.NewConn(c).TOS()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(tos).To(Equal(10 << 2))
+			}
+		})
+
+		It("sets only the buffer sizes of Unix domain sockets", func() {
+			config.SetInt(sockopt.ReceiveBuffer, 65536)
+			config.SetInt(sockopt.DSCP, 46)
+			config.SetString(sockopt.Congestion, "not-an-algorithm")
+			options, err := sockopt.New(config)
+			Expect(err).NotTo(HaveOccurred())
+
+			path := filepath.Join(os.TempDir(), fmt.Sprintf("netspel-sockopt-%d.sock", os.Getpid()))
+			connection, err := options.ListenConfig().ListenPacket(context.Background(), "unixgram", path)
+			Expect(err).NotTo(HaveOccurred())
+			defer os.Remove(path)
+			defer connection.Close()
+
+			rawConn, err := connection.(*net.UnixConn).SyscallConn()
+			Expect(err).NotTo(HaveOccurred())
+			var receiveBuffer int
+			rawConn.Control(func(fd uintptr) {
+				receiveBuffer, err = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_RCVBUF)
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(receiveBuffer).To(Equal(2 * 65536))
+		})
+
+		It("fails for an unknown congestion control algorithm", func() {
+			config.SetString(sockopt.Congestion, "not-an-algorithm")
+			options, err := sockopt.New(config)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = options.Listen("tcp4", "127.0.0.1:0", "test listener")
+			Expect(err).To(MatchError(ContainSubstring("Unable to set TCP_CONGESTION to not-an-algorithm")))
+		})
+	})
+
+	It("rejects a DSCP out of range", func() {
+		config.SetInt(sockopt.DSCP, 64)
+
+		_, err := sockopt.New(config)
+		Expect(err).To(MatchError("DSCP must be between 0 and 63, 64"))
+	})
+
+	It("rejects a negative buffer size", func() {
+		config.SetInt(sockopt.ReceiveBuffer, -1)
+
+		_, err := sockopt.New(config)
+		Expect(err).To(MatchError("Receive buffer size must not be negative, -1"))
+	})
+
+	It("rejects an invalid boolean", func() {
+		config.SetString(sockopt.NoDelay, "sometimes")
+
+		_, err := sockopt.New(config)
+		Expect(err).To(MatchError("Invalid boolean at .socket.no-delay, sometimes"))
+	})
+})
@@ -0,0 +1,13 @@
+package quic_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestQUIC(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Adapters - QUIC Suite")
+}
@@ -0,0 +1,262 @@
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/adapters/internal/framing"
+	"github.com/myshkin5/netspel/adapters/internal/sockopt"
+	"github.com/myshkin5/netspel/factory"
+	quicgo "github.com/quic-go/quic-go"
+)
+
+const (
+	prefix = ".quic."
+
+	Port             = prefix + "port"
+	RemoteReaderAddr = prefix + "remote-reader-addr"
+	Mode             = prefix + "mode"
+	Streams          = prefix + "streams"
+	Framing          = prefix + "framing"
+	RecordSize       = prefix + "record-size"
+
+	DefaultPort             = 57957
+	DefaultRemoteReaderAddr = "localhost"
+	DefaultMode             = Stream
+	DefaultStreams          = 1
+	DefaultFraming          = framing.LengthPrefixed
+	DefaultRecordSize       = 0
+
+	Stream   = "stream"
+	Datagram = "datagram"
+
+	protocol = "netspel"
+
+	// minIncomingStreams matches quic-go's default so a reader configured with
+	// fewer streams than its writer still accepts them.
+	minIncomingStreams = 100
+)
+
+// configKeys are read by both the writer and the reader.
+var configKeys = append([]factory.ConfigKey{
+	{Path: Port, Type: factory.IntType, Default: fmt.Sprint(DefaultPort), Range: factory.Between(0, 65535),
+		Doc: "The UDP port on which the remote reader process listens."},
+	{Path: RemoteReaderAddr, Type: factory.StringType, Default: DefaultRemoteReaderAddr,
+		Doc: "The IP address of the remote reader process. Used by the writer only."},
+	{Path: Mode, Type: factory.StringType, Default: DefaultMode, Values: []string{Stream, Datagram},
+		Doc: "Whether messages are sent on streams or as datagrams. Must be the same for the reader and the writer."},
+	{Path: Streams, Type: factory.IntType, Default: fmt.Sprint(DefaultStreams), Range: factory.AtLeast(1),
+		Doc: "The number of parallel streams the writer opens in stream mode."},
+	{Path: Framing, Type: factory.StringType, Default: DefaultFraming, Values: []string{framing.LengthPrefixed, framing.Newline, framing.Fixed},
+		Doc: "The framing used to delimit messages on streams. Must be the same for the reader and the writer."},
+	{Path: RecordSize, Type: factory.IntType, Default: fmt.Sprint(DefaultRecordSize), Range: factory.AtLeast(0),
+		Doc: "The count of bytes per record when using fixed framing. When zero, records match the scheme's message size. Every message must be the record size."},
+}, sockopt.ConfigKeys...)
+
+func init() {
+	factory.RegisterReader(factory.Descriptor{
+		Name:        "quic",
+		Description: "Reads messages from QUIC streams or datagrams.",
+		Config:      configKeys,
+	}, func() factory.Reader {
+		return &Reader{}
+	})
+}
+
+type Reader struct {
+	packetConn net.PacketConn
+	listener   *quicgo.Listener
+	mode       string
+	receiver   *receiver
+	sizes      framing.Sizes
+
+	mutex       sync.Mutex
+	connections []*quicgo.Conn
+}
+
+// SetMessageSizes sets the sizes fixed framing matches its records to.
+func (r *Reader) SetMessageSizes(min, max int) {
+	r.sizes = framing.Sizes{Min: min, Max: max}
+}
+
+func (r *Reader) Init(config jsonstruct.JSONStruct) error {
+	var err error
+	r.mode, err = mode(config)
+	if err != nil {
+		return err
+	}
+	r.receiver, err = newConfiguredReceiver(config, r.sizes)
+	if err != nil {
+		return err
+	}
+
+	certificate, err := selfSignedCertificate()
+	if err != nil {
+		return err
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		NextProtos:   []string{protocol},
+	}
+
+	streams, err := streamCount(config)
+	if err != nil {
+		return err
+	}
+
+	options, err := sockopt.New(config)
+	if err != nil {
+		return err
+	}
+
+	port := config.IntWithDefault(Port, DefaultPort)
+	r.packetConn, err = listenPacket(options, fmt.Sprintf(":%d", port))
+	if err != nil {
+		return err
+	}
+	r.listener, err = quicgo.Listen(r.packetConn, tlsConfig, quicConfig(r.mode, streams))
+	if err != nil {
+		r.packetConn.Close()
+		return err
+	}
+	err = applyOptions(options, r.packetConn, "QUIC reader")
+	if err != nil {
+		r.listener.Close()
+		r.packetConn.Close()
+		return err
+	}
+
+	go r.accept()
+
+	return nil
+}
+
+// Read returns the next message from any connected writer. In stream mode,
+// messages arriving on different streams are returned in the order they
+// complete, not the order they were written.
+func (r *Reader) Read(message []byte) (int, error) {
+	return r.receiver.read(message)
+}
+
+// Write replies to the writer of the most recently read message, on the stream
+// it arrived on in stream mode.
+func (r *Reader) Write(message []byte) (int, error) {
+	return r.receiver.write(message)
+}
+
+func (r *Reader) Close() error {
+	r.receiver.close()
+	err := r.listener.Close()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, connection := range r.connections {
+		connection.CloseWithError(0, "")
+	}
+
+	// quic-go leaves closing a packet conn it didn't create to its creator
+	closeErr := r.packetConn.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+func (r *Reader) accept() {
+	for {
+		connection, err := r.listener.Accept(context.Background())
+		if err != nil {
+			return
+		}
+
+		r.mutex.Lock()
+		if r.receiver.isClosing() {
+			r.mutex.Unlock()
+			connection.CloseWithError(0, "")
+			return
+		}
+		r.connections = append(r.connections, connection)
+		r.mutex.Unlock()
+
+		if r.mode == Datagram {
+			r.receiver.addConnection(connection)
+		} else {
+			go r.acceptStreams(connection)
+		}
+	}
+}
+
+func (r *Reader) acceptStreams(connection *quicgo.Conn) {
+	for {
+		stream, err := connection.AcceptStream(context.Background())
+		if err != nil {
+			return
+		}
+
+		r.receiver.addStream(stream)
+	}
+}
+
+// listenPacket creates the UDP socket QUIC runs over with the socket options
+// set before it is bound.
+func listenPacket(options *sockopt.Options, address string) (net.PacketConn, error) {
+	return options.ListenConfig().ListenPacket(context.Background(), "udp", address)
+}
+
+// applyOptions sets the socket options again once quic-go has taken the
+// socket, as quic-go raises both buffer sizes to several MiB where it can and
+// configured sizes should win.
+func applyOptions(options *sockopt.Options, packetConn net.PacketConn, name string) error {
+	err := options.Apply(packetConn.(*net.UDPConn))
+	if err != nil {
+		return err
+	}
+	sockopt.Log(name, packetConn)
+	return nil
+}
+
+func mode(config jsonstruct.JSONStruct) (string, error) {
+	mode := config.StringWithDefault(Mode, DefaultMode)
+	switch mode {
+	case Stream, Datagram:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("Unknown mode, %s", mode)
+	}
+}
+
+func streamCount(config jsonstruct.JSONStruct) (int, error) {
+	streams := config.IntWithDefault(Streams, DefaultStreams)
+	if streams <= 0 {
+		return 0, fmt.Errorf("The stream count must be positive, %d", streams)
+	}
+	return streams, nil
+}
+
+func newConfiguredReceiver(config jsonstruct.JSONStruct, sizes framing.Sizes) (*receiver, error) {
+	r := newReceiver(
+		config.StringWithDefault(Framing, DefaultFraming),
+		config.IntWithDefault(RecordSize, DefaultRecordSize),
+		sizes)
+
+	_, err := r.newFramer()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func quicConfig(mode string, streams int) *quicgo.Config {
+	if streams < minIncomingStreams {
+		streams = minIncomingStreams
+	}
+	return &quicgo.Config{
+		EnableDatagrams:    mode == Datagram,
+		MaxIncomingStreams: int64(streams),
+	}
+}
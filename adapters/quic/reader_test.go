@@ -0,0 +1,123 @@
+package quic_test
+
+import (
+	"io"
+	"runtime"
+	"time"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/adapters/internal/sockopt"
+	"github.com/myshkin5/netspel/adapters/quic"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Reader", func() {
+	var (
+		port   int
+		config jsonstruct.JSONStruct
+		reader *quic.Reader
+	)
+
+	BeforeEach(func() {
+		if port == 0 {
+			port = 53210
+		}
+		port++
+
+		config = jsonstruct.New()
+		config.SetInt(quic.Port, port)
+
+		reader = &quic.Reader{}
+	})
+
+	It("returns from a call to Read() when Close() is called", func() {
+		err := reader.Init(config)
+		Expect(err).NotTo(HaveOccurred())
+
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			messageRead := make([]byte, 1024)
+			bytesRead, err := reader.Read(messageRead)
+			Expect(err).To(Equal(io.EOF))
+			Expect(bytesRead).To(Equal(0))
+			close(done)
+		}()
+
+		time.Sleep(10 * time.Millisecond)
+
+		err = reader.Close()
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("can't reply before a message has been read", func() {
+		err := reader.Init(config)
+		Expect(err).NotTo(HaveOccurred())
+		defer reader.Close()
+
+		_, err = reader.Write([]byte("pong"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("keeps reading after a writer disconnects", func() {
+		err := reader.Init(config)
+		Expect(err).NotTo(HaveOccurred())
+		defer reader.Close()
+
+		for _, message := range []string{"first", "second"} {
+			writer := &quic.Writer{}
+			err = writer.Init(config)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = writer.Write([]byte(message))
+			Expect(err).NotTo(HaveOccurred())
+
+			messageRead := make([]byte, 1024)
+			count, err := reader.Read(messageRead)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(messageRead[:count])).To(Equal(message))
+
+			Expect(writer.Close()).To(Succeed())
+		}
+	})
+
+	It("reads messages with socket options set", func() {
+		if runtime.GOOS != "linux" {
+			Skip("Socket options are only supported on Linux")
+		}
+		config.SetInt(sockopt.ReceiveBuffer, 65536)
+		config.SetInt(sockopt.DSCP, 46)
+		err := reader.Init(config)
+		Expect(err).NotTo(HaveOccurred())
+		defer reader.Close()
+
+		writer := &quic.Writer{}
+		err = writer.Init(config)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = writer.Write([]byte("hello"))
+		Expect(err).NotTo(HaveOccurred())
+
+		messageRead := make([]byte, 1024)
+		count, err := reader.Read(messageRead)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(messageRead[:count])).To(Equal("hello"))
+
+		Expect(writer.Close()).To(Succeed())
+	})
+
+	It("rejects unknown modes", func() {
+		config.SetString(quic.Mode, "carrier-pigeon")
+		err := reader.Init(config)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rejects unknown framings", func() {
+		config.SetString(quic.Framing, "smoke-signals")
+		err := reader.Init(config)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,198 @@
+package quic
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/myshkin5/netspel/adapters/internal/framing"
+	quicgo "github.com/quic-go/quic-go"
+)
+
+// MaxMessageSize is the largest message read from a stream. Larger frames are
+// truncated and reported with io.ErrShortBuffer.
+const MaxMessageSize = 64 * 1024
+
+type received struct {
+	message []byte
+	err     error
+	reply   func(message []byte) (int, error)
+}
+
+// receiver merges messages read concurrently from any number of streams and
+// connections so a slow stream doesn't hold up messages on the others.
+type receiver struct {
+	framing    string
+	recordSize int
+	sizes      framing.Sizes
+	incoming   chan received
+	closing    chan struct{}
+	active     sync.WaitGroup
+
+	mutex sync.Mutex
+	reply func(message []byte) (int, error)
+}
+
+func newReceiver(framingType string, recordSize int, sizes framing.Sizes) *receiver {
+	return &receiver{
+		framing:    framingType,
+		recordSize: recordSize,
+		sizes:      sizes,
+		incoming:   make(chan received),
+		closing:    make(chan struct{}),
+	}
+}
+
+func (r *receiver) newFramer() (framing.Framer, error) {
+	return framing.New(r.framing, r.recordSize, r.sizes)
+}
+
+// read returns the next message from any stream or connection and remembers
+// where it came from so replies go back the same way.
+func (r *receiver) read(message []byte) (int, error) {
+	select {
+	case rcvd := <-r.incoming:
+		if rcvd.err != nil && rcvd.message == nil {
+			return 0, rcvd.err
+		}
+
+		r.mutex.Lock()
+		r.reply = rcvd.reply
+		r.mutex.Unlock()
+
+		count := copy(message, rcvd.message)
+		if count < len(rcvd.message) {
+			return count, io.ErrShortBuffer
+		}
+		return count, rcvd.err
+	case <-r.closing:
+		return 0, io.EOF
+	}
+}
+
+func (r *receiver) write(message []byte) (int, error) {
+	r.mutex.Lock()
+	reply := r.reply
+	r.mutex.Unlock()
+
+	if reply == nil {
+		return 0, errors.New("No message has been read, nowhere to reply to")
+	}
+	return reply(message)
+}
+
+func (r *receiver) close() {
+	close(r.closing)
+}
+
+func (r *receiver) addStream(stream *quicgo.Stream) {
+	r.active.Add(1)
+	go r.readStream(stream)
+}
+
+func (r *receiver) addConnection(connection *quicgo.Conn) {
+	r.active.Add(1)
+	go r.readDatagrams(connection)
+}
+
+// readStream reads framed messages until the peer finishes the stream, then
+// finishes its own side so the peer knows every message was read. Messages
+// that arrive after close are discarded so the stream can still be drained.
+func (r *receiver) readStream(stream *quicgo.Stream) {
+	defer r.active.Done()
+
+	readFramer, err := r.newFramer()
+	if err != nil {
+		r.deliver(received{err: err})
+		return
+	}
+	writeFramer, err := r.newFramer()
+	if err != nil {
+		r.deliver(received{err: err})
+		return
+	}
+
+	var writeMutex sync.Mutex
+	reply := func(message []byte) (int, error) {
+		writeMutex.Lock()
+		defer writeMutex.Unlock()
+		return writeFramer.WriteFrame(stream, message)
+	}
+
+	buffered := bufio.NewReaderSize(stream, MaxMessageSize)
+	buffer := make([]byte, MaxMessageSize)
+	for {
+		count, err := readFramer.ReadFrame(buffered, buffer)
+		if err == io.EOF {
+			stream.Close()
+			return
+		}
+		if err != nil && err != io.ErrShortBuffer {
+			if !r.isClosing() && !isConnectionClosed(err) {
+				r.deliver(received{err: err})
+			}
+			return
+		}
+
+		message := make([]byte, count)
+		copy(message, buffer)
+		r.deliver(received{
+			message: message,
+			err:     err,
+			reply:   reply,
+		})
+	}
+}
+
+// readDatagrams reads datagrams until the connection closes.
+func (r *receiver) readDatagrams(connection *quicgo.Conn) {
+	defer r.active.Done()
+
+	reply := func(message []byte) (int, error) {
+		err := connection.SendDatagram(message)
+		if err != nil {
+			return 0, err
+		}
+		return len(message), nil
+	}
+
+	for {
+		message, err := connection.ReceiveDatagram(context.Background())
+		if err != nil {
+			if !r.isClosing() && !isConnectionClosed(err) {
+				r.deliver(received{err: err})
+			}
+			return
+		}
+
+		r.deliver(received{
+			message: message,
+			reply:   reply,
+		})
+	}
+}
+
+func (r *receiver) deliver(rcvd received) {
+	select {
+	case r.incoming <- rcvd:
+	case <-r.closing:
+	}
+}
+
+func (r *receiver) isClosing() bool {
+	select {
+	case <-r.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+// isConnectionClosed reports whether the peer closed the connection, which
+// ends its streams without being an error.
+func isConnectionClosed(err error) bool {
+	var applicationErr *quicgo.ApplicationError
+	return errors.As(err, &applicationErr) && applicationErr.Remote
+}
@@ -0,0 +1,202 @@
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/adapters/internal/framing"
+	"github.com/myshkin5/netspel/adapters/internal/sockopt"
+	"github.com/myshkin5/netspel/factory"
+	quicgo "github.com/quic-go/quic-go"
+)
+
+// drainTimeout bounds how long Close waits for the reader to read every
+// message written on the writer's streams.
+const drainTimeout = 5 * time.Second
+
+func init() {
+	factory.RegisterWriter(factory.Descriptor{
+		Name:        "quic",
+		Description: "Writes messages on QUIC streams or as QUIC datagrams.",
+		Config:      configKeys,
+	}, func() factory.Writer {
+		return &Writer{}
+	})
+}
+
+type Writer struct {
+	packetConn net.PacketConn
+	connection *quicgo.Conn
+	mode       string
+	receiver   *receiver
+	sizes      framing.Sizes
+	closed     int32
+
+	// mutex keeps Close from finishing streams while a message is part way
+	// through being written to them
+	mutex   sync.Mutex
+	streams []writerStream
+	next    int
+}
+
+type writerStream struct {
+	stream *quicgo.Stream
+	framer framing.Framer
+}
+
+// SetMessageSizes sets the sizes fixed framing matches its records to.
+func (w *Writer) SetMessageSizes(min, max int) {
+	w.sizes = framing.Sizes{Min: min, Max: max}
+}
+
+func (w *Writer) Init(config jsonstruct.JSONStruct) error {
+	var err error
+	w.mode, err = mode(config)
+	if err != nil {
+		return err
+	}
+	streams, err := streamCount(config)
+	if err != nil {
+		return err
+	}
+	w.receiver, err = newConfiguredReceiver(config, w.sizes)
+	if err != nil {
+		return err
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{protocol},
+	}
+
+	options, err := sockopt.New(config)
+	if err != nil {
+		return err
+	}
+
+	port := config.IntWithDefault(Port, DefaultPort)
+	remoteAddr := config.StringWithDefault(RemoteReaderAddr, DefaultRemoteReaderAddr)
+	raddr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(remoteAddr, strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+	w.packetConn, err = listenPacket(options, ":0")
+	if err != nil {
+		return err
+	}
+	w.connection, err = quicgo.Dial(context.Background(), w.packetConn, raddr, tlsConfig, quicConfig(w.mode, streams))
+	if err != nil {
+		w.packetConn.Close()
+		return err
+	}
+	err = applyOptions(options, w.packetConn, "QUIC writer")
+	if err != nil {
+		w.abort()
+		return err
+	}
+
+	if w.mode == Datagram {
+		w.receiver.addConnection(w.connection)
+		return nil
+	}
+
+	for i := 0; i < streams; i++ {
+		stream, err := w.connection.OpenStreamSync(context.Background())
+		if err != nil {
+			w.abort()
+			return err
+		}
+		framer, err := w.receiver.newFramer()
+		if err != nil {
+			w.abort()
+			return err
+		}
+
+		w.streams = append(w.streams, writerStream{
+			stream: stream,
+			framer: framer,
+		})
+		w.receiver.addStream(stream)
+	}
+
+	return nil
+}
+
+// Write sends a message on the next stream in turn so a message delayed by
+// loss only holds up later messages on the same stream. In datagram mode the
+// message is sent in a single unreliable DATAGRAM frame and must fit in one
+// QUIC packet.
+func (w *Writer) Write(message []byte) (int, error) {
+	if w.mode == Datagram {
+		err := w.connection.SendDatagram(message)
+		if err != nil {
+			return 0, err
+		}
+		return len(message), nil
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if atomic.LoadInt32(&w.closed) == 1 {
+		return 0, errors.New("Writer closed")
+	}
+
+	s := w.streams[w.next]
+	w.next = (w.next + 1) % len(w.streams)
+	return s.framer.WriteFrame(s.stream, message)
+}
+
+// Read returns replies sent back by the reader.
+func (w *Writer) Read(message []byte) (int, error) {
+	return w.receiver.read(message)
+}
+
+// Close finishes each stream and waits for the reader to finish its side,
+// which it does once it has read everything written, before closing the
+// connection. Closing the connection straight away would discard messages
+// still in flight.
+func (w *Writer) Close() error {
+	if !atomic.CompareAndSwapInt32(&w.closed, 0, 1) {
+		return nil
+	}
+
+	w.receiver.close()
+	w.mutex.Lock()
+	for _, s := range w.streams {
+		s.stream.Close()
+	}
+	w.mutex.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		w.receiver.active.Wait()
+		close(drained)
+	}()
+	if len(w.streams) > 0 {
+		select {
+		case <-drained:
+		case <-time.After(drainTimeout):
+		}
+	}
+
+	err := w.connection.CloseWithError(0, "")
+	closeErr := w.packetConn.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// abort closes a connection that failed to initialize along with its socket.
+func (w *Writer) abort() {
+	w.connection.CloseWithError(0, "")
+	w.packetConn.Close()
+}
@@ -0,0 +1,182 @@
+package quic_test
+
+import (
+	"fmt"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/adapters/quic"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Writer", func() {
+	var (
+		port   int
+		config jsonstruct.JSONStruct
+		reader *quic.Reader
+		writer *quic.Writer
+	)
+
+	BeforeEach(func() {
+		if port == 0 {
+			port = 53310
+		}
+		port++
+
+		config = jsonstruct.New()
+		config.SetInt(quic.Port, port)
+		config.SetString(quic.RemoteReaderAddr, "localhost")
+
+		reader = nil
+		writer = &quic.Writer{}
+	})
+
+	AfterEach(func() {
+		if reader != nil {
+			reader.Close()
+		}
+	})
+
+	initBoth := func() {
+		reader = &quic.Reader{}
+		err := reader.Init(config)
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+		err = writer.Init(config)
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+	}
+
+	readAll := func(count int) []string {
+		var messages []string
+		messageRead := make([]byte, 1024)
+		for i := 0; i < count; i++ {
+			bytesRead, err := reader.Read(messageRead)
+			ExpectWithOffset(1, err).NotTo(HaveOccurred())
+			messages = append(messages, string(messageRead[:bytesRead]))
+		}
+		return messages
+	}
+
+	It("sends framed messages on a stream", func() {
+		initBoth()
+
+		for _, message := range []string{"hello", "", "world"} {
+			count, err := writer.Write([]byte(message))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(count).To(Equal(len(message)))
+		}
+
+		Expect(readAll(3)).To(Equal([]string{"hello", "", "world"}))
+		Expect(writer.Close()).To(Succeed())
+	})
+
+	It("spreads messages across parallel streams", func() {
+		config.SetInt(quic.Streams, 4)
+		initBoth()
+
+		var expected []string
+		for i := 0; i < 20; i++ {
+			message := fmt.Sprintf("message %d", i)
+			expected = append(expected, message)
+			_, err := writer.Write([]byte(message))
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		Expect(readAll(20)).To(ConsistOf(expected))
+		Expect(writer.Close()).To(Succeed())
+	})
+
+	It("delivers every message written before it closes", func() {
+		config.SetInt(quic.Streams, 2)
+		initBoth()
+
+		received := make(chan []string)
+		go func() {
+			defer GinkgoRecover()
+			received <- readAll(1000)
+		}()
+
+		message := make([]byte, 1000)
+		for i := 0; i < 1000; i++ {
+			_, err := writer.Write(message)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(writer.Close()).To(Succeed())
+
+		Eventually(received).Should(Receive(HaveLen(1000)))
+	})
+
+	It("uses the same framings as TCP", func() {
+		config.SetString(quic.Framing, "fixed")
+		config.SetInt(quic.RecordSize, 4)
+		initBoth()
+
+		_, err := writer.Write([]byte("four"))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = writer.Write([]byte("five!"))
+		Expect(err).To(HaveOccurred())
+
+		Expect(readAll(1)).To(Equal([]string{"four"}))
+		Expect(writer.Close()).To(Succeed())
+	})
+
+	It("sends replies back on the stream a message arrived on", func() {
+		config.SetInt(quic.Streams, 2)
+		initBoth()
+
+		_, err := writer.Write([]byte("ping"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(readAll(1)).To(Equal([]string{"ping"}))
+
+		count, err := reader.Write([]byte("pong"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(count).To(Equal(4))
+
+		reply := make([]byte, 1024)
+		count, err = writer.Read(reply)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(reply[:count])).To(Equal("pong"))
+
+		Expect(writer.Close()).To(Succeed())
+	})
+
+	Context("datagram mode", func() {
+		BeforeEach(func() {
+			config.SetString(quic.Mode, quic.Datagram)
+		})
+
+		It("sends messages in datagrams and replies the same way", func() {
+			initBoth()
+
+			count, err := writer.Write([]byte("ping"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(count).To(Equal(4))
+			Expect(readAll(1)).To(Equal([]string{"ping"}))
+
+			_, err = reader.Write([]byte("pong"))
+			Expect(err).NotTo(HaveOccurred())
+
+			reply := make([]byte, 1024)
+			count, err = writer.Read(reply)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(reply[:count])).To(Equal("pong"))
+
+			Expect(writer.Close()).To(Succeed())
+		})
+
+		It("rejects messages too large for a single packet", func() {
+			initBoth()
+
+			_, err := writer.Write(make([]byte, 64*1024))
+			Expect(err).To(HaveOccurred())
+
+			Expect(writer.Close()).To(Succeed())
+		})
+	})
+
+	It("rejects a non-positive stream count", func() {
+		config.SetInt(quic.Streams, 0)
+		err := writer.Init(config)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,106 @@
+package sse
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/myshkin5/netspel/factory"
+	"github.com/myshkin5/netspel/logs"
+)
+
+const (
+	Raw    = "raw"
+	Base64 = "base64"
+	Hex    = "hex"
+)
+
+// SSE data can't carry line breaks so payloads that may contain them must be
+// encoded. encoding counts payload bytes separately from the bytes actually
+// sent so the overhead can be reported.
+type encoding struct {
+	name         string
+	payloadBytes uint64
+	encodedBytes uint64
+}
+
+func newEncoding(name string) (*encoding, error) {
+	switch name {
+	case Raw, Base64, Hex:
+		return &encoding{name: name}, nil
+	default:
+		return nil, fmt.Errorf("Unknown encoding, %s", name)
+	}
+}
+
+func (e *encoding) encode(payload []byte) []byte {
+	var encoded []byte
+	switch e.name {
+	case Base64:
+		encoded = make([]byte, base64.StdEncoding.EncodedLen(len(payload)))
+		base64.StdEncoding.Encode(encoded, payload)
+	case Hex:
+		encoded = make([]byte, hex.EncodedLen(len(payload)))
+		hex.Encode(encoded, payload)
+	default:
+		encoded = payload
+	}
+
+	return encoded
+}
+
+// decode decodes data into payload, truncating when payload is too small.
+func (e *encoding) decode(payload, data []byte) (int, error) {
+	var decoded []byte
+	switch e.name {
+	case Base64:
+		decoded = make([]byte, base64.StdEncoding.DecodedLen(len(data)))
+		count, err := base64.StdEncoding.Decode(decoded, data)
+		if err != nil {
+			return 0, err
+		}
+		decoded = decoded[:count]
+	case Hex:
+		decoded = make([]byte, hex.DecodedLen(len(data)))
+		count, err := hex.Decode(decoded, data)
+		if err != nil {
+			return 0, err
+		}
+		decoded = decoded[:count]
+	default:
+		decoded = data
+	}
+
+	e.count(len(decoded), len(data))
+	return copy(payload, decoded), nil
+}
+
+func (e *encoding) count(payloadBytes, encodedBytes int) {
+	atomic.AddUint64(&e.payloadBytes, uint64(payloadBytes))
+	atomic.AddUint64(&e.encodedBytes, uint64(encodedBytes))
+}
+
+func (e *encoding) overhead() (uint64, uint64) {
+	return atomic.LoadUint64(&e.payloadBytes), atomic.LoadUint64(&e.encodedBytes)
+}
+
+// stats reports the overhead with the adapter's other stats.
+func (e *encoding) stats() []factory.Stat {
+	payloadBytes, encodedBytes := e.overhead()
+	return []factory.Stat{
+		{Name: "sse payload bytes", Value: payloadBytes},
+		{Name: "sse encoded bytes", Value: encodedBytes},
+	}
+}
+
+func (e *encoding) logOverhead() {
+	payloadBytes, encodedBytes := e.overhead()
+	if payloadBytes == 0 {
+		return
+	}
+
+	overhead := float64(encodedBytes-payloadBytes) / float64(payloadBytes) * 100
+	logs.Logger.Info("SSE %s encoding: %d payload bytes as %d encoded bytes, %.1f%% overhead",
+		e.name, payloadBytes, encodedBytes, overhead)
+}
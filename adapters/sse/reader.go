@@ -1,10 +1,13 @@
 package sse
 
 import (
+	"bytes"
 	"fmt"
 	"net/http"
 
 	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/adapters/internal/sockopt"
+	"github.com/myshkin5/netspel/factory"
 	vitosse "github.com/vito/go-sse/sse"
 )
 
@@ -13,22 +16,73 @@ const (
 
 	Port             = prefix + "port"
 	RemoteWriterAddr = prefix + "remote-writer-addr"
+	Encoding         = prefix + "encoding"
+	Mode             = prefix + "mode"
+	QueueSize        = prefix + "queue-size"
 
 	DefaultPort             = 38208
 	DefaultRemoteWriterAddr = "localhost"
+	DefaultEncoding         = Raw
+	DefaultMode             = Balance
+	DefaultQueueSize        = 1000
+
+	echoPath = "/echo"
 )
 
+// configKeys are read by both the writer and the reader.
+var configKeys = append([]factory.ConfigKey{
+	{Path: Port, Type: factory.IntType, Default: fmt.Sprint(DefaultPort), Range: factory.Between(0, 65535),
+		Doc: "The port on which the remote writer process listens."},
+	{Path: RemoteWriterAddr, Type: factory.StringType, Default: DefaultRemoteWriterAddr,
+		Doc: "The IP address of the remote writer process. Used by the reader only."},
+	{Path: Mode, Type: factory.StringType, Default: DefaultMode, Values: []string{Balance, Broadcast},
+		Doc: "Whether the writer sends each message to one reader or to every reader. Used by the writer only."},
+	{Path: QueueSize, Type: factory.IntType, Default: fmt.Sprint(DefaultQueueSize), Range: factory.AtLeast(1),
+		Doc: "The number of messages queued per reader in broadcast mode before the writer blocks. Used by the writer only."},
+	{Path: Encoding, Type: factory.StringType, Default: DefaultEncoding, Values: []string{Raw, Base64, Hex},
+		Doc: "How payloads are carried in event data. The writer and reader must use the same encoding."},
+}, sockopt.ConfigKeys...)
+
+func init() {
+	factory.RegisterReader(factory.Descriptor{
+		Name:        "sse",
+		Description: "Reads messages as Server-Sent Events from the writer.",
+		Config:      configKeys,
+	}, func() factory.Reader {
+		return &Reader{}
+	})
+}
+
 type Reader struct {
+	client    *http.Client
 	sseReader *vitosse.ReadCloser
+	echoURL   string
+	encoding  *encoding
 }
 
 func (r *Reader) Init(config jsonstruct.JSONStruct) error {
 	port := config.IntWithDefault(Port, DefaultPort)
 	remoteAddr := config.StringWithDefault(RemoteWriterAddr, DefaultRemoteWriterAddr)
-	resp, err := http.DefaultClient.Get(fmt.Sprintf("http://%s:%d/", remoteAddr, port))
+
+	var err error
+	r.encoding, err = newEncoding(config.StringWithDefault(Encoding, DefaultEncoding))
+	if err != nil {
+		return err
+	}
+
+	options, err := sockopt.New(config)
+	if err != nil {
+		return err
+	}
+	r.client = &http.Client{
+		Transport: &http.Transport{DialContext: options.DialContext("SSE reader")},
+	}
+
+	resp, err := r.client.Get(fmt.Sprintf("http://%s:%d/", remoteAddr, port))
 	if err != nil {
 		return err
 	}
+	r.echoURL = fmt.Sprintf("http://%s:%d%s", remoteAddr, port, echoPath)
 
 	r.sseReader = vitosse.NewReadCloser(resp.Body)
 
@@ -40,9 +94,37 @@ func (r *Reader) Read(message []byte) (int, error) {
 	if err != nil {
 		return 0, err
 	}
-	return copy(message, event.Data), nil
+	return r.encoding.decode(message, event.Data)
+}
+
+// EncodingOverhead returns the payload bytes read and the encoded bytes they
+// were received as.
+func (r *Reader) EncodingOverhead() (uint64, uint64) {
+	return r.encoding.overhead()
+}
+
+// Stats returns the payload bytes read and the encoded bytes they were
+// received as.
+func (r *Reader) Stats() []factory.Stat {
+	return r.encoding.stats()
+}
+
+// Write posts a reply back to the writer.
+func (r *Reader) Write(message []byte) (int, error) {
+	resp, err := r.client.Post(r.echoURL, "application/octet-stream", bytes.NewReader(message))
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("Reply rejected by writer, %s", resp.Status)
+	}
+
+	return len(message), nil
 }
 
 func (r *Reader) Close() error {
+	r.encoding.logOverhead()
 	return r.sseReader.Close()
 }
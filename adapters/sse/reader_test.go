@@ -3,11 +3,16 @@ package sse_test
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"sync"
 	"time"
 
 	"github.com/myshkin5/jsonstruct"
 	"github.com/myshkin5/netspel/adapters/sse"
+	"github.com/myshkin5/netspel/factory"
 	vitosse "github.com/vito/go-sse/sse"
 
 	. "github.com/onsi/ginkgo"
@@ -19,13 +24,25 @@ var _ = Describe("Reader", func() {
 		port            int
 		sleepBeforeSend time.Duration
 		events          []*vitosse.Event
+		replies         chan []byte
 		config          jsonstruct.JSONStruct
 		reader          sse.Reader
+
+		// lock guards sleepBeforeSend and events which handlers from earlier
+		// tests may still read
+		lock sync.Mutex
 	)
 
 	handle := func(w http.ResponseWriter, r *http.Request) {
 		defer GinkgoRecover()
 
+		if r.URL.Path == "/echo" {
+			reply, err := ioutil.ReadAll(r.Body)
+			Expect(err).NotTo(HaveOccurred())
+			replies <- reply
+			return
+		}
+
 		w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
 		w.Header().Set("Cache-Control", "no-cache")
 		w.Header().Set("Connection", "keep-alive")
@@ -34,9 +51,13 @@ var _ = Describe("Reader", func() {
 		flusher := w.(http.Flusher)
 		flusher.Flush()
 
-		time.Sleep(sleepBeforeSend)
+		lock.Lock()
+		sleep, toSend := sleepBeforeSend, events
+		lock.Unlock()
 
-		for _, event := range events {
+		time.Sleep(sleep)
+
+		for _, event := range toSend {
 			err := event.Write(w)
 			Expect(err).NotTo(HaveOccurred())
 			flusher.Flush()
@@ -55,7 +76,10 @@ var _ = Describe("Reader", func() {
 			Expect(err).NotTo(HaveOccurred())
 		}()
 
+		lock.Lock()
 		events = []*vitosse.Event{}
+		lock.Unlock()
+		replies = make(chan []byte, 10)
 
 		time.Sleep(50 * time.Millisecond)
 
@@ -72,8 +96,10 @@ var _ = Describe("Reader", func() {
 			Name: "event-name",
 			Data: make([]byte, 100),
 		}
+		lock.Lock()
 		events = append(events, event)
 		events = append(events, event)
+		lock.Unlock()
 
 		err := reader.Init(config)
 		Expect(err).NotTo(HaveOccurred())
@@ -98,7 +124,9 @@ var _ = Describe("Reader", func() {
 		err := reader.Init(config)
 		Expect(err).NotTo(HaveOccurred())
 
+		lock.Lock()
 		sleepBeforeSend = time.Second
+		lock.Unlock()
 		done := make(chan struct{})
 		go func() {
 			defer GinkgoRecover()
@@ -115,4 +143,53 @@ var _ = Describe("Reader", func() {
 		Expect(err).NotTo(HaveOccurred())
 		Eventually(done).Should(BeClosed())
 	})
+
+	It("posts replies back to the writer", func() {
+		err := reader.Init(config)
+		Expect(err).NotTo(HaveOccurred())
+
+		count, err := reader.Write([]byte("pong"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(count).To(Equal(4))
+
+		Eventually(replies).Should(Receive(Equal([]byte("pong"))))
+
+		err = reader.Close()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("decodes encoded events", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			(&vitosse.Event{Data: []byte("aGkKdGhlcmU=")}).Write(w)
+			(&vitosse.Event{Data: []byte("not base64!")}).Write(w)
+		}))
+		defer server.Close()
+
+		config.SetInt(sse.Port, server.Listener.Addr().(*net.TCPAddr).Port)
+		config.SetString(sse.Encoding, sse.Base64)
+
+		err := reader.Init(config)
+		Expect(err).NotTo(HaveOccurred())
+
+		message := make([]byte, 200)
+		count, err := reader.Read(message)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(message[:count]).To(Equal([]byte("hi\nthere")))
+
+		_, err = reader.Read(message)
+		Expect(err).To(HaveOccurred())
+
+		payloadBytes, encodedBytes := reader.EncodingOverhead()
+		Expect(payloadBytes).To(BeEquivalentTo(8))
+		Expect(encodedBytes).To(BeEquivalentTo(12))
+
+		err = reader.Close()
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(factory.CollectStats(&reader)).To(Equal([]factory.Stat{
+			{Name: "sse payload bytes", Value: 8},
+			{Name: "sse encoded bytes", Value: 12},
+		}))
+	})
 })
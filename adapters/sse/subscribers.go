@@ -0,0 +1,226 @@
+package sse
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/myshkin5/netspel/factory"
+	"github.com/myshkin5/netspel/logs"
+)
+
+const (
+	Balance   = "balance"
+	Broadcast = "broadcast"
+)
+
+// ReaderStats describes delivery to one connected reader. Lag is the number of
+// messages written but not yet delivered to the reader; delay is the time from
+// the write to the event being flushed to the reader. Lag and delay are only
+// tracked in broadcast mode as a balanced writer hands each message to a single
+// waiting reader.
+type ReaderStats struct {
+	ID           int
+	RemoteAddr   string
+	Connected    bool
+	Delivered    uint64
+	Lag          int
+	MaxLag       int
+	AverageDelay time.Duration
+	MaxDelay     time.Duration
+}
+
+type queued struct {
+	message []byte
+	written time.Time
+}
+
+type subscriber struct {
+	id         int
+	remoteAddr string
+	queue      chan queued
+	gone       chan struct{}
+
+	lock       sync.Mutex
+	delivered  uint64
+	maxLag     int
+	totalDelay time.Duration
+	maxDelay   time.Duration
+}
+
+// subscribers tracks every reader that connected to the writer, including
+// readers that have since disconnected so the final report covers them.
+type subscribers struct {
+	lock      sync.Mutex
+	all       []*subscriber
+	queueSize int
+	joined    chan struct{}
+}
+
+func newSubscribers(queueSize int) *subscribers {
+	return &subscribers{
+		queueSize: queueSize,
+		joined:    make(chan struct{}, 1),
+	}
+}
+
+func (s *subscribers) add(remoteAddr string) *subscriber {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sub := &subscriber{
+		id:         len(s.all) + 1,
+		remoteAddr: remoteAddr,
+		queue:      make(chan queued, s.queueSize),
+		gone:       make(chan struct{}),
+	}
+	s.all = append(s.all, sub)
+
+	select {
+	case s.joined <- struct{}{}:
+	default:
+	}
+
+	return sub
+}
+
+func (s *subscribers) remove(sub *subscriber) {
+	close(sub.gone)
+}
+
+// connected blocks until at least one reader is connected or closing is
+// closed.
+func (s *subscribers) connected(closing <-chan struct{}) ([]*subscriber, bool) {
+	for {
+		s.lock.Lock()
+		var connected []*subscriber
+		for _, sub := range s.all {
+			if !sub.isGone() {
+				connected = append(connected, sub)
+			}
+		}
+		s.lock.Unlock()
+
+		if len(connected) > 0 {
+			return connected, true
+		}
+
+		select {
+		case <-s.joined:
+		case <-closing:
+			return nil, false
+		}
+	}
+}
+
+func (s *subscribers) stats() []ReaderStats {
+	s.lock.Lock()
+	all := make([]*subscriber, len(s.all))
+	copy(all, s.all)
+	s.lock.Unlock()
+
+	stats := make([]ReaderStats, 0, len(all))
+	for _, sub := range all {
+		stats = append(stats, sub.stats())
+	}
+	return stats
+}
+
+// collected reports each reader's stats with the writer's other stats, named
+// by the reader's ID. Delays are in nanoseconds.
+func (s *subscribers) collected(mode string) []factory.Stat {
+	var collected []factory.Stat
+	for _, stats := range s.stats() {
+		name := fmt.Sprintf("sse reader %d ", stats.ID)
+		collected = append(collected, factory.Stat{Name: name + "delivered", Value: stats.Delivered})
+		if mode == Broadcast {
+			collected = append(collected,
+				factory.Stat{Name: name + "lag", Value: uint64(stats.Lag)},
+				factory.Stat{Name: name + "max lag", Value: uint64(stats.MaxLag)},
+				factory.Stat{Name: name + "average delay ns", Value: uint64(stats.AverageDelay)},
+				factory.Stat{Name: name + "max delay ns", Value: uint64(stats.MaxDelay)})
+		}
+	}
+	return collected
+}
+
+func (s *subscribers) logStats(mode string) {
+	for _, stats := range s.stats() {
+		if mode == Broadcast {
+			logs.Logger.Info("Reader %d (%s): %d delivered, %d behind (%d max), %s average delay, %s max delay",
+				stats.ID, stats.RemoteAddr, stats.Delivered, stats.Lag, stats.MaxLag, stats.AverageDelay, stats.MaxDelay)
+			if stats.Lag > 0 {
+				logs.Logger.Warning("Reader %d (%s): %d written messages were never delivered", stats.ID, stats.RemoteAddr, stats.Lag)
+			}
+		} else {
+			logs.Logger.Info("Reader %d (%s): %d delivered", stats.ID, stats.RemoteAddr, stats.Delivered)
+		}
+	}
+}
+
+// enqueue blocks while the reader's queue is full so a slow reader slows the
+// writer rather than silently missing messages.
+func (sub *subscriber) enqueue(item queued, closing <-chan struct{}) error {
+	select {
+	case sub.queue <- item:
+	case <-sub.gone:
+		return nil
+	case <-closing:
+		return errors.New("Writer closing")
+	}
+
+	lag := len(sub.queue)
+	sub.lock.Lock()
+	if lag > sub.maxLag {
+		sub.maxLag = lag
+	}
+	sub.lock.Unlock()
+
+	return nil
+}
+
+// deliver records a delivered message. A zero written time records the
+// delivery without a delay.
+func (sub *subscriber) deliver(written time.Time) {
+	sub.lock.Lock()
+	defer sub.lock.Unlock()
+
+	sub.delivered++
+	if written.IsZero() {
+		return
+	}
+	delay := time.Since(written)
+	sub.totalDelay += delay
+	if delay > sub.maxDelay {
+		sub.maxDelay = delay
+	}
+}
+
+func (sub *subscriber) isGone() bool {
+	select {
+	case <-sub.gone:
+		return true
+	default:
+		return false
+	}
+}
+
+func (sub *subscriber) stats() ReaderStats {
+	sub.lock.Lock()
+	defer sub.lock.Unlock()
+
+	stats := ReaderStats{
+		ID:         sub.id,
+		RemoteAddr: sub.remoteAddr,
+		Connected:  !sub.isGone(),
+		Delivered:  sub.delivered,
+		Lag:        len(sub.queue),
+		MaxLag:     sub.maxLag,
+		MaxDelay:   sub.maxDelay,
+	}
+	if sub.delivered > 0 {
+		stats.AverageDelay = sub.totalDelay / time.Duration(sub.delivered)
+	}
+	return stats
+}
@@ -3,19 +3,46 @@ package sse
 import (
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/adapters/internal/sockopt"
+	"github.com/myshkin5/netspel/factory"
 	"github.com/myshkin5/netspel/logs"
 	vitosse "github.com/vito/go-sse/sse"
 )
 
+// drainTimeout bounds how long a closing broadcast writer keeps sending the
+// messages still queued for each reader.
+const drainTimeout = 5 * time.Second
+
+func init() {
+	factory.RegisterWriter(factory.Descriptor{
+		Name:        "sse",
+		Description: "Serves messages as Server-Sent Events to the readers that connect to it.",
+		Config:      configKeys,
+	}, func() factory.Writer {
+		return &Writer{}
+	})
+}
+
 type Writer struct {
+	listener  net.Listener
 	server    *http.Server
 	messages  chan []byte
 	responses chan response
+	replies   chan []byte
+	closing   chan struct{}
 	readers   sync.WaitGroup
+	encoding  *encoding
+
+	mode        string
+	subscribers *subscribers
 }
 
 type response struct {
@@ -25,31 +52,142 @@ type response struct {
 
 func (w *Writer) Init(config jsonstruct.JSONStruct) error {
 	port := config.IntWithDefault(Port, DefaultPort)
-	server := &http.Server{
-		Addr:    fmt.Sprintf("localhost:%d", port),
-		Handler: http.HandlerFunc(w.handle),
+	var err error
+	w.encoding, err = newEncoding(config.StringWithDefault(Encoding, DefaultEncoding))
+	if err != nil {
+		return err
 	}
 
-	go func() {
-		err := server.ListenAndServe()
-		if err != nil {
-			logs.Logger.Warning("Error when starting server, %e", err.Error())
+	w.mode = config.StringWithDefault(Mode, DefaultMode)
+	queueSize := 0
+	switch w.mode {
+	case Balance:
+	case Broadcast:
+		queueSize = config.IntWithDefault(QueueSize, DefaultQueueSize)
+		if queueSize <= 0 {
+			return fmt.Errorf("The queue size must be positive, %d", queueSize)
 		}
-	}()
+	default:
+		return fmt.Errorf("Unknown mode, %s", w.mode)
+	}
+	w.subscribers = newSubscribers(queueSize)
+
+	options, err := sockopt.New(config)
+	if err != nil {
+		return err
+	}
+	w.listener, err = options.Listen("tcp", fmt.Sprintf("localhost:%d", port), "SSE writer")
+	if err != nil {
+		return err
+	}
 
 	w.messages = make(chan []byte)
 	w.responses = make(chan response, 1)
+	w.replies = make(chan []byte)
+	w.closing = make(chan struct{})
+
+	w.server = &http.Server{
+		Handler: http.HandlerFunc(w.handle),
+	}
+
+	go func() {
+		err := w.server.Serve(w.listener)
+		select {
+		case <-w.closing:
+		default:
+			logs.Logger.Warning("Error when serving, %s", err.Error())
+		}
+	}()
 
 	return nil
 }
 
+// Addr returns the address readers connect to.
+func (w *Writer) Addr() net.Addr {
+	return w.listener.Addr()
+}
+
+// Write sends a message to readers, blocking until a reader connects. In
+// balance mode the message goes to a single reader. In broadcast mode it is
+// queued for every connected reader.
 func (w *Writer) Write(message []byte) (int, error) {
-	w.messages <- message
+	if w.mode == Broadcast {
+		return w.broadcast(message)
+	}
+
+	encoded := w.encoding.encode(message)
+	w.messages <- encoded
 	resp := <-w.responses
-	return resp.count, resp.err
+	if resp.err != nil {
+		return 0, resp.err
+	}
+
+	w.encoding.count(len(message), resp.count)
+	return len(message), nil
+}
+
+func (w *Writer) broadcast(message []byte) (int, error) {
+	connected, ok := w.subscribers.connected(w.closing)
+	if !ok {
+		return 0, errors.New("Writer closing")
+	}
+
+	encoded := w.encoding.encode(message)
+	if w.encoding.name == Raw {
+		// Readers send the message after Write returns and the caller may
+		// reuse its buffer
+		encoded = append([]byte(nil), message...)
+	}
+
+	item := queued{
+		message: encoded,
+		written: time.Now(),
+	}
+	for _, sub := range connected {
+		err := sub.enqueue(item, w.closing)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	w.encoding.count(len(message), len(encoded))
+	return len(message), nil
+}
+
+// Readers returns delivery stats for every reader that has connected, in the
+// order they connected.
+func (w *Writer) Readers() []ReaderStats {
+	return w.subscribers.stats()
+}
+
+// EncodingOverhead returns the payload bytes written and the encoded bytes
+// they were sent as.
+func (w *Writer) EncodingOverhead() (uint64, uint64) {
+	return w.encoding.overhead()
+}
+
+// Stats returns the messages delivered to each reader, in broadcast mode with
+// how far each lagged behind, followed by the payload bytes written and the
+// encoded bytes they were sent as.
+func (w *Writer) Stats() []factory.Stat {
+	return append(w.subscribers.collected(w.mode), w.encoding.stats()...)
+}
+
+// Read returns replies the reader posts back to the writer.
+func (w *Writer) Read(message []byte) (int, error) {
+	select {
+	case reply := <-w.replies:
+		return copy(message, reply), nil
+	case <-w.closing:
+		return 0, io.EOF
+	}
 }
 
+// Close stops the writer once broadcast readers have been sent the messages
+// still queued for them, or the drain timeout has passed. Messages left
+// undelivered are logged with each reader's stats.
 func (w *Writer) Close() error {
+	close(w.closing)
 	select {
 	case <-w.messages:
 	default:
@@ -60,7 +198,9 @@ func (w *Writer) Close() error {
 		err:   errors.New("Writer closing"),
 	}
 	w.readers.Wait()
-	return nil
+	w.subscribers.logStats(w.mode)
+	w.encoding.logOverhead()
+	return w.listener.Close()
 }
 
 func (w *Writer) handle(rw http.ResponseWriter, r *http.Request) {
@@ -72,6 +212,11 @@ func (w *Writer) handle(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if r.RequestURI == echoPath && r.Method == "POST" {
+		w.handleReply(rw, r)
+		return
+	}
+
 	rw.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
 	rw.Header().Set("Cache-Control", "no-cache")
 	rw.Header().Set("Connection", "keep-alive")
@@ -82,6 +227,14 @@ func (w *Writer) handle(rw http.ResponseWriter, r *http.Request) {
 
 	closeNotifier := rw.(http.CloseNotifier).CloseNotify()
 
+	sub := w.subscribers.add(r.RemoteAddr)
+	defer w.subscribers.remove(sub)
+
+	if w.mode == Broadcast {
+		w.sendQueued(rw, flusher, closeNotifier, sub)
+		return
+	}
+
 	for {
 		select {
 		case <-closeNotifier:
@@ -97,6 +250,9 @@ func (w *Writer) handle(rw http.ResponseWriter, r *http.Request) {
 
 			err := event.Write(rw)
 			flusher.Flush()
+			if err == nil {
+				sub.deliver(time.Time{})
+			}
 
 			w.responses <- response{
 				count: len(message),
@@ -105,3 +261,74 @@ func (w *Writer) handle(rw http.ResponseWriter, r *http.Request) {
 		}
 	}
 }
+
+// sendQueued sends a broadcast reader's queued messages until the reader
+// disconnects or the writer closes, and then drains the queue.
+func (w *Writer) sendQueued(rw http.ResponseWriter, flusher http.Flusher, closeNotifier <-chan bool, sub *subscriber) {
+	for {
+		select {
+		case <-closeNotifier:
+			return
+		case <-w.closing:
+			w.drainQueued(rw, flusher, closeNotifier, sub)
+			return
+		case item := <-sub.queue:
+			if !sendEvent(rw, flusher, sub, item) {
+				return
+			}
+		}
+	}
+}
+
+// drainQueued sends the messages already queued for a reader when the writer
+// closes, giving up after the drain timeout.
+func (w *Writer) drainQueued(rw http.ResponseWriter, flusher http.Flusher, closeNotifier <-chan bool, sub *subscriber) {
+	deadline := time.NewTimer(drainTimeout)
+	defer deadline.Stop()
+	// A reader that stopped reading would otherwise block a write forever
+	http.NewResponseController(rw).SetWriteDeadline(time.Now().Add(drainTimeout))
+
+	for {
+		select {
+		case <-closeNotifier:
+			return
+		case <-deadline.C:
+			return
+		case item := <-sub.queue:
+			if !sendEvent(rw, flusher, sub, item) {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+func sendEvent(rw http.ResponseWriter, flusher http.Flusher, sub *subscriber, item queued) bool {
+	event := vitosse.Event{
+		Data: item.message,
+	}
+
+	err := event.Write(rw)
+	flusher.Flush()
+	if err != nil {
+		return false
+	}
+	sub.deliver(item.written)
+	return true
+}
+
+func (w *Writer) handleReply(rw http.ResponseWriter, r *http.Request) {
+	reply, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case w.replies <- reply:
+		rw.WriteHeader(http.StatusOK)
+	case <-w.closing:
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}
+}
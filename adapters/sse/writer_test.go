@@ -1,12 +1,15 @@
 package sse_test
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
 
 	"github.com/myshkin5/jsonstruct"
 	"github.com/myshkin5/netspel/adapters/sse"
+	"github.com/myshkin5/netspel/factory"
 	vitosse "github.com/vito/go-sse/sse"
 
 	. "github.com/onsi/ginkgo"
@@ -32,13 +35,15 @@ var _ = Describe("Writer", func() {
 		return true
 	}
 
+	var config jsonstruct.JSONStruct
+
 	BeforeEach(func() {
 		if port == 0 {
 			port = 29687
 		}
 		port++
 
-		config := jsonstruct.New()
+		config = jsonstruct.New()
 		config.SetInt(sse.Port, port)
 
 		writer = &sse.Writer{}
@@ -179,4 +184,293 @@ var _ = Describe("Writer", func() {
 		err := writer.Close()
 		Expect(err).NotTo(HaveOccurred())
 	})
+
+	It("reads replies posted by a reader", func() {
+		go func() {
+			defer GinkgoRecover()
+			resp, err := http.Post(fmt.Sprintf("http://localhost:%d/echo", port), "application/octet-stream", bytes.NewReader([]byte("pong")))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		}()
+
+		reply := make([]byte, 1024)
+		count, err := writer.Read(reply)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reply[:count]).To(Equal([]byte("pong")))
+
+		err = writer.Close()
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = writer.Read(reply)
+		Expect(err).To(Equal(io.EOF))
+	})
+
+	It("round trips payloads with line breaks when encoded", func() {
+		for _, encoding := range []string{sse.Base64, sse.Hex} {
+			writer.Close()
+			port++
+
+			config.SetInt(sse.Port, port)
+			config.SetString(sse.Encoding, encoding)
+			writer = &sse.Writer{}
+			err := writer.Init(config)
+			Expect(err).NotTo(HaveOccurred())
+
+			message := []byte("line\none\r\nline two\r\x00\xff")
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				count, err := writer.Write(message)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(count).To(Equal(len(message)))
+				close(done)
+			}()
+
+			reader := sse.Reader{}
+			err = reader.Init(config)
+			Expect(err).NotTo(HaveOccurred())
+
+			messageRead := make([]byte, 1024)
+			count, err := reader.Read(messageRead)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(messageRead[:count]).To(Equal(message))
+			Eventually(done).Should(BeClosed())
+
+			payloadBytes, encodedBytes := writer.EncodingOverhead()
+			Expect(payloadBytes).To(BeEquivalentTo(len(message)))
+			Expect(encodedBytes).To(BeNumerically(">", payloadBytes))
+			Expect(writer.Stats()).To(Equal([]factory.Stat{
+				{Name: "sse reader 1 delivered", Value: 1},
+				{Name: "sse payload bytes", Value: payloadBytes},
+				{Name: "sse encoded bytes", Value: encodedBytes},
+			}))
+
+			readPayloadBytes, readEncodedBytes := reader.EncodingOverhead()
+			Expect(readPayloadBytes).To(Equal(payloadBytes))
+			Expect(readEncodedBytes).To(Equal(encodedBytes))
+
+			reader.Close()
+		}
+
+		Expect(writer.Close()).To(Succeed())
+	})
+
+	It("sends encoded data in events", func() {
+		writer.Close()
+		port++
+
+		config.SetInt(sse.Port, port)
+		config.SetString(sse.Encoding, sse.Hex)
+		writer = &sse.Writer{}
+		err := writer.Init(config)
+		Expect(err).NotTo(HaveOccurred())
+		defer writer.Close()
+
+		go writer.Write([]byte{0x0a, 0x0d, 0xff})
+
+		resp, err := http.Get(fmt.Sprintf("http://localhost:%d", port))
+		Expect(err).NotTo(HaveOccurred())
+
+		event, err := vitosse.NewReadCloser(resp.Body).Next()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(event.Data)).To(Equal("0a0dff"))
+	})
+
+	Context("broadcast mode", func() {
+		BeforeEach(func() {
+			writer.Close()
+			port++
+
+			config.SetInt(sse.Port, port)
+			config.SetString(sse.Mode, sse.Broadcast)
+			writer = &sse.Writer{}
+			err := writer.Init(config)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(writerReady).Should(BeTrue())
+		})
+
+		connect := func() *vitosse.ReadCloser {
+			resp, err := http.Get(fmt.Sprintf("http://localhost:%d", port))
+			Expect(err).NotTo(HaveOccurred())
+			return vitosse.NewReadCloser(resp.Body)
+		}
+
+		It("sends every message to every connected reader", func() {
+			readers := []*vitosse.ReadCloser{connect(), connect(), connect()}
+			Eventually(writer.Readers).Should(HaveLen(3))
+
+			message := []byte("fan out")
+			for i := 0; i < 2; i++ {
+				count, err := writer.Write(message)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(count).To(Equal(len(message)))
+			}
+
+			for _, reader := range readers {
+				for i := 0; i < 2; i++ {
+					event, err := reader.Next()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(event.Data).To(Equal(message))
+				}
+			}
+
+			Eventually(func() []uint64 {
+				var delivered []uint64
+				for _, stats := range writer.Readers() {
+					delivered = append(delivered, stats.Delivered)
+				}
+				return delivered
+			}).Should(Equal([]uint64{2, 2, 2}))
+
+			for _, reader := range readers {
+				reader.Close()
+			}
+			Expect(writer.Close()).To(Succeed())
+
+			stats := writer.Stats()
+			Expect(stats).To(HaveLen(17))
+			for i, id := range []int{1, 2, 3} {
+				name := fmt.Sprintf("sse reader %d ", id)
+				Expect(stats[i*5]).To(Equal(factory.Stat{Name: name + "delivered", Value: 2}))
+				Expect(stats[i*5+1]).To(Equal(factory.Stat{Name: name + "lag", Value: 0}))
+				Expect(stats[i*5+2].Name).To(Equal(name + "max lag"))
+				Expect(stats[i*5+3].Name).To(Equal(name + "average delay ns"))
+				Expect(stats[i*5+4].Name).To(Equal(name + "max delay ns"))
+				Expect(stats[i*5+4].Value).To(BeNumerically(">=", stats[i*5+3].Value))
+			}
+		})
+
+		It("copies messages so callers can reuse their buffers", func() {
+			reader := connect()
+			Eventually(writer.Readers).Should(HaveLen(1))
+
+			message := []byte("first")
+			_, err := writer.Write(message)
+			Expect(err).NotTo(HaveOccurred())
+			copy(message, "later")
+
+			event, err := reader.Next()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(event.Data)).To(Equal("first"))
+
+			reader.Close()
+			Expect(writer.Close()).To(Succeed())
+		})
+
+		It("tracks messages a reader hasn't read as lag", func() {
+			resp, err := http.Get(fmt.Sprintf("http://localhost:%d", port))
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(writer.Readers).Should(HaveLen(1))
+
+			// Events too large for the connection's buffers back up in the
+			// reader's queue while nothing reads them
+			message := make([]byte, 1024*1024)
+			for i := 0; i < 10; i++ {
+				_, err := writer.Write(message)
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			Eventually(func() int {
+				return writer.Readers()[0].Lag
+			}).Should(BeNumerically(">", 0))
+			stats := writer.Readers()[0]
+			Expect(stats.Connected).To(BeTrue())
+			Expect(stats.MaxLag).To(BeNumerically(">=", stats.Lag))
+			Expect(stats.Delivered + uint64(stats.Lag)).To(BeNumerically("<=", 10))
+
+			resp.Body.Close()
+			Expect(writer.Close()).To(Succeed())
+		})
+
+		It("delivers queued messages before closing", func() {
+			reader := connect()
+			Eventually(writer.Readers).Should(HaveLen(1))
+
+			for i := 0; i < 100; i++ {
+				_, err := writer.Write([]byte(fmt.Sprintf("message %d", i)))
+				Expect(err).NotTo(HaveOccurred())
+			}
+			Expect(writer.Close()).To(Succeed())
+
+			for i := 0; i < 100; i++ {
+				event, err := reader.Next()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(event.Data)).To(Equal(fmt.Sprintf("message %d", i)))
+			}
+			Expect(writer.Readers()[0].Delivered).To(BeEquivalentTo(100))
+			reader.Close()
+		})
+
+		It("blocks a writer until a reader connects", func() {
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				_, err := writer.Write(make([]byte, 10))
+				Expect(err).To(HaveOccurred())
+				close(done)
+			}()
+
+			Consistently(done).ShouldNot(BeClosed())
+
+			Expect(writer.Close()).To(Succeed())
+			Eventually(done).Should(BeClosed())
+		})
+	})
+
+	It("balances messages across readers by default", func() {
+		readers := make(chan *vitosse.ReadCloser, 2)
+		events := make(chan *vitosse.Event, 10)
+		for i := 0; i < 2; i++ {
+			go func() {
+				defer GinkgoRecover()
+				resp, err := http.Get(fmt.Sprintf("http://localhost:%d", port))
+				Expect(err).NotTo(HaveOccurred())
+				reader := vitosse.NewReadCloser(resp.Body)
+				readers <- reader
+				for {
+					event, err := reader.Next()
+					if err != nil {
+						return
+					}
+					events <- &event
+				}
+			}()
+		}
+		Eventually(writer.Readers).Should(HaveLen(2))
+
+		for i := 0; i < 4; i++ {
+			_, err := writer.Write([]byte("balanced"))
+			Expect(err).NotTo(HaveOccurred())
+		}
+		for i := 0; i < 4; i++ {
+			Eventually(events).Should(Receive())
+		}
+		Consistently(events).ShouldNot(Receive())
+
+		var delivered uint64
+		for _, stats := range writer.Readers() {
+			delivered += stats.Delivered
+		}
+		Expect(delivered).To(BeEquivalentTo(4))
+
+		Expect(writer.Close()).To(Succeed())
+		(<-readers).Close()
+		(<-readers).Close()
+	})
+
+	It("rejects unknown modes", func() {
+		writer.Close()
+
+		config.SetString(sse.Mode, "multicast")
+		err := (&sse.Writer{}).Init(config)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rejects unknown encodings", func() {
+		writer.Close()
+
+		config.SetString(sse.Encoding, "rot13")
+		err := (&sse.Writer{}).Init(config)
+		Expect(err).To(HaveOccurred())
+	})
 })
@@ -0,0 +1,155 @@
+package tcp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/adapters/internal/framing"
+	"github.com/myshkin5/netspel/adapters/internal/sockopt"
+	"github.com/myshkin5/netspel/factory"
+)
+
+const readBufferSize = 64 * 1024
+
+func init() {
+	factory.RegisterReader(factory.Descriptor{
+		Name:        "tcp",
+		Description: "Reads framed messages from Transmission Control Protocol connections.",
+		Config:      configKeys,
+	}, func() factory.Reader {
+		return &Reader{}
+	})
+}
+
+type Reader struct {
+	listener net.Listener
+	framer   framing.Framer
+	sizes    framing.Sizes
+
+	mutex      sync.Mutex
+	closed     bool
+	connection net.Conn
+	buffered   *bufio.Reader
+}
+
+// SetMessageSizes sets the sizes fixed framing matches its records to.
+func (r *Reader) SetMessageSizes(min, max int) {
+	r.sizes = framing.Sizes{Min: min, Max: max}
+}
+
+func (r *Reader) Init(config jsonstruct.JSONStruct) error {
+	var err error
+	r.framer, err = newFramer(config, r.sizes)
+	if err != nil {
+		return err
+	}
+
+	options, err := sockopt.New(config)
+	if err != nil {
+		return err
+	}
+
+	port := config.IntWithDefault(Port, DefaultPort)
+	r.listener, err = options.Listen("tcp4", fmt.Sprintf(":%d", port), "TCP reader")
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Read returns one framed message. When a writer disconnects, Read waits for
+// the next writer to connect and only returns io.EOF once the reader is closed.
+func (r *Reader) Read(message []byte) (int, error) {
+	for {
+		if r.buffered == nil {
+			err := r.accept()
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		count, err := r.framer.ReadFrame(r.buffered, message)
+		if err == nil || err == io.ErrShortBuffer {
+			return count, err
+		}
+
+		if r.isClosed() {
+			return 0, io.EOF
+		}
+
+		r.dropConnection()
+		if err != io.EOF {
+			return 0, err
+		}
+	}
+}
+
+// Write replies to the currently connected writer.
+func (r *Reader) Write(message []byte) (int, error) {
+	r.mutex.Lock()
+	connection := r.connection
+	r.mutex.Unlock()
+
+	if connection == nil {
+		return 0, errors.New("No writer connected, nowhere to reply to")
+	}
+
+	return r.framer.WriteFrame(connection, message)
+}
+
+func (r *Reader) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.closed = true
+	if r.connection != nil {
+		r.connection.Close()
+	}
+
+	return r.listener.Close()
+}
+
+func (r *Reader) accept() error {
+	connection, err := r.listener.Accept()
+	if err != nil {
+		if r.isClosed() {
+			return io.EOF
+		}
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		connection.Close()
+		return io.EOF
+	}
+
+	r.connection = connection
+	r.buffered = bufio.NewReaderSize(connection, readBufferSize)
+
+	return nil
+}
+
+func (r *Reader) dropConnection() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.connection.Close()
+	r.connection = nil
+	r.buffered = nil
+}
+
+func (r *Reader) isClosed() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.closed
+}
@@ -0,0 +1,170 @@
+package tcp_test
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/adapters/internal/framing"
+	"github.com/myshkin5/netspel/adapters/tcp"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Reader", func() {
+	var (
+		port   int
+		config jsonstruct.JSONStruct
+		reader tcp.Reader
+	)
+
+	BeforeEach(func() {
+		if port == 0 {
+			port = 52010
+		}
+		port++
+
+		config = jsonstruct.New()
+		config.SetInt(tcp.Port, port)
+		config.SetString(tcp.Framing, framing.Fixed)
+		config.SetInt(tcp.RecordSize, 5)
+
+		reader = tcp.Reader{}
+		err := reader.Init(config)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	dial := func() net.Conn {
+		connection, err := net.Dial("tcp4", fmt.Sprintf("localhost:%d", port))
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+		return connection
+	}
+
+	readAll := func(messages chan []byte, done chan struct{}) {
+		defer GinkgoRecover()
+		messageRead := make([]byte, 1024)
+		for {
+			bytesRead, err := reader.Read(messageRead)
+			if err == io.EOF {
+				break
+			}
+			Expect(err).NotTo(HaveOccurred())
+			message := make([]byte, bytesRead)
+			copy(message, messageRead[0:bytesRead])
+			messages <- message
+		}
+		close(done)
+	}
+
+	It("reads framed messages from a TCP connection", func() {
+		done := make(chan struct{})
+		messages := make(chan []byte, 100)
+		go readAll(messages, done)
+
+		connection := dial()
+		defer connection.Close()
+
+		// Two records in one write must still be read as two messages
+		_, err := connection.Write([]byte("hellothere"))
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(messages).Should(Receive(Equal([]byte("hello"))))
+		Eventually(messages).Should(Receive(Equal([]byte("there"))))
+
+		err = reader.Close()
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("accepts a new writer after the previous writer disconnects", func() {
+		done := make(chan struct{})
+		messages := make(chan []byte, 100)
+		go readAll(messages, done)
+
+		connection := dial()
+		_, err := connection.Write([]byte("first"))
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(messages).Should(Receive(Equal([]byte("first"))))
+		connection.Close()
+
+		connection = dial()
+		defer connection.Close()
+		_, err = connection.Write([]byte("again"))
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(messages).Should(Receive(Equal([]byte("again"))))
+
+		err = reader.Close()
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("cancels a read when told to stop", func() {
+		done := make(chan struct{})
+		messageRead := make([]byte, 1024)
+		go func() {
+			defer GinkgoRecover()
+			bytesRead, err := reader.Read(messageRead)
+			Expect(err).To(Equal(io.EOF))
+			Expect(bytesRead).To(Equal(0))
+			close(done)
+		}()
+
+		time.Sleep(10 * time.Millisecond)
+
+		err := reader.Close()
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("cancels a read on a connected stream when told to stop", func() {
+		done := make(chan struct{})
+		messages := make(chan []byte, 100)
+		go readAll(messages, done)
+
+		connection := dial()
+		defer connection.Close()
+
+		time.Sleep(10 * time.Millisecond)
+
+		err := reader.Close()
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("replies to the connected writer", func() {
+		connection := dial()
+		defer connection.Close()
+
+		_, err := connection.Write([]byte("ping!"))
+		Expect(err).NotTo(HaveOccurred())
+
+		messageRead := make([]byte, 1024)
+		bytesRead, err := reader.Read(messageRead)
+		Expect(err).NotTo(HaveOccurred())
+
+		bytesWritten, err := reader.Write(messageRead[:bytesRead])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bytesWritten).To(Equal(5))
+
+		reply := make([]byte, 5)
+		_, err = io.ReadFull(connection, reply)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reply).To(Equal([]byte("ping!")))
+
+		err = reader.Close()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("returns an error when replying with no writer connected", func() {
+		_, err := reader.Write([]byte("pong!"))
+		Expect(err).To(HaveOccurred())
+
+		err = reader.Close()
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
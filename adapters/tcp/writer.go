@@ -0,0 +1,115 @@
+package tcp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/adapters/internal/framing"
+	"github.com/myshkin5/netspel/adapters/internal/sockopt"
+	"github.com/myshkin5/netspel/factory"
+)
+
+const (
+	prefix = ".tcp."
+
+	Port             = prefix + "port"
+	RemoteReaderAddr = prefix + "remote-reader-addr"
+	Framing          = prefix + "framing"
+	RecordSize       = prefix + "record-size"
+
+	DefaultPort             = 57956
+	DefaultRemoteReaderAddr = "localhost"
+	DefaultFraming          = framing.LengthPrefixed
+	DefaultRecordSize       = 0
+)
+
+// configKeys are read by both the writer and the reader.
+var configKeys = append([]factory.ConfigKey{
+	{Path: Port, Type: factory.IntType, Default: fmt.Sprint(DefaultPort), Range: factory.Between(0, 65535),
+		Doc: "The port on which the remote reader process listens."},
+	{Path: RemoteReaderAddr, Type: factory.StringType, Default: DefaultRemoteReaderAddr,
+		Doc: "The IP address of the remote reader process. Used by the writer only."},
+	{Path: Framing, Type: factory.StringType, Default: DefaultFraming, Values: []string{framing.LengthPrefixed, framing.Newline, framing.Fixed},
+		Doc: "The framing used to delimit messages. Must be the same for the reader and the writer."},
+	{Path: RecordSize, Type: factory.IntType, Default: fmt.Sprint(DefaultRecordSize), Range: factory.AtLeast(0),
+		Doc: "The count of bytes per record when using fixed framing. When zero, records match the scheme's message size. Every message must be the record size."},
+}, sockopt.ConfigKeys...)
+
+func init() {
+	factory.RegisterWriter(factory.Descriptor{
+		Name:        "tcp",
+		Description: "Writes framed messages on a Transmission Control Protocol connection to the reader.",
+		Config:      configKeys,
+	}, func() factory.Writer {
+		return &Writer{}
+	})
+}
+
+type Writer struct {
+	connection net.Conn
+	buffered   *bufio.Reader
+	framer     framing.Framer
+	sizes      framing.Sizes
+	closed     int32
+}
+
+// SetMessageSizes sets the sizes fixed framing matches its records to.
+func (w *Writer) SetMessageSizes(min, max int) {
+	w.sizes = framing.Sizes{Min: min, Max: max}
+}
+
+func (w *Writer) Init(config jsonstruct.JSONStruct) error {
+	var err error
+	w.framer, err = newFramer(config, w.sizes)
+	if err != nil {
+		return err
+	}
+
+	options, err := sockopt.New(config)
+	if err != nil {
+		return err
+	}
+
+	port := config.IntWithDefault(Port, DefaultPort)
+	remoteAddr := config.StringWithDefault(RemoteReaderAddr, DefaultRemoteReaderAddr)
+	dial := options.DialContext("TCP writer")
+	w.connection, err = dial(context.Background(), "tcp4", net.JoinHostPort(remoteAddr, strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+	w.buffered = bufio.NewReaderSize(w.connection, readBufferSize)
+
+	return nil
+}
+
+func (w *Writer) Write(message []byte) (int, error) {
+	return w.framer.WriteFrame(w.connection, message)
+}
+
+// Read returns replies sent back by the reader.
+func (w *Writer) Read(message []byte) (int, error) {
+	count, err := w.framer.ReadFrame(w.buffered, message)
+	if err != nil && atomic.LoadInt32(&w.closed) == 1 {
+		return 0, io.EOF
+	}
+
+	return count, err
+}
+
+func (w *Writer) Close() error {
+	atomic.StoreInt32(&w.closed, 1)
+	return w.connection.Close()
+}
+
+func newFramer(config jsonstruct.JSONStruct, sizes framing.Sizes) (framing.Framer, error) {
+	return framing.New(
+		config.StringWithDefault(Framing, DefaultFraming),
+		config.IntWithDefault(RecordSize, DefaultRecordSize),
+		sizes)
+}
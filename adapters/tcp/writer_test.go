@@ -0,0 +1,119 @@
+package tcp_test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/adapters/internal/framing"
+	"github.com/myshkin5/netspel/adapters/tcp"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Writer", func() {
+	var (
+		port     int
+		listener net.Listener
+		config   jsonstruct.JSONStruct
+	)
+
+	BeforeEach(func() {
+		if port == 0 {
+			port = 52041
+		}
+		port++
+
+		var err error
+		listener, err = net.Listen("tcp4", fmt.Sprintf("localhost:%d", port))
+		Expect(err).NotTo(HaveOccurred())
+
+		config = jsonstruct.New()
+		config.SetInt(tcp.Port, port)
+		config.SetString(tcp.RemoteReaderAddr, "localhost")
+	})
+
+	AfterEach(func() {
+		listener.Close()
+	})
+
+	It("writes length prefixed messages by default", func() {
+		writer := tcp.Writer{}
+		err := writer.Init(config)
+		Expect(err).NotTo(HaveOccurred())
+		defer writer.Close()
+
+		connection, err := listener.Accept()
+		Expect(err).NotTo(HaveOccurred())
+		defer connection.Close()
+
+		messageSent := []byte("hello")
+		bytesWritten, err := writer.Write(messageSent)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bytesWritten).To(Equal(len(messageSent)))
+
+		frame := make([]byte, 4+len(messageSent))
+		_, err = io.ReadFull(connection, frame)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(binary.BigEndian.Uint32(frame)).To(BeEquivalentTo(len(messageSent)))
+		Expect(frame[4:]).To(Equal(messageSent))
+	})
+
+	It("writes newline delimited messages", func() {
+		config.SetString(tcp.Framing, framing.Newline)
+
+		writer := tcp.Writer{}
+		err := writer.Init(config)
+		Expect(err).NotTo(HaveOccurred())
+		defer writer.Close()
+
+		connection, err := listener.Accept()
+		Expect(err).NotTo(HaveOccurred())
+		defer connection.Close()
+
+		_, err = writer.Write([]byte("hello"))
+		Expect(err).NotTo(HaveOccurred())
+
+		line, err := bufio.NewReader(connection).ReadString('\n')
+		Expect(err).NotTo(HaveOccurred())
+		Expect(line).To(Equal("hello\n"))
+	})
+
+	It("returns an error for an unknown framing", func() {
+		config.SetString(tcp.Framing, "carrier-pigeon")
+
+		writer := tcp.Writer{}
+		err := writer.Init(config)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("reads replies from the reader", func() {
+		writer := tcp.Writer{}
+		err := writer.Init(config)
+		Expect(err).NotTo(HaveOccurred())
+
+		connection, err := listener.Accept()
+		Expect(err).NotTo(HaveOccurred())
+		defer connection.Close()
+
+		framer, err := framing.New(framing.LengthPrefixed, 0, framing.Sizes{})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = framer.WriteFrame(connection, []byte("pong"))
+		Expect(err).NotTo(HaveOccurred())
+
+		reply := make([]byte, 1024)
+		bytesRead, err := writer.Read(reply)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reply[:bytesRead]).To(Equal([]byte("pong")))
+
+		err = writer.Close()
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = writer.Read(reply)
+		Expect(err).To(Equal(io.EOF))
+	})
+})
@@ -0,0 +1,316 @@
+package udp
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/myshkin5/netspel/logs"
+	"golang.org/x/net/ipv4"
+)
+
+const (
+	maxDatagramSize = 64 * 1024
+
+	// maxPayload is the most a single IPv4 datagram, and so a single GSO send,
+	// can carry
+	maxPayload = 65507
+)
+
+// batchWriter collects messages and sends them with one system call per
+// batch. With segmentation offload, consecutive messages of the same size are
+// sent as a single buffer that the kernel splits into datagrams. A partial
+// batch is sent once its first message has waited for the batch delay.
+type batchWriter struct {
+	packetConn *ipv4.PacketConn
+	addr       net.Addr
+	gso        bool
+	delay      time.Duration
+
+	mutex    sync.Mutex
+	buffers  [][]byte
+	count    int
+	messages []ipv4.Message
+	timer    *time.Timer
+
+	// err is set when a partial batch sent by the timer fails and is returned
+	// from the next write
+	err error
+
+	messageCount uint64
+	callCount    uint64
+}
+
+func newBatchWriter(connection *net.UDPConn, addr net.Addr, batchSize int, offload bool, delay time.Duration) *batchWriter {
+	w := &batchWriter{
+		packetConn: ipv4.NewPacketConn(connection),
+		addr:       addr,
+		gso:        offload && supportsGSO(connection),
+		delay:      delay,
+		buffers:    make([][]byte, batchSize),
+	}
+	for i := range w.buffers {
+		w.buffers[i] = make([]byte, 0, maxDatagramSize)
+	}
+	w.timer = time.AfterFunc(time.Duration(1<<63-1), w.expire)
+	w.timer.Stop()
+
+	logs.Logger.Info("UDP writer I/O path: %s", w.ioPath())
+	return w
+}
+
+// write copies the message into the batch and sends the batch once it is
+// full or, with a zero delay, straight away. An error sending a full batch is
+// returned from the write that filled it while an error sending a partial
+// batch after the delay is returned, along with the count of the current
+// message, from the next write.
+func (w *batchWriter) write(message []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	err := w.err
+	w.err = nil
+
+	w.buffers[w.count] = append(w.buffers[w.count][:0], message...)
+	w.count++
+	if w.count < len(w.buffers) && w.delay > 0 {
+		if w.count == 1 {
+			w.timer.Reset(w.delay)
+		}
+		return len(message), err
+	}
+
+	flushErr := w.flush()
+	if flushErr != nil {
+		return 0, flushErr
+	}
+	return len(message), err
+}
+
+// sendPending sends a partial batch rather than have it wait, such as before
+// blocking for a reply.
+func (w *batchWriter) sendPending() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	err := w.err
+	w.err = nil
+
+	flushErr := w.flush()
+	if flushErr != nil {
+		return flushErr
+	}
+	return err
+}
+
+func (w *batchWriter) expire() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	err := w.flush()
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+}
+
+func (w *batchWriter) close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	err := w.flush()
+	if err == nil {
+		err = w.err
+	}
+	w.logStats()
+	return err
+}
+
+func (w *batchWriter) flush() error {
+	w.timer.Stop()
+	if w.count == 0 {
+		return nil
+	}
+	pending := w.buffers[:w.count]
+	w.count = 0
+	w.messageCount += uint64(len(pending))
+
+	if w.gso {
+		segmented := w.segmented(pending)
+		sent, err := w.send(segmented)
+		if err == nil || !isOffloadError(err) {
+			return err
+		}
+		logs.Logger.Warning("Segmentation offload failed, sending datagrams individually, %s", err.Error())
+		w.gso = false
+
+		for _, message := range segmented[:sent] {
+			pending = pending[len(message.Buffers):]
+		}
+	}
+
+	w.messages = w.messages[:0]
+	for _, buffer := range pending {
+		w.messages = append(w.messages, ipv4.Message{
+			Buffers: [][]byte{buffer},
+			Addr:    w.addr,
+		})
+	}
+	_, err := w.send(w.messages)
+	return err
+}
+
+// segmented groups runs of same sized messages into single GSO sends within
+// the kernel's limits on segment count and total size.
+func (w *batchWriter) segmented(pending [][]byte) []ipv4.Message {
+	w.messages = w.messages[:0]
+	for start := 0; start < len(pending); {
+		size := len(pending[start])
+		end := start + 1
+		total := size
+		for end < len(pending) && end-start < maxSegments &&
+			len(pending[end]) == size && total+size <= maxPayload {
+			total += size
+			end++
+		}
+
+		message := ipv4.Message{
+			Buffers: pending[start:end],
+			Addr:    w.addr,
+		}
+		if end-start > 1 && size > 0 {
+			message.OOB = segmentControl(size)
+		}
+		w.messages = append(w.messages, message)
+		start = end
+	}
+	return w.messages
+}
+
+// send returns the count of messages sent, which is less than all of them
+// only when there is an error.
+func (w *batchWriter) send(messages []ipv4.Message) (int, error) {
+	sent := 0
+	for sent < len(messages) {
+		count, err := w.packetConn.WriteBatch(messages[sent:], 0)
+		w.callCount++
+		sent += count
+		if err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
+
+func (w *batchWriter) ioPath() string {
+	path := fmt.Sprintf("%s, batches of %d", writeBatchCall, len(w.buffers))
+	if w.gso {
+		path += " with segmentation offload (GSO)"
+	}
+	return path
+}
+
+func (w *batchWriter) logStats() {
+	if w.callCount == 0 {
+		return
+	}
+	logs.Logger.Info("UDP writer I/O: %d messages in %d %s calls (%.1f per call)",
+		w.messageCount, w.callCount, writeBatchCall, float64(w.messageCount)/float64(w.callCount))
+}
+
+type segment struct {
+	data []byte
+	addr *net.UDPAddr
+}
+
+// batchReader receives as many datagrams as are waiting, up to the batch size,
+// with one system call and returns them one at a time. With receive offload,
+// the kernel may coalesce several datagrams into one buffer which is split
+// back into messages.
+type batchReader struct {
+	packetConn *ipv4.PacketConn
+	gro        bool
+	messages   []ipv4.Message
+	pending    []segment
+	next       int
+
+	messageCount uint64
+	callCount    uint64
+}
+
+func newBatchReader(connection *net.UDPConn, batchSize int, offload bool) *batchReader {
+	r := &batchReader{
+		packetConn: ipv4.NewPacketConn(connection),
+		gro:        offload && enableGRO(connection),
+		messages:   make([]ipv4.Message, batchSize),
+	}
+	for i := range r.messages {
+		r.messages[i].Buffers = [][]byte{make([]byte, maxDatagramSize)}
+		if r.gro {
+			r.messages[i].OOB = make([]byte, controlSize)
+		}
+	}
+
+	logs.Logger.Info("UDP reader I/O path: %s", r.ioPath())
+	return r
+}
+
+func (r *batchReader) read(message []byte) (int, *net.UDPAddr, error) {
+	if r.next == len(r.pending) {
+		err := r.receive()
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	s := r.pending[r.next]
+	r.next++
+	return copy(message, s.data), s.addr, nil
+}
+
+func (r *batchReader) receive() error {
+	count, err := r.packetConn.ReadBatch(r.messages, 0)
+	if err != nil {
+		return err
+	}
+	r.callCount++
+
+	r.pending = r.pending[:0]
+	r.next = 0
+	for _, m := range r.messages[:count] {
+		data := m.Buffers[0][:m.N]
+		addr, _ := m.Addr.(*net.UDPAddr)
+
+		size := 0
+		if r.gro {
+			size = segmentSize(m.OOB[:m.NN])
+		}
+		if size <= 0 {
+			size = len(data)
+		}
+		for len(data) > size {
+			r.pending = append(r.pending, segment{data: data[:size], addr: addr})
+			data = data[size:]
+		}
+		r.pending = append(r.pending, segment{data: data, addr: addr})
+	}
+	r.messageCount += uint64(len(r.pending))
+
+	return nil
+}
+
+func (r *batchReader) ioPath() string {
+	path := fmt.Sprintf("%s, batches of %d", readBatchCall, len(r.messages))
+	if r.gro {
+		path += " with receive offload (GRO)"
+	}
+	return path
+}
+
+func (r *batchReader) logStats() {
+	if r.callCount == 0 {
+		return
+	}
+	logs.Logger.Info("UDP reader I/O: %d messages in %d %s calls (%.1f per call)",
+		r.messageCount, r.callCount, readBatchCall, float64(r.messageCount)/float64(r.callCount))
+}
@@ -0,0 +1,151 @@
+package udp_test
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/adapters/udp"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Batching", func() {
+	var (
+		port   int
+		config jsonstruct.JSONStruct
+		reader *udp.Reader
+		writer *udp.Writer
+	)
+
+	BeforeEach(func() {
+		if port == 0 {
+			port = 51130
+		}
+		port++
+
+		config = jsonstruct.New()
+		config.SetInt(udp.Port, port)
+		config.SetInt(udp.BatchSize, 8)
+		reader = nil
+		writer = nil
+	})
+
+	AfterEach(func() {
+		if reader != nil {
+			reader.Close()
+		}
+	})
+
+	initBoth := func() {
+		reader = &udp.Reader{}
+		err := reader.Init(config)
+		Expect(err).NotTo(HaveOccurred())
+
+		writer = &udp.Writer{}
+		err = writer.Init(config)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	// Writes runs of equal sized messages, so that they can be segmented,
+	// followed by a partial batch of mixed sizes.
+	writeAndRead := func() {
+		var messagesSent [][]byte
+		for i := 0; i < 20; i++ {
+			messagesSent = append(messagesSent, bytes.Repeat([]byte{byte(i)}, 100))
+		}
+		for i := 0; i < 5; i++ {
+			messagesSent = append(messagesSent, []byte(fmt.Sprintf("mixed %s", bytes.Repeat([]byte("x"), i*7))))
+		}
+
+		for _, message := range messagesSent {
+			count, err := writer.Write(message)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(count).To(Equal(len(message)))
+		}
+		Expect(writer.Close()).To(Succeed())
+
+		messageRead := make([]byte, 1024)
+		for _, message := range messagesSent {
+			count, err := reader.Read(messageRead)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(messageRead[:count]).To(Equal(message))
+		}
+	}
+
+	It("sends and receives messages intact in batches", func() {
+		config.SetString(udp.SegmentationOffload, "false")
+		initBoth()
+
+		writeAndRead()
+	})
+
+	It("sends and receives messages intact with segmentation offload", func() {
+		initBoth()
+
+		writeAndRead()
+	})
+
+	It("replies to the writer", func() {
+		initBoth()
+		defer writer.Close()
+
+		_, err := writer.Write([]byte("ping"))
+		Expect(err).NotTo(HaveOccurred())
+
+		go func() {
+			defer GinkgoRecover()
+			messageRead := make([]byte, 1024)
+			count, err := reader.Read(messageRead)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(messageRead[:count]).To(Equal([]byte("ping")))
+
+			_, err = reader.Write([]byte("pong"))
+			Expect(err).NotTo(HaveOccurred())
+		}()
+
+		messageRead := make([]byte, 1024)
+		count, err := writer.Read(messageRead)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(messageRead[:count]).To(Equal([]byte("pong")))
+	})
+
+	It("sends a partial batch after the batch delay", func() {
+		config.SetString(udp.BatchDelay, "10ms")
+		initBoth()
+		defer writer.Close()
+
+		_, err := writer.Write([]byte("partial"))
+		Expect(err).NotTo(HaveOccurred())
+
+		messageRead := make([]byte, 1024)
+		count, err := reader.Read(messageRead)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(messageRead[:count]).To(Equal([]byte("partial")))
+	})
+
+	It("returns an error sending a partial batch from the next write", func() {
+		config.SetString(udp.SegmentationOffload, "false")
+		initBoth()
+		defer writer.Close()
+		reader.Close()
+		reader = nil
+
+		_, err := writer.Write([]byte("refused"))
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(func() error {
+			_, err := writer.Write([]byte("refused"))
+			return err
+		}).Should(HaveOccurred())
+	})
+
+	It("rejects a batch size less than one", func() {
+		config.SetInt(udp.BatchSize, 0)
+
+		writer := udp.Writer{}
+		err := writer.Init(config)
+		Expect(err).To(MatchError("Batch size must be at least 1, 0"))
+	})
+})
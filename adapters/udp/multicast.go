@@ -0,0 +1,73 @@
+package udp
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/utils"
+	"golang.org/x/net/ipv4"
+)
+
+type multicast struct {
+	group     net.IP
+	ifi       *net.Interface
+	ttl       int
+	loopback  bool
+	isEnabled bool
+}
+
+func newMulticast(config jsonstruct.JSONStruct) (multicast, error) {
+	m := multicast{}
+
+	group := config.StringWithDefault(MulticastGroup, DefaultMulticastGroup)
+	if group == "" {
+		return m, nil
+	}
+	m.group = net.ParseIP(group)
+	if m.group == nil || m.group.To4() == nil || !m.group.IsMulticast() {
+		return multicast{}, fmt.Errorf("Invalid IPv4 multicast group, %s", group)
+	}
+	m.isEnabled = true
+
+	name := config.StringWithDefault(MulticastInterface, DefaultMulticastInterface)
+	if name != "" {
+		var err error
+		m.ifi, err = net.InterfaceByName(name)
+		if err != nil {
+			return multicast{}, err
+		}
+	}
+
+	m.ttl = config.IntWithDefault(MulticastTTL, DefaultMulticastTTL)
+	if m.ttl < 0 || m.ttl > 255 {
+		return multicast{}, fmt.Errorf("Multicast TTL must be between 0 and 255, %d", m.ttl)
+	}
+
+	var err error
+	m.loopback, err = utils.BoolWithDefault(config, MulticastLoopback, DefaultMulticastLoopback)
+	if err != nil {
+		return multicast{}, err
+	}
+
+	return m, nil
+}
+
+// configureWriter sets the options that control where and how far the
+// writer's multicast datagrams go.
+func (m multicast) configureWriter(connection *net.UDPConn) error {
+	packetConn := ipv4.NewPacketConn(connection)
+	if m.ifi != nil {
+		err := packetConn.SetMulticastInterface(m.ifi)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := packetConn.SetMulticastTTL(m.ttl)
+	if err != nil {
+		return err
+	}
+
+	return packetConn.SetMulticastLoopback(m.loopback)
+}
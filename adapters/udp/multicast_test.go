@@ -0,0 +1,98 @@
+package udp_test
+
+import (
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/adapters/udp"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Multicast", func() {
+	var (
+		port   int
+		config jsonstruct.JSONStruct
+	)
+
+	BeforeEach(func() {
+		if port == 0 {
+			port = 51110
+		}
+		port++
+
+		config = jsonstruct.New()
+		config.SetInt(udp.Port, port)
+		config.SetString(udp.MulticastGroup, "239.255.42.99")
+	})
+
+	It("delivers every message to every reader that joined the group", func() {
+		readers := make([]*udp.Reader, 3)
+		for i := range readers {
+			readers[i] = &udp.Reader{}
+			err := readers[i].Init(config)
+			Expect(err).NotTo(HaveOccurred())
+			defer readers[i].Close()
+		}
+
+		writer := udp.Writer{}
+		err := writer.Init(config)
+		Expect(err).NotTo(HaveOccurred())
+		defer writer.Close()
+
+		messageSent := []byte("quote")
+		count, err := writer.Write(messageSent)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(count).To(Equal(len(messageSent)))
+
+		for _, reader := range readers {
+			messageRead := make([]byte, 1024)
+			count, err := reader.Read(messageRead)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(messageRead[:count]).To(Equal(messageSent))
+		}
+	})
+
+	It("replies to the writer with unicast", func() {
+		reader := udp.Reader{}
+		err := reader.Init(config)
+		Expect(err).NotTo(HaveOccurred())
+		defer reader.Close()
+
+		writer := udp.Writer{}
+		err = writer.Init(config)
+		Expect(err).NotTo(HaveOccurred())
+		defer writer.Close()
+
+		_, err = writer.Write([]byte("ping"))
+		Expect(err).NotTo(HaveOccurred())
+
+		messageRead := make([]byte, 1024)
+		_, err = reader.Read(messageRead)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = reader.Write([]byte("pong"))
+		Expect(err).NotTo(HaveOccurred())
+
+		count, err := writer.Read(messageRead)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(messageRead[:count]).To(Equal([]byte("pong")))
+	})
+
+	It("rejects addresses that aren't IPv4 multicast groups", func() {
+		for _, group := range []string{"10.0.0.1", "ff02::1", "not-an-address"} {
+			config.SetString(udp.MulticastGroup, group)
+			Expect((&udp.Writer{}).Init(config)).NotTo(Succeed())
+			Expect((&udp.Reader{}).Init(config)).NotTo(Succeed())
+		}
+	})
+
+	It("rejects unknown interfaces", func() {
+		config.SetString(udp.MulticastInterface, "no-such-interface0")
+		Expect((&udp.Writer{}).Init(config)).NotTo(Succeed())
+	})
+
+	It("rejects TTLs out of range", func() {
+		config.SetInt(udp.MulticastTTL, 256)
+		Expect((&udp.Writer{}).Init(config)).NotTo(Succeed())
+	})
+})
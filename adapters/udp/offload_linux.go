@@ -0,0 +1,85 @@
+package udp
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	writeBatchCall = "sendmmsg"
+	readBatchCall  = "recvmmsg"
+
+	// maxSegments is the kernel's limit on datagrams per GSO send
+	maxSegments = 64
+)
+
+var controlSize = unix.CmsgSpace(4)
+
+// supportsGSO reports whether the kernel accepts the UDP_SEGMENT option,
+// which it does from Linux 4.18.
+func supportsGSO(connection *net.UDPConn) bool {
+	supported := false
+	control(connection, func(fd int) {
+		_, err := unix.GetsockoptInt(fd, unix.IPPROTO_UDP, unix.UDP_SEGMENT)
+		supported = err == nil
+	})
+	return supported
+}
+
+// enableGRO asks the kernel to coalesce received datagrams, which it supports
+// from Linux 5.0.
+func enableGRO(connection *net.UDPConn) bool {
+	enabled := false
+	control(connection, func(fd int) {
+		enabled = unix.SetsockoptInt(fd, unix.IPPROTO_UDP, unix.UDP_GRO, 1) == nil
+	})
+	return enabled
+}
+
+// isOffloadError reports whether a failed send was rejected for its
+// segmentation, such as by a device without checksum offload, rather than for
+// its destination.
+func isOffloadError(err error) bool {
+	return errors.Is(err, unix.EIO) || errors.Is(err, unix.EINVAL) || errors.Is(err, unix.EOPNOTSUPP)
+}
+
+// segmentControl returns the control message telling the kernel to split a
+// send into datagrams of size bytes.
+func segmentControl(size int) []byte {
+	control := make([]byte, unix.CmsgSpace(2))
+	header := (*unix.Cmsghdr)(unsafe.Pointer(&control[0]))
+	header.Level = unix.IPPROTO_UDP
+	header.Type = unix.UDP_SEGMENT
+	header.SetLen(unix.CmsgLen(2))
+	binary.NativeEndian.PutUint16(control[unix.CmsgLen(0):], uint16(size))
+	return control
+}
+
+// segmentSize returns the size of the datagrams coalesced into a received
+// buffer, or zero when the buffer holds a single datagram.
+func segmentSize(control []byte) int {
+	messages, err := unix.ParseSocketControlMessage(control)
+	if err != nil {
+		return 0
+	}
+	for _, message := range messages {
+		if message.Header.Level == unix.IPPROTO_UDP && message.Header.Type == unix.UDP_GRO && len(message.Data) >= 4 {
+			return int(binary.NativeEndian.Uint32(message.Data))
+		}
+	}
+	return 0
+}
+
+func control(connection *net.UDPConn, f func(fd int)) {
+	rawConn, err := connection.SyscallConn()
+	if err != nil {
+		return
+	}
+	rawConn.Control(func(fd uintptr) {
+		f(int(fd))
+	})
+}
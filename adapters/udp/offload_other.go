@@ -0,0 +1,36 @@
+//go:build !linux
+
+package udp
+
+import "net"
+
+const (
+	writeBatchCall = "write"
+	readBatchCall  = "read"
+
+	maxSegments = 1
+)
+
+var controlSize = 0
+
+// Segmentation and receive offload are only supported on Linux. Batches are
+// still collected but each message takes its own system call.
+func supportsGSO(connection *net.UDPConn) bool {
+	return false
+}
+
+func enableGRO(connection *net.UDPConn) bool {
+	return false
+}
+
+func isOffloadError(err error) bool {
+	return false
+}
+
+func segmentControl(size int) []byte {
+	return nil
+}
+
+func segmentSize(control []byte) int {
+	return 0
+}
@@ -1,42 +1,132 @@
 package udp
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 
 	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/adapters/internal/sockopt"
+	"github.com/myshkin5/netspel/factory"
+	"github.com/myshkin5/netspel/logs"
 )
 
+func init() {
+	factory.RegisterReader(factory.Descriptor{
+		Name:        "udp",
+		Description: "Reads messages from User Datagram Protocol datagrams.",
+		Config:      configKeys,
+	}, func() factory.Reader {
+		return &Reader{}
+	})
+}
+
 type Reader struct {
 	connection *net.UDPConn
+	remoteAddr *net.UDPAddr
+
+	// batch is set when messages are received in batches rather than one at a
+	// time
+	batch *batchReader
+
+	drops *dropStats
 }
 
+// Init listens on the port or, when a multicast group is configured, joins the
+// group. Several readers on the same host can join a group on the same port
+// and each receives every message.
 func (r *Reader) Init(config jsonstruct.JSONStruct) error {
-	port := config.IntWithDefault(Port, DefaultPort)
-	laddr, err := net.ResolveUDPAddr("udp4", fmt.Sprintf(":%d", port))
+	multicast, err := newMulticast(config)
 	if err != nil {
 		return err
 	}
 
-	r.connection, err = net.ListenUDP("udp4", laddr)
+	batchSize, offload, err := batchConfig(config)
 	if err != nil {
 		return err
 	}
 
+	options, err := sockopt.New(config)
+	if err != nil {
+		return err
+	}
+
+	port := config.IntWithDefault(Port, DefaultPort)
+	if multicast.isEnabled {
+		r.connection, err = net.ListenMulticastUDP("udp4", multicast.ifi, &net.UDPAddr{IP: multicast.group, Port: port})
+		if err != nil {
+			return err
+		}
+
+		err = options.Apply(r.connection)
+		if err != nil {
+			r.connection.Close()
+			return err
+		}
+	} else {
+		connection, err := options.ListenConfig().ListenPacket(context.Background(), "udp4", fmt.Sprintf(":%d", port))
+		if err != nil {
+			return err
+		}
+		r.connection = connection.(*net.UDPConn)
+	}
+	sockopt.Log("UDP reader", r.connection)
+	r.drops = newDropStats(r.connection)
+
+	if batchSize == 1 {
+		logs.Logger.Info("UDP reader I/O path: one read per message")
+		return nil
+	}
+	r.batch = newBatchReader(r.connection, batchSize, offload)
+
 	return nil
 }
 
 func (r *Reader) Read(message []byte) (int, error) {
-	count, err := r.connection.Read(message)
-	opErr, ok := err.(*net.OpError)
-	if err != nil && ok && opErr.Err.Error() == "use of closed network connection" {
+	var count int
+	var remoteAddr *net.UDPAddr
+	var err error
+	if r.batch != nil {
+		count, remoteAddr, err = r.batch.read(message)
+	} else {
+		count, remoteAddr, err = r.connection.ReadFromUDP(message)
+	}
+	if isClosed(err) {
+		if r.batch != nil {
+			r.batch.logStats()
+		}
 		return 0, io.EOF
 	}
+	if remoteAddr != nil {
+		r.remoteAddr = remoteAddr
+	}
 
 	return count, err
 }
 
+// Write replies to the writer of the most recently read message.
+func (r *Reader) Write(message []byte) (int, error) {
+	if r.remoteAddr == nil {
+		return 0, errors.New("No message has been read, nowhere to reply to")
+	}
+
+	return r.connection.WriteToUDP(message, r.remoteAddr)
+}
+
 func (r *Reader) Close() error {
+	r.drops.capture()
 	return r.connection.Close()
 }
+
+// Stats returns the messages dropped by the kernel over the run, both by the
+// reader's socket when its receive buffer overflowed and host wide. The host
+// wide counts include other UDP sockets on the host.
+func (r *Reader) Stats() []factory.Stat {
+	return r.drops.collected()
+}
+
+func isClosed(err error) bool {
+	return errors.Is(err, net.ErrClosed)
+}
@@ -89,4 +89,41 @@ var _ = Describe("Reader", func() {
 
 		Eventually(done).Should(BeClosed())
 	})
+
+	It("replies to the writer of the last message read", func() {
+		raddr, err := net.ResolveUDPAddr("udp4", fmt.Sprintf("localhost:%d", port))
+		Expect(err).NotTo(HaveOccurred())
+
+		connection, err := net.DialUDP("udp4", nil, raddr)
+		Expect(err).NotTo(HaveOccurred())
+		defer connection.Close()
+
+		_, err = connection.Write([]byte("ping"))
+		Expect(err).NotTo(HaveOccurred())
+
+		messageRead := make([]byte, 1024)
+		bytesRead, err := reader.Read(messageRead)
+		Expect(err).NotTo(HaveOccurred())
+
+		bytesWritten, err := reader.Write(messageRead[:bytesRead])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bytesWritten).To(Equal(4))
+
+		reply := make([]byte, 1024)
+		connection.SetReadDeadline(time.Now().Add(time.Second))
+		bytesRead, err = connection.Read(reply)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reply[:bytesRead]).To(Equal([]byte("ping")))
+
+		err = reader.Close()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("returns an error when replying before reading", func() {
+		_, err := reader.Write([]byte("pong"))
+		Expect(err).To(HaveOccurred())
+
+		err = reader.Close()
+		Expect(err).NotTo(HaveOccurred())
+	})
 })
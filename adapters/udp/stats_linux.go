@@ -0,0 +1,158 @@
+package udp
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/myshkin5/netspel/factory"
+	"github.com/myshkin5/netspel/logs"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	procNetUDP  = "/proc/net/udp"
+	procNetSNMP = "/proc/net/snmp"
+)
+
+// hostCounters are the host wide UDP counters from /proc/net/snmp that count
+// datagrams dropped on receive
+var hostCounters = []string{"InErrors", "RcvbufErrors", "NoPorts", "InCsumErrors"}
+
+// dropStats captures the socket's drop counter and the host wide UDP error
+// counters so loss in the network can be told apart from receive buffer
+// overflow on the reader's host.
+type dropStats struct {
+	inode    uint64
+	before   map[string]uint64
+	stats    []factory.Stat
+	captured bool
+}
+
+func newDropStats(connection *net.UDPConn) *dropStats {
+	d := &dropStats{}
+
+	rawConn, err := connection.SyscallConn()
+	if err == nil {
+		rawConn.Control(func(fd uintptr) {
+			var stat unix.Stat_t
+			err = unix.Fstat(int(fd), &stat)
+			d.inode = stat.Ino
+		})
+	}
+	if err != nil {
+		logs.Logger.Warning("Unable to find the UDP socket's inode, %s", err.Error())
+	}
+
+	d.before, err = readHostCounters()
+	if err != nil {
+		logs.Logger.Warning("Unable to read host UDP counters, %s", err.Error())
+	}
+
+	return d
+}
+
+// capture must be called before the socket is closed as its drop counter is
+// only listed while it is open.
+func (d *dropStats) capture() {
+	if d.captured {
+		return
+	}
+	d.captured = true
+
+	if d.inode != 0 {
+		drops, err := readSocketDrops(d.inode)
+		if err != nil {
+			logs.Logger.Warning("Unable to read UDP socket drops, %s", err.Error())
+		} else {
+			d.stats = append(d.stats, factory.Stat{Name: "socket drops", Value: drops})
+		}
+	}
+
+	if d.before == nil {
+		return
+	}
+	after, err := readHostCounters()
+	if err != nil {
+		logs.Logger.Warning("Unable to read host UDP counters, %s", err.Error())
+		return
+	}
+	for _, name := range hostCounters {
+		before, ok := d.before[name]
+		if !ok {
+			continue
+		}
+		d.stats = append(d.stats, factory.Stat{Name: "host " + name, Value: after[name] - before})
+	}
+}
+
+func (d *dropStats) collected() []factory.Stat {
+	return d.stats
+}
+
+// readSocketDrops finds the socket by inode in /proc/net/udp and returns its
+// drops column, the last on each line.
+func readSocketDrops(inode uint64) (uint64, error) {
+	file, err := os.Open(procNetUDP)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 13 || fields[9] != strconv.FormatUint(inode, 10) {
+			continue
+		}
+		return strconv.ParseUint(fields[len(fields)-1], 10, 64)
+	}
+	if scanner.Err() != nil {
+		return 0, scanner.Err()
+	}
+
+	return 0, fmt.Errorf("Socket not found in %s, inode %d", procNetUDP, inode)
+}
+
+// readHostCounters reads the Udp lines of /proc/net/snmp, a header line of
+// counter names followed by a line of their values.
+func readHostCounters() (map[string]uint64, error) {
+	file, err := os.Open(procNetSNMP)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var names []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || fields[0] != "Udp:" {
+			continue
+		}
+		if names == nil {
+			names = fields[1:]
+			continue
+		}
+
+		counters := map[string]uint64{}
+		for i, value := range fields[1:] {
+			if i >= len(names) {
+				break
+			}
+			counters[names[i]], err = strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return counters, nil
+	}
+	if scanner.Err() != nil {
+		return nil, scanner.Err()
+	}
+
+	return nil, fmt.Errorf("No Udp counters in %s", procNetSNMP)
+}
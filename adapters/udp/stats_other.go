@@ -0,0 +1,23 @@
+//go:build !linux
+
+package udp
+
+import (
+	"net"
+
+	"github.com/myshkin5/netspel/factory"
+)
+
+// Drop stats are read from /proc and are only collected on Linux.
+type dropStats struct{}
+
+func newDropStats(connection *net.UDPConn) *dropStats {
+	return &dropStats{}
+}
+
+func (d *dropStats) capture() {
+}
+
+func (d *dropStats) collected() []factory.Stat {
+	return nil
+}
@@ -0,0 +1,56 @@
+package udp_test
+
+import (
+	"runtime"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/adapters/internal/sockopt"
+	"github.com/myshkin5/netspel/adapters/udp"
+	"github.com/myshkin5/netspel/factory"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Stats", func() {
+	BeforeEach(func() {
+		if runtime.GOOS != "linux" {
+			Skip("Drop stats are only collected on Linux")
+		}
+	})
+
+	It("counts datagrams dropped when the receive buffer overflows", func() {
+		config := jsonstruct.New()
+		config.SetInt(udp.Port, 51150)
+		config.SetInt(sockopt.ReceiveBuffer, 4096)
+
+		reader := &udp.Reader{}
+		err := reader.Init(config)
+		Expect(err).NotTo(HaveOccurred())
+
+		writer := udp.Writer{}
+		err = writer.Init(config)
+		Expect(err).NotTo(HaveOccurred())
+		defer writer.Close()
+
+		message := make([]byte, 1000)
+		for i := 0; i < 100; i++ {
+			_, err = writer.Write(message)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		Expect(reader.Close()).To(Succeed())
+
+		var collector factory.StatsCollector = reader
+		stats := collector.Stats()
+		Expect(stats).NotTo(BeEmpty())
+		Expect(stats[0].Name).To(Equal("socket drops"))
+		Expect(stats[0].Value).To(BeNumerically(">", 0))
+
+		names := []string{}
+		for _, stat := range stats[1:] {
+			names = append(names, stat.Name)
+		}
+		Expect(names).To(ContainElement("host RcvbufErrors"))
+	})
+})
@@ -1,46 +1,213 @@
 package udp
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"net"
 	"strconv"
+	"time"
 
 	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/adapters/internal/sockopt"
+	"github.com/myshkin5/netspel/factory"
+	"github.com/myshkin5/netspel/logs"
+	"github.com/myshkin5/netspel/utils"
 )
 
 const (
 	prefix = ".udp."
 
-	Port             = prefix + "port"
-	RemoteReaderAddr = prefix + "remote-reader-addr"
+	Port                = prefix + "port"
+	RemoteReaderAddr    = prefix + "remote-reader-addr"
+	MulticastGroup      = prefix + "multicast-group"
+	MulticastInterface  = prefix + "multicast-interface"
+	MulticastTTL        = prefix + "multicast-ttl"
+	MulticastLoopback   = prefix + "multicast-loopback"
+	BatchSize           = prefix + "batch-size"
+	BatchDelay          = prefix + "batch-delay"
+	SegmentationOffload = prefix + "segmentation-offload"
 
-	DefaultPort             = 57955
-	DefaultRemoteReaderAddr = "localhost"
+	DefaultPort                = 57955
+	DefaultRemoteReaderAddr    = "localhost"
+	DefaultMulticastGroup      = ""
+	DefaultMulticastInterface  = ""
+	DefaultMulticastTTL        = 1
+	DefaultMulticastLoopback   = true
+	DefaultBatchSize           = 1
+	DefaultBatchDelay          = time.Millisecond
+	DefaultSegmentationOffload = true
 )
 
+// configKeys are read by both the writer and the reader.
+var configKeys = append([]factory.ConfigKey{
+	{Path: Port, Type: factory.IntType, Default: fmt.Sprint(DefaultPort), Range: factory.Between(0, 65535),
+		Doc: "The port on which the remote reader process listens."},
+	{Path: RemoteReaderAddr, Type: factory.StringType, Default: DefaultRemoteReaderAddr,
+		Doc: "The IP address of the remote reader process. Used by the writer only and ignored when a multicast group is set."},
+	{Path: MulticastGroup, Type: factory.StringType,
+		Doc: "An IPv4 multicast group address the writer writes to and the reader joins."},
+	{Path: MulticastInterface, Type: factory.StringType,
+		Doc: "The name of the network interface used to send to and join the group."},
+	{Path: MulticastTTL, Type: factory.IntType, Default: fmt.Sprint(DefaultMulticastTTL), Range: factory.Between(0, 255),
+		Doc: "The time-to-live of multicast datagrams. Used by the writer only."},
+	{Path: MulticastLoopback, Type: factory.BoolType, Default: fmt.Sprint(DefaultMulticastLoopback),
+		Doc: "Whether multicast datagrams are also delivered to readers on the writer's host. Used by the writer only."},
+	{Path: BatchSize, Type: factory.IntType, Default: fmt.Sprint(DefaultBatchSize), Range: factory.AtLeast(1),
+		Doc: "The maximum count of messages sent or received per system call."},
+	{Path: BatchDelay, Type: factory.DurationType, Default: fmt.Sprint(DefaultBatchDelay), Range: factory.AtLeast(0),
+		Doc: "The longest a message waits in a partial batch before it is sent. Used by the writer only."},
+	{Path: SegmentationOffload, Type: factory.BoolType, Default: fmt.Sprint(DefaultSegmentationOffload),
+		Doc: "Whether batches use segmentation offload when writing and receive offload when reading."},
+}, sockopt.ConfigKeys...)
+
+func init() {
+	factory.RegisterWriter(factory.Descriptor{
+		Name:        "udp",
+		Description: "Writes messages as User Datagram Protocol datagrams.",
+		Config:      configKeys,
+	}, func() factory.Writer {
+		return &Writer{}
+	})
+}
+
 type Writer struct {
 	connection *net.UDPConn
+
+	// groupAddr is set when writing to a multicast group. The socket isn't
+	// connected to the group as a connected socket would discard unicast
+	// replies from readers.
+	groupAddr *net.UDPAddr
+
+	// batch is set when messages are sent in batches rather than one at a time
+	batch *batchWriter
 }
 
+// Init connects to the reader or, when a multicast group is configured, to the
+// group so every reader that joined it receives each message.
 func (w *Writer) Init(config jsonstruct.JSONStruct) error {
+	multicast, err := newMulticast(config)
+	if err != nil {
+		return err
+	}
+
+	batchSize, offload, err := batchConfig(config)
+	if err != nil {
+		return err
+	}
+	batchDelay, err := config.DurationWithDefault(BatchDelay, DefaultBatchDelay)
+	if err != nil {
+		return err
+	}
+	if batchDelay < 0 {
+		return fmt.Errorf("Batch delay must not be negative, %s", batchDelay)
+	}
+
+	options, err := sockopt.New(config)
+	if err != nil {
+		return err
+	}
+
 	port := config.IntWithDefault(Port, DefaultPort)
 	remoteAddr := config.StringWithDefault(RemoteReaderAddr, DefaultRemoteReaderAddr)
+	if multicast.isEnabled {
+		remoteAddr = multicast.group.String()
+	}
 	raddr, err := net.ResolveUDPAddr("udp4", net.JoinHostPort(remoteAddr, strconv.Itoa(port)))
 	if err != nil {
 		return err
 	}
 
-	w.connection, err = net.DialUDP("udp4", nil, raddr)
-	if err != nil {
-		return err
+	if !multicast.isEnabled {
+		connection, err := options.Dialer().Dial("udp4", raddr.String())
+		if err != nil {
+			return err
+		}
+		w.connection = connection.(*net.UDPConn)
+	} else {
+		connection, err := options.ListenConfig().ListenPacket(context.Background(), "udp4", ":0")
+		if err != nil {
+			return err
+		}
+		w.connection = connection.(*net.UDPConn)
+		w.groupAddr = raddr
+
+		err = multicast.configureWriter(w.connection)
+		if err != nil {
+			w.connection.Close()
+			return err
+		}
+	}
+
+	sockopt.Log("UDP writer", w.connection)
+
+	if batchSize == 1 {
+		logs.Logger.Info("UDP writer I/O path: one write per message")
+		return nil
+	}
+
+	// A connected socket rejects datagrams addressed explicitly
+	var addr net.Addr
+	if w.groupAddr != nil {
+		addr = w.groupAddr
 	}
+	w.batch = newBatchWriter(w.connection, addr, batchSize, offload, batchDelay)
 
 	return nil
 }
 
+// Write sends a message or, when batching, adds it to the current batch. A
+// partial batch is sent after the batch delay, before reading a reply or when
+// the writer is closed.
 func (w *Writer) Write(message []byte) (int, error) {
+	if w.batch != nil {
+		return w.batch.write(message)
+	}
+	if w.groupAddr != nil {
+		return w.connection.WriteToUDP(message, w.groupAddr)
+	}
 	return w.connection.Write(message)
 }
 
+// Read returns replies sent back by the reader.
+func (w *Writer) Read(message []byte) (int, error) {
+	if w.batch != nil {
+		err := w.batch.sendPending()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	count, err := w.connection.Read(message)
+	if isClosed(err) {
+		return 0, io.EOF
+	}
+
+	return count, err
+}
+
 func (w *Writer) Close() error {
+	if w.batch != nil {
+		err := w.batch.close()
+		if err != nil {
+			w.connection.Close()
+			return err
+		}
+	}
+
 	return w.connection.Close()
 }
+
+func batchConfig(config jsonstruct.JSONStruct) (int, bool, error) {
+	batchSize := config.IntWithDefault(BatchSize, DefaultBatchSize)
+	if batchSize < 1 {
+		return 0, false, fmt.Errorf("Batch size must be at least 1, %d", batchSize)
+	}
+
+	offload, err := utils.BoolWithDefault(config, SegmentationOffload, DefaultSegmentationOffload)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return batchSize, offload, nil
+}
@@ -2,6 +2,7 @@ package udp_test
 
 import (
 	"fmt"
+	"io"
 	"net"
 
 	"github.com/myshkin5/jsonstruct"
@@ -48,4 +49,43 @@ var _ = Describe("Writer", func() {
 		Eventually(messages).Should(Receive(&messageRead))
 		Expect(messageRead).To(Equal(messageSent))
 	})
+
+	It("reads replies from the reader", func() {
+		laddr, err := net.ResolveUDPAddr("udp4", fmt.Sprintf(":%d", 51042))
+		Expect(err).NotTo(HaveOccurred())
+
+		connection, err := net.ListenUDP("udp4", laddr)
+		Expect(err).NotTo(HaveOccurred())
+		defer connection.Close()
+
+		go func() {
+			messageRead := make([]byte, 1024)
+			bytesRead, remoteAddr, err := connection.ReadFromUDP(messageRead)
+			if err != nil {
+				return
+			}
+			connection.WriteToUDP(messageRead[:bytesRead], remoteAddr)
+		}()
+
+		config := jsonstruct.New()
+		config.SetInt(udp.Port, 51042)
+
+		writer := udp.Writer{}
+		err = writer.Init(config)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = writer.Write([]byte("ping"))
+		Expect(err).NotTo(HaveOccurred())
+
+		reply := make([]byte, 1024)
+		bytesRead, err := writer.Read(reply)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reply[:bytesRead]).To(Equal([]byte("ping")))
+
+		err = writer.Close()
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = writer.Read(reply)
+		Expect(err).To(Equal(io.EOF))
+	})
 })
@@ -0,0 +1,218 @@
+package unix
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/adapters/internal/framing"
+	"github.com/myshkin5/netspel/adapters/internal/sockopt"
+	"github.com/myshkin5/netspel/factory"
+	"github.com/myshkin5/netspel/logs"
+)
+
+func init() {
+	factory.RegisterReader(factory.Descriptor{
+		Name:        "unix",
+		Description: "Reads messages from a Unix domain socket.",
+		Config:      configKeys,
+	}, func() factory.Reader {
+		return &Reader{}
+	})
+}
+
+type Reader struct {
+	socket *socket
+	sizes  framing.Sizes
+
+	// Stream and seqpacket readers accept one writer at a time
+	listener *net.UnixListener
+
+	mutex      sync.Mutex
+	closed     bool
+	connection *net.UnixConn
+	buffered   *bufio.Reader
+
+	// Datagram readers reply to the writer of the most recently read message
+	remoteAddr *net.UnixAddr
+}
+
+// SetMessageSizes sets the sizes fixed framing matches its records to.
+func (r *Reader) SetMessageSizes(min, max int) {
+	r.sizes = framing.Sizes{Min: min, Max: max}
+}
+
+func (r *Reader) Init(config jsonstruct.JSONStruct) error {
+	var err error
+	r.socket, err = newSocket(config, r.sizes)
+	if err != nil {
+		return err
+	}
+
+	err = removeStale(r.socket.path)
+	if err != nil {
+		return err
+	}
+
+	listenConfig := r.socket.options.ListenConfig()
+	if r.socket.socketType == Datagram {
+		connection, err := listenConfig.ListenPacket(context.Background(), r.socket.network, r.socket.path)
+		if err != nil {
+			return err
+		}
+		r.connection = connection.(*net.UnixConn)
+		sockopt.Log("Unix reader", r.connection)
+		return nil
+	}
+
+	listener, err := listenConfig.Listen(context.Background(), r.socket.network, r.socket.path)
+	if err != nil {
+		return err
+	}
+	r.listener = listener.(*net.UnixListener)
+	// The path is removed explicitly by Close for every socket type
+	r.listener.SetUnlinkOnClose(false)
+
+	return nil
+}
+
+// Read returns one message. When a writer disconnects from a stream or
+// seqpacket socket, Read waits for the next writer to connect and only returns
+// io.EOF once the reader is closed.
+func (r *Reader) Read(message []byte) (int, error) {
+	if r.socket.socketType == Datagram {
+		return r.readDatagram(message)
+	}
+
+	for {
+		if r.buffered == nil {
+			err := r.accept()
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		count, err := r.socket.read(r.connection, r.buffered, message)
+		if err == nil || err == io.ErrShortBuffer {
+			return count, err
+		}
+
+		if r.isClosed() {
+			return 0, io.EOF
+		}
+
+		r.dropConnection()
+		if err != io.EOF {
+			return 0, err
+		}
+	}
+}
+
+// Write replies to the currently connected writer or, for datagram sockets,
+// the writer of the most recently read message.
+func (r *Reader) Write(message []byte) (int, error) {
+	if r.socket.socketType == Datagram {
+		if r.remoteAddr == nil {
+			return 0, errors.New("No message has been read, nowhere to reply to")
+		}
+		return r.connection.WriteToUnix(message, r.remoteAddr)
+	}
+
+	r.mutex.Lock()
+	connection := r.connection
+	r.mutex.Unlock()
+
+	if connection == nil {
+		return 0, errors.New("No writer connected, nowhere to reply to")
+	}
+
+	return r.socket.write(connection, message)
+}
+
+// Close closes the socket and removes its path.
+func (r *Reader) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.closed = true
+	var err error
+	if r.listener != nil {
+		if r.connection != nil {
+			r.connection.Close()
+		}
+		err = r.listener.Close()
+	} else {
+		err = r.connection.Close()
+	}
+
+	removeErr := os.Remove(r.socket.path)
+	if err == nil && removeErr != nil && !os.IsNotExist(removeErr) {
+		err = removeErr
+	}
+
+	return err
+}
+
+func (r *Reader) readDatagram(message []byte) (int, error) {
+	count, remoteAddr, err := r.connection.ReadFromUnix(message)
+	if err != nil && r.isClosed() {
+		return 0, io.EOF
+	}
+	// Writers that haven't bound a path can't be replied to
+	if remoteAddr != nil && remoteAddr.Name != "" {
+		r.remoteAddr = remoteAddr
+	}
+
+	return count, err
+}
+
+func (r *Reader) accept() error {
+	connection, err := r.listener.AcceptUnix()
+	if err != nil {
+		if r.isClosed() {
+			return io.EOF
+		}
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		connection.Close()
+		return io.EOF
+	}
+
+	// Accepted sockets don't inherit the listener's buffer sizes
+	err = r.socket.options.Apply(connection)
+	if err != nil {
+		logs.Logger.Warning("Unable to set socket options on accepted connection, %s", err.Error())
+	}
+	sockopt.Log("Unix reader", connection)
+
+	r.connection = connection
+	r.buffered = bufio.NewReaderSize(connection, readBufferSize)
+
+	return nil
+}
+
+func (r *Reader) dropConnection() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.connection.Close()
+	r.connection = nil
+	r.buffered = nil
+}
+
+func (r *Reader) isClosed() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.closed
+}
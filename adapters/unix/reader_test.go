@@ -0,0 +1,197 @@
+package unix_test
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/adapters/internal/framing"
+	"github.com/myshkin5/netspel/adapters/internal/sockopt"
+	"github.com/myshkin5/netspel/adapters/unix"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Reader", func() {
+	var (
+		dir    string
+		path   string
+		config jsonstruct.JSONStruct
+		reader unix.Reader
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "netspel")
+		Expect(err).NotTo(HaveOccurred())
+		path = filepath.Join(dir, "reader.sock")
+
+		config = jsonstruct.New()
+		config.SetString(unix.Path, path)
+
+		reader = unix.Reader{}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	readOne := func() []byte {
+		messageRead := make([]byte, 1024)
+		count, err := reader.Read(messageRead)
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+		return messageRead[:count]
+	}
+
+	It("reads framed messages from a stream socket", func() {
+		config.SetString(unix.Framing, framing.Fixed)
+		config.SetInt(unix.RecordSize, 5)
+		err := reader.Init(config)
+		Expect(err).NotTo(HaveOccurred())
+
+		connection, err := net.Dial("unix", path)
+		Expect(err).NotTo(HaveOccurred())
+		defer connection.Close()
+
+		// Two records in one write must still be read as two messages
+		_, err = connection.Write([]byte("hellothere"))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(readOne()).To(Equal([]byte("hello")))
+		Expect(readOne()).To(Equal([]byte("there")))
+
+		Expect(reader.Close()).To(Succeed())
+	})
+
+	It("reads messages from a seqpacket socket without framing", func() {
+		config.SetString(unix.Type, unix.SeqPacket)
+		err := reader.Init(config)
+		Expect(err).NotTo(HaveOccurred())
+
+		connection, err := net.Dial("unixpacket", path)
+		Expect(err).NotTo(HaveOccurred())
+		defer connection.Close()
+
+		_, err = connection.Write([]byte("hello"))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = connection.Write([]byte("there"))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(readOne()).To(Equal([]byte("hello")))
+		Expect(readOne()).To(Equal([]byte("there")))
+
+		Expect(reader.Close()).To(Succeed())
+	})
+
+	It("reads datagrams with socket buffer sizes set", func() {
+		if runtime.GOOS != "linux" {
+			Skip("Socket options are only supported on Linux")
+		}
+		config.SetString(unix.Type, unix.Datagram)
+		config.SetInt(sockopt.ReceiveBuffer, 65536)
+		config.SetInt(sockopt.DSCP, 46)
+		err := reader.Init(config)
+		Expect(err).NotTo(HaveOccurred())
+
+		writer := unix.Writer{}
+		err = writer.Init(config)
+		Expect(err).NotTo(HaveOccurred())
+		defer writer.Close()
+
+		_, err = writer.Write([]byte("hello"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(readOne()).To(Equal([]byte("hello")))
+
+		Expect(reader.Close()).To(Succeed())
+	})
+
+	It("waits for the next writer when a writer disconnects", func() {
+		config.SetString(unix.Type, unix.SeqPacket)
+		err := reader.Init(config)
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, message := range []string{"first", "second"} {
+			connection, err := net.Dial("unixpacket", path)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = connection.Write([]byte(message))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(readOne()).To(Equal([]byte(message)))
+
+			connection.Close()
+		}
+
+		Expect(reader.Close()).To(Succeed())
+	})
+
+	It("returns from a call to Read() when Close() is called", func() {
+		for _, socketType := range []string{unix.Stream, unix.Datagram, unix.SeqPacket} {
+			config.SetString(unix.Type, socketType)
+			reader = unix.Reader{}
+			err := reader.Init(config)
+			Expect(err).NotTo(HaveOccurred())
+
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				messageRead := make([]byte, 1024)
+				bytesRead, err := reader.Read(messageRead)
+				Expect(err).To(Equal(io.EOF))
+				Expect(bytesRead).To(Equal(0))
+				close(done)
+			}()
+
+			time.Sleep(10 * time.Millisecond)
+
+			err = reader.Close()
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(done).Should(BeClosed())
+		}
+	})
+
+	It("removes the socket path when closed", func() {
+		for _, socketType := range []string{unix.Stream, unix.Datagram, unix.SeqPacket} {
+			config.SetString(unix.Type, socketType)
+			reader = unix.Reader{}
+			err := reader.Init(config)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(path).To(BeAnExistingFile())
+
+			Expect(reader.Close()).To(Succeed())
+			Expect(path).NotTo(BeAnExistingFile())
+		}
+	})
+
+	It("replaces a socket left behind by an earlier run", func() {
+		stale, err := net.Listen("unix", path)
+		Expect(err).NotTo(HaveOccurred())
+		stale.(*net.UnixListener).SetUnlinkOnClose(false)
+		stale.Close()
+		Expect(path).To(BeAnExistingFile())
+
+		err = reader.Init(config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reader.Close()).To(Succeed())
+	})
+
+	It("doesn't remove files that aren't sockets", func() {
+		err := ioutil.WriteFile(path, []byte("important"), 0600)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = reader.Init(config)
+		Expect(err).To(HaveOccurred())
+		Expect(ioutil.ReadFile(path)).To(Equal([]byte("important")))
+	})
+
+	It("rejects unknown socket types", func() {
+		config.SetString(unix.Type, "raw")
+		err := reader.Init(config)
+		Expect(err).To(HaveOccurred())
+	})
+})
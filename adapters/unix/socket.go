@@ -0,0 +1,72 @@
+package unix
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/adapters/internal/framing"
+	"github.com/myshkin5/netspel/adapters/internal/sockopt"
+)
+
+const readBufferSize = 64 * 1024
+
+// socket holds the configuration shared by readers and writers. Stream sockets
+// carry a byte stream and are framed like TCP; seqpacket and datagram sockets
+// preserve message boundaries so messages are sent as is.
+type socket struct {
+	path       string
+	socketType string
+	network    string
+	framer     framing.Framer
+	options    *sockopt.Options
+}
+
+func newSocket(config jsonstruct.JSONStruct, sizes framing.Sizes) (*socket, error) {
+	s := &socket{
+		path:       config.StringWithDefault(Path, DefaultPath),
+		socketType: config.StringWithDefault(Type, DefaultType),
+	}
+
+	switch s.socketType {
+	case Stream:
+		s.network = "unix"
+		var err error
+		s.framer, err = framing.New(
+			config.StringWithDefault(Framing, DefaultFraming),
+			config.IntWithDefault(RecordSize, DefaultRecordSize),
+			sizes)
+		if err != nil {
+			return nil, err
+		}
+	case Datagram:
+		s.network = "unixgram"
+	case SeqPacket:
+		s.network = "unixpacket"
+	default:
+		return nil, fmt.Errorf("Unknown socket type, %s", s.socketType)
+	}
+
+	var err error
+	s.options, err = sockopt.New(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *socket) write(connection *net.UnixConn, message []byte) (int, error) {
+	if s.framer != nil {
+		return s.framer.WriteFrame(connection, message)
+	}
+	return connection.Write(message)
+}
+
+func (s *socket) read(connection *net.UnixConn, buffered *bufio.Reader, message []byte) (int, error) {
+	if s.framer != nil {
+		return s.framer.ReadFrame(buffered, message)
+	}
+	return connection.Read(message)
+}
@@ -0,0 +1,13 @@
+package unix_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestUnix(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Adapters - Unix Suite")
+}
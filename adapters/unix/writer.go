@@ -0,0 +1,168 @@
+package unix
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync/atomic"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/adapters/internal/framing"
+	"github.com/myshkin5/netspel/adapters/internal/sockopt"
+	"github.com/myshkin5/netspel/factory"
+)
+
+const (
+	prefix = ".unix."
+
+	Path       = prefix + "path"
+	Type       = prefix + "type"
+	Framing    = prefix + "framing"
+	RecordSize = prefix + "record-size"
+
+	DefaultPath       = "/tmp/netspel.sock"
+	DefaultType       = Stream
+	DefaultFraming    = framing.LengthPrefixed
+	DefaultRecordSize = 0
+
+	Stream    = "stream"
+	Datagram  = "dgram"
+	SeqPacket = "seqpacket"
+)
+
+// configKeys are read by both the writer and the reader. Of the shared socket
+// options, only the buffer sizes apply to Unix domain sockets.
+var configKeys = append([]factory.ConfigKey{
+	{Path: Path, Type: factory.StringType, Default: DefaultPath,
+		Doc: "The path of the reader's socket."},
+	{Path: Type, Type: factory.StringType, Default: DefaultType, Values: []string{Stream, Datagram, SeqPacket},
+		Doc: "The socket type. Must be the same for the reader and the writer."},
+	{Path: Framing, Type: factory.StringType, Default: DefaultFraming, Values: []string{framing.LengthPrefixed, framing.Newline, framing.Fixed},
+		Doc: "The framing used to delimit messages on stream sockets."},
+	{Path: RecordSize, Type: factory.IntType, Default: fmt.Sprint(DefaultRecordSize), Range: factory.AtLeast(0),
+		Doc: "The count of bytes per record when using fixed framing. When zero, records match the scheme's message size. Every message must be the record size."},
+}, sockopt.ConfigKeys...)
+
+func init() {
+	factory.RegisterWriter(factory.Descriptor{
+		Name:        "unix",
+		Description: "Writes messages on a Unix domain socket.",
+		Config:      configKeys,
+	}, func() factory.Writer {
+		return &Writer{}
+	})
+}
+
+type Writer struct {
+	socket *socket
+	sizes  framing.Sizes
+	closed int32
+
+	// Stream and seqpacket sockets are connected to the reader
+	connection *net.UnixConn
+	buffered   *bufio.Reader
+
+	// Datagram sockets are bound to their own path so the reader can reply
+	remoteAddr *net.UnixAddr
+	localPath  string
+}
+
+// SetMessageSizes sets the sizes fixed framing matches its records to.
+func (w *Writer) SetMessageSizes(min, max int) {
+	w.sizes = framing.Sizes{Min: min, Max: max}
+}
+
+func (w *Writer) Init(config jsonstruct.JSONStruct) error {
+	var err error
+	w.socket, err = newSocket(config, w.sizes)
+	if err != nil {
+		return err
+	}
+
+	w.remoteAddr = &net.UnixAddr{Name: w.socket.path, Net: w.socket.network}
+	if w.socket.socketType == Datagram {
+		w.localPath = fmt.Sprintf("%s.writer.%d", w.socket.path, os.Getpid())
+		err = removeStale(w.localPath)
+		if err != nil {
+			return err
+		}
+		connection, err := w.socket.options.ListenConfig().ListenPacket(context.Background(), w.socket.network, w.localPath)
+		if err != nil {
+			return err
+		}
+		w.connection = connection.(*net.UnixConn)
+		sockopt.Log("Unix writer", w.connection)
+		return nil
+	}
+
+	connection, err := w.socket.options.Dialer().Dial(w.socket.network, w.socket.path)
+	if err != nil {
+		return err
+	}
+	w.connection = connection.(*net.UnixConn)
+	sockopt.Log("Unix writer", w.connection)
+	w.buffered = bufio.NewReaderSize(w.connection, readBufferSize)
+
+	return nil
+}
+
+// Write sends a message to the reader. Unlike UDP, a datagram written while
+// the reader's receive queue is full blocks rather than being dropped, and a
+// datagram written before the reader starts fails.
+func (w *Writer) Write(message []byte) (int, error) {
+	if w.socket.socketType == Datagram {
+		return w.connection.WriteToUnix(message, w.remoteAddr)
+	}
+
+	return w.socket.write(w.connection, message)
+}
+
+// Read returns replies sent back by the reader.
+func (w *Writer) Read(message []byte) (int, error) {
+	var count int
+	var err error
+	if w.socket.socketType == Datagram {
+		count, err = w.connection.Read(message)
+	} else {
+		count, err = w.socket.read(w.connection, w.buffered, message)
+	}
+	if err != nil && atomic.LoadInt32(&w.closed) == 1 {
+		return 0, io.EOF
+	}
+
+	return count, err
+}
+
+func (w *Writer) Close() error {
+	atomic.StoreInt32(&w.closed, 1)
+	err := w.connection.Close()
+	if w.localPath != "" {
+		removeErr := os.Remove(w.localPath)
+		if err == nil && removeErr != nil && !os.IsNotExist(removeErr) {
+			err = removeErr
+		}
+	}
+
+	return err
+}
+
+// removeStale removes a socket left behind by a process that didn't clean up.
+// Anything other than a socket is left alone so a misconfigured path can't
+// delete a regular file.
+func removeStale(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("Path exists and is not a socket, %s", path)
+	}
+
+	return os.Remove(path)
+}
@@ -0,0 +1,100 @@
+package unix_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/adapters/unix"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Writer", func() {
+	var (
+		dir    string
+		config jsonstruct.JSONStruct
+		reader *unix.Reader
+		writer *unix.Writer
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "netspel")
+		Expect(err).NotTo(HaveOccurred())
+
+		config = jsonstruct.New()
+		config.SetString(unix.Path, filepath.Join(dir, "reader.sock"))
+
+		reader = &unix.Reader{}
+		writer = &unix.Writer{}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	roundTrip := func() {
+		err := reader.Init(config)
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+		defer reader.Close()
+		err = writer.Init(config)
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+
+		for _, message := range []string{"hello", "there"} {
+			count, err := writer.Write([]byte(message))
+			ExpectWithOffset(1, err).NotTo(HaveOccurred())
+			ExpectWithOffset(1, count).To(Equal(len(message)))
+
+			messageRead := make([]byte, 1024)
+			count, err = reader.Read(messageRead)
+			ExpectWithOffset(1, err).NotTo(HaveOccurred())
+			ExpectWithOffset(1, string(messageRead[:count])).To(Equal(message))
+		}
+
+		count, err := reader.Write([]byte("pong"))
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+		ExpectWithOffset(1, count).To(Equal(4))
+
+		reply := make([]byte, 1024)
+		count, err = writer.Read(reply)
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+		ExpectWithOffset(1, string(reply[:count])).To(Equal("pong"))
+
+		ExpectWithOffset(1, writer.Close()).To(Succeed())
+	}
+
+	It("sends messages and reads replies over a stream socket by default", func() {
+		roundTrip()
+	})
+
+	It("sends messages and reads replies over a seqpacket socket", func() {
+		config.SetString(unix.Type, unix.SeqPacket)
+		roundTrip()
+	})
+
+	It("sends messages and reads replies over a datagram socket", func() {
+		config.SetString(unix.Type, unix.Datagram)
+		roundTrip()
+	})
+
+	It("removes the path it receives replies on when closed", func() {
+		config.SetString(unix.Type, unix.Datagram)
+		err := writer.Init(config)
+		Expect(err).NotTo(HaveOccurred())
+
+		paths, err := filepath.Glob(filepath.Join(dir, "*"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(paths).To(HaveLen(1))
+
+		Expect(writer.Close()).To(Succeed())
+		Expect(paths[0]).NotTo(BeAnExistingFile())
+	})
+
+	It("fails to connect when no reader is listening", func() {
+		err := writer.Init(config)
+		Expect(err).To(HaveOccurred())
+	})
+})
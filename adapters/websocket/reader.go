@@ -0,0 +1,140 @@
+package websocket
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	gorilla "github.com/gorilla/websocket"
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/adapters/internal/sockopt"
+	"github.com/myshkin5/netspel/factory"
+	"github.com/myshkin5/netspel/utils"
+)
+
+const (
+	prefix = ".websocket."
+
+	Port             = prefix + "port"
+	RemoteWriterAddr = prefix + "remote-writer-addr"
+	FrameType        = prefix + "frame-type"
+	Compression      = prefix + "compression"
+	PingInterval     = prefix + "ping-interval"
+	PongTimeout      = prefix + "pong-timeout"
+
+	DefaultPort             = 38210
+	DefaultRemoteWriterAddr = "localhost"
+	DefaultFrameType        = Binary
+	DefaultCompression      = false
+	DefaultPingInterval     = 0
+	DefaultPongTimeout      = 10 * time.Second
+
+	Binary = "binary"
+	Text   = "text"
+)
+
+// configKeys are read by both the writer and the reader.
+var configKeys = append([]factory.ConfigKey{
+	{Path: Port, Type: factory.IntType, Default: fmt.Sprint(DefaultPort), Range: factory.Between(0, 65535),
+		Doc: "The port on which the remote writer process listens."},
+	{Path: RemoteWriterAddr, Type: factory.StringType, Default: DefaultRemoteWriterAddr,
+		Doc: "The IP address of the remote writer process. Used by the reader only."},
+	{Path: FrameType, Type: factory.StringType, Default: DefaultFrameType, Values: []string{Binary, Text},
+		Doc: "The type of frames messages are written in."},
+	{Path: Compression, Type: factory.BoolType, Default: fmt.Sprint(DefaultCompression),
+		Doc: "Whether frames are compressed with the per-message deflate extension. Both the writer and reader must enable it."},
+	{Path: PingInterval, Type: factory.DurationType, Default: fmt.Sprint(time.Duration(DefaultPingInterval)), Range: factory.AtLeast(0),
+		Doc: "The length of time between pings sent by the writer. When zero, no pings are sent. Used by the writer only."},
+	{Path: PongTimeout, Type: factory.DurationType, Default: fmt.Sprint(DefaultPongTimeout), Range: factory.AtLeast(0),
+		Doc: "How long past the ping interval the writer waits for a reader to answer before disconnecting it. Used by the writer only."},
+}, sockopt.ConfigKeys...)
+
+func init() {
+	factory.RegisterReader(factory.Descriptor{
+		Name:        "websocket",
+		Description: "Reads messages from WebSocket frames sent by the writer.",
+		Config:      configKeys,
+	}, func() factory.Reader {
+		return &Reader{}
+	})
+}
+
+type Reader struct {
+	connection *gorilla.Conn
+	frameType  int
+	closed     int32
+}
+
+func (r *Reader) Init(config jsonstruct.JSONStruct) error {
+	port := config.IntWithDefault(Port, DefaultPort)
+	remoteAddr := config.StringWithDefault(RemoteWriterAddr, DefaultRemoteWriterAddr)
+
+	var err error
+	r.frameType, err = frameType(config)
+	if err != nil {
+		return err
+	}
+	compression, err := utils.BoolWithDefault(config, Compression, DefaultCompression)
+	if err != nil {
+		return err
+	}
+
+	options, err := sockopt.New(config)
+	if err != nil {
+		return err
+	}
+
+	dialer := gorilla.Dialer{
+		NetDialContext:    options.DialContext("WebSocket reader"),
+		EnableCompression: compression,
+	}
+	r.connection, _, err = dialer.Dial(fmt.Sprintf("ws://%s:%d/", remoteAddr, port), nil)
+	if err != nil {
+		return err
+	}
+	r.connection.EnableWriteCompression(compression)
+
+	return nil
+}
+
+// Read returns the next data frame. Pings from the writer are answered while
+// reading.
+func (r *Reader) Read(message []byte) (int, error) {
+	_, data, err := r.connection.ReadMessage()
+	if err != nil {
+		if atomic.LoadInt32(&r.closed) == 1 || gorilla.IsCloseError(err, gorilla.CloseNormalClosure, gorilla.CloseGoingAway) {
+			return 0, io.EOF
+		}
+		return 0, err
+	}
+	return copy(message, data), nil
+}
+
+// Write sends a reply back to the writer.
+func (r *Reader) Write(message []byte) (int, error) {
+	err := r.connection.WriteMessage(r.frameType, message)
+	if err != nil {
+		return 0, err
+	}
+	return len(message), nil
+}
+
+func (r *Reader) Close() error {
+	atomic.StoreInt32(&r.closed, 1)
+	r.connection.WriteControl(gorilla.CloseMessage,
+		gorilla.FormatCloseMessage(gorilla.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	return r.connection.Close()
+}
+
+func frameType(config jsonstruct.JSONStruct) (int, error) {
+	frameType := config.StringWithDefault(FrameType, DefaultFrameType)
+	switch frameType {
+	case Binary:
+		return gorilla.BinaryMessage, nil
+	case Text:
+		return gorilla.TextMessage, nil
+	default:
+		return 0, fmt.Errorf("Unknown frame type, %s", frameType)
+	}
+}
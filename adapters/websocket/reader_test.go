@@ -0,0 +1,197 @@
+package websocket_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	gorilla "github.com/gorilla/websocket"
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/adapters/websocket"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type testWriter struct {
+	upgrader gorilla.Upgrader
+	frames   [][]byte
+	replies  chan []byte
+	pongs    chan string
+	closing  chan struct{}
+}
+
+func (t *testWriter) handle(w http.ResponseWriter, r *http.Request) {
+	defer GinkgoRecover()
+
+	connection, err := t.upgrader.Upgrade(w, r, nil)
+	Expect(err).NotTo(HaveOccurred())
+	defer connection.Close()
+
+	connection.SetPongHandler(func(data string) error {
+		t.pongs <- data
+		return nil
+	})
+	go func() {
+		for {
+			_, reply, err := connection.ReadMessage()
+			if err != nil {
+				return
+			}
+			t.replies <- reply
+		}
+	}()
+
+	err = connection.WriteControl(gorilla.PingMessage, []byte("ping"), time.Now().Add(time.Second))
+	Expect(err).NotTo(HaveOccurred())
+
+	for _, frame := range t.frames {
+		err := connection.WriteMessage(gorilla.BinaryMessage, frame)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	<-t.closing
+	connection.WriteControl(gorilla.CloseMessage,
+		gorilla.FormatCloseMessage(gorilla.CloseNormalClosure, ""), time.Now().Add(time.Second))
+}
+
+var _ = Describe("Reader", func() {
+	var (
+		port   int
+		config jsonstruct.JSONStruct
+		reader websocket.Reader
+	)
+
+	// serve starts a writer for a single test. It is fully set up before
+	// serving so its handler doesn't share state with the test.
+	serve := func(compression bool, frames ...[]byte) *testWriter {
+		writer := &testWriter{
+			upgrader: gorilla.Upgrader{EnableCompression: compression},
+			frames:   frames,
+			replies:  make(chan []byte, 10),
+			pongs:    make(chan string, 10),
+			closing:  make(chan struct{}),
+		}
+
+		address := fmt.Sprintf("localhost:%d", port)
+		go func() {
+			defer GinkgoRecover()
+			err := http.ListenAndServe(address, http.HandlerFunc(writer.handle))
+			Expect(err).NotTo(HaveOccurred())
+		}()
+
+		time.Sleep(50 * time.Millisecond)
+
+		return writer
+	}
+
+	BeforeEach(func() {
+		if port == 0 {
+			port = 49382
+		}
+		port++
+
+		config = jsonstruct.New()
+		config.SetString(websocket.RemoteWriterAddr, "localhost")
+		config.SetInt(websocket.Port, port)
+
+		reader = websocket.Reader{}
+	})
+
+	It("connects to a writer and reads frames until the writer closes", func() {
+		writer := serve(false, make([]byte, 100), make([]byte, 100))
+
+		err := reader.Init(config)
+		Expect(err).NotTo(HaveOccurred())
+
+		message := make([]byte, 200)
+		count, err := reader.Read(message)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(count).To(Equal(100))
+
+		count, err = reader.Read(message)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(count).To(Equal(100))
+
+		close(writer.closing)
+
+		_, err = reader.Read(message)
+		Expect(err).To(Equal(io.EOF))
+
+		err = reader.Close()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("answers pings while reading", func() {
+		writer := serve(false, make([]byte, 10))
+
+		err := reader.Init(config)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = reader.Read(make([]byte, 100))
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(writer.pongs).Should(Receive(Equal("ping")))
+
+		close(writer.closing)
+		reader.Close()
+	})
+
+	It("negotiates compression when configured to", func() {
+		writer := serve(true, []byte("compressed"))
+		config.SetString(websocket.Compression, "true")
+
+		err := reader.Init(config)
+		Expect(err).NotTo(HaveOccurred())
+
+		message := make([]byte, 100)
+		count, err := reader.Read(message)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(message[:count]).To(Equal([]byte("compressed")))
+
+		close(writer.closing)
+		reader.Close()
+	})
+
+	It("returns from a call to Read() when Close() is called", func() {
+		writer := serve(false)
+
+		err := reader.Init(config)
+		Expect(err).NotTo(HaveOccurred())
+
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			messageRead := make([]byte, 1024)
+			bytesRead, err := reader.Read(messageRead)
+			Expect(err).To(Equal(io.EOF))
+			Expect(bytesRead).To(Equal(0))
+			close(done)
+		}()
+
+		time.Sleep(10 * time.Millisecond)
+
+		err = reader.Close()
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(done).Should(BeClosed())
+
+		close(writer.closing)
+	})
+
+	It("sends replies back to the writer", func() {
+		writer := serve(false)
+
+		err := reader.Init(config)
+		Expect(err).NotTo(HaveOccurred())
+
+		count, err := reader.Write([]byte("pong"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(count).To(Equal(4))
+
+		Eventually(writer.replies).Should(Receive(Equal([]byte("pong"))))
+
+		close(writer.closing)
+		reader.Close()
+	})
+})
@@ -0,0 +1,13 @@
+package websocket_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestWebSocket(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Adapters - WebSocket Suite")
+}
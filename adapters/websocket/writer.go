@@ -0,0 +1,226 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	gorilla "github.com/gorilla/websocket"
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/adapters/internal/sockopt"
+	"github.com/myshkin5/netspel/factory"
+	"github.com/myshkin5/netspel/logs"
+	"github.com/myshkin5/netspel/utils"
+)
+
+func init() {
+	factory.RegisterWriter(factory.Descriptor{
+		Name:        "websocket",
+		Description: "Serves messages as WebSocket frames to the readers that connect to it.",
+		Config:      configKeys,
+	}, func() factory.Writer {
+		return &Writer{}
+	})
+}
+
+type Writer struct {
+	listener  net.Listener
+	server    *http.Server
+	upgrader  gorilla.Upgrader
+	messages  chan []byte
+	responses chan response
+	replies   chan []byte
+	closing   chan struct{}
+	readers   sync.WaitGroup
+
+	frameType    int
+	compression  bool
+	pingInterval time.Duration
+	pongTimeout  time.Duration
+}
+
+type response struct {
+	count int
+	err   error
+}
+
+func (w *Writer) Init(config jsonstruct.JSONStruct) error {
+	port := config.IntWithDefault(Port, DefaultPort)
+
+	var err error
+	w.frameType, err = frameType(config)
+	if err != nil {
+		return err
+	}
+	w.compression, err = utils.BoolWithDefault(config, Compression, DefaultCompression)
+	if err != nil {
+		return err
+	}
+	w.pingInterval, err = config.DurationWithDefault(PingInterval, DefaultPingInterval)
+	if err != nil {
+		return err
+	}
+	w.pongTimeout, err = config.DurationWithDefault(PongTimeout, DefaultPongTimeout)
+	if err != nil {
+		return err
+	}
+
+	options, err := sockopt.New(config)
+	if err != nil {
+		return err
+	}
+	w.listener, err = options.Listen("tcp", fmt.Sprintf("localhost:%d", port), "WebSocket writer")
+	if err != nil {
+		return err
+	}
+
+	w.messages = make(chan []byte)
+	w.responses = make(chan response, 1)
+	w.replies = make(chan []byte)
+	w.closing = make(chan struct{})
+
+	w.upgrader = gorilla.Upgrader{
+		EnableCompression: w.compression,
+		CheckOrigin: func(r *http.Request) bool {
+			return true
+		},
+	}
+	w.server = &http.Server{
+		Handler: http.HandlerFunc(w.handle),
+	}
+
+	go func() {
+		err := w.server.Serve(w.listener)
+		select {
+		case <-w.closing:
+		default:
+			logs.Logger.Warning("Error when serving, %s", err.Error())
+		}
+	}()
+
+	return nil
+}
+
+// Addr returns the address readers connect to.
+func (w *Writer) Addr() net.Addr {
+	return w.listener.Addr()
+}
+
+// Write sends a message to the next connected reader, blocking until a reader
+// connects.
+func (w *Writer) Write(message []byte) (int, error) {
+	w.messages <- message
+	resp := <-w.responses
+	return resp.count, resp.err
+}
+
+// Read returns replies readers send back to the writer.
+func (w *Writer) Read(message []byte) (int, error) {
+	select {
+	case reply := <-w.replies:
+		return copy(message, reply), nil
+	case <-w.closing:
+		return 0, io.EOF
+	}
+}
+
+func (w *Writer) Close() error {
+	close(w.closing)
+	select {
+	case <-w.messages:
+	default:
+	}
+	close(w.messages)
+	w.responses <- response{
+		count: 0,
+		err:   errors.New("Writer closing"),
+	}
+	w.readers.Wait()
+	return w.listener.Close()
+}
+
+func (w *Writer) handle(rw http.ResponseWriter, r *http.Request) {
+	w.readers.Add(1)
+	defer w.readers.Done()
+
+	connection, err := w.upgrader.Upgrade(rw, r, nil)
+	if err != nil {
+		logs.Logger.Warning("Error upgrading connection, %s", err.Error())
+		return
+	}
+	defer connection.Close()
+	connection.EnableWriteCompression(w.compression)
+
+	disconnected := make(chan struct{})
+	go w.readReplies(connection, disconnected)
+
+	var pings <-chan time.Time
+	if w.pingInterval > 0 {
+		ticker := time.NewTicker(w.pingInterval)
+		defer ticker.Stop()
+		pings = ticker.C
+	}
+
+	for {
+		select {
+		case <-disconnected:
+			return
+		case <-pings:
+			err := connection.WriteControl(gorilla.PingMessage, nil, time.Now().Add(w.pongTimeout))
+			if err != nil {
+				return
+			}
+		case message, ok := <-w.messages:
+			if !ok {
+				connection.WriteControl(gorilla.CloseMessage,
+					gorilla.FormatCloseMessage(gorilla.CloseNormalClosure, ""), time.Now().Add(time.Second))
+				return
+			}
+
+			err := connection.WriteMessage(w.frameType, message)
+			count := len(message)
+			if err != nil {
+				count = 0
+			}
+			w.responses <- response{
+				count: count,
+				err:   err,
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readReplies reads frames sent back by a reader. Reading also processes the
+// reader's pongs; a reader that doesn't answer pings within the pong timeout
+// is disconnected.
+func (w *Writer) readReplies(connection *gorilla.Conn, disconnected chan<- struct{}) {
+	defer close(disconnected)
+
+	if w.pingInterval > 0 {
+		extend := func(string) error {
+			return connection.SetReadDeadline(time.Now().Add(w.pingInterval + w.pongTimeout))
+		}
+		extend("")
+		connection.SetPongHandler(extend)
+	}
+
+	for {
+		_, reply, err := connection.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		select {
+		case w.replies <- reply:
+		case <-w.closing:
+			return
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package websocket_test
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	gorilla "github.com/gorilla/websocket"
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/adapters/websocket"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Writer", func() {
+	var (
+		port   int
+		config jsonstruct.JSONStruct
+		writer *websocket.Writer
+	)
+
+	BeforeEach(func() {
+		if port == 0 {
+			port = 29787
+		}
+		port++
+
+		config = jsonstruct.New()
+		config.SetInt(websocket.Port, port)
+
+		writer = &websocket.Writer{}
+	})
+
+	initWriter := func() {
+		err := writer.Init(config)
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+	}
+
+	dial := func(dialer *gorilla.Dialer) *gorilla.Conn {
+		connection, _, err := dialer.Dial(fmt.Sprintf("ws://localhost:%d/", port), nil)
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+		return connection
+	}
+
+	It("blocks a writer until a reader connects", func() {
+		initWriter()
+		defer writer.Close()
+
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			writer.Write(make([]byte, 1024))
+			close(done)
+		}()
+
+		Consistently(done).ShouldNot(BeClosed())
+	})
+
+	It("sends binary frames to a reader", func() {
+		initWriter()
+
+		message1 := make([]byte, 10)
+		message2 := make([]byte, 1024)
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+
+			count, err := writer.Write(message1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(count).To(Equal(10))
+
+			count, err = writer.Write(message2)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(count).To(Equal(1024))
+
+			err = writer.Close()
+			Expect(err).NotTo(HaveOccurred())
+
+			close(done)
+		}()
+
+		connection := dial(gorilla.DefaultDialer)
+		defer connection.Close()
+
+		frameType, data, err := connection.ReadMessage()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(frameType).To(Equal(gorilla.BinaryMessage))
+		Expect(data).To(Equal(message1))
+
+		_, data, err = connection.ReadMessage()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(Equal(message2))
+
+		_, _, err = connection.ReadMessage()
+		Expect(gorilla.IsCloseError(err, gorilla.CloseNormalClosure)).To(BeTrue())
+
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("sends text frames when configured to", func() {
+		config.SetString(websocket.FrameType, websocket.Text)
+		initWriter()
+		defer writer.Close()
+
+		go writer.Write([]byte("hello"))
+
+		connection := dial(gorilla.DefaultDialer)
+		defer connection.Close()
+
+		frameType, data, err := connection.ReadMessage()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(frameType).To(Equal(gorilla.TextMessage))
+		Expect(data).To(Equal([]byte("hello")))
+	})
+
+	It("rejects unknown frame types", func() {
+		config.SetString(websocket.FrameType, "morse")
+
+		err := writer.Init(config)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("compresses frames when configured to", func() {
+		config.SetString(websocket.Compression, "true")
+		initWriter()
+		defer writer.Close()
+
+		message := make([]byte, 4096)
+		go writer.Write(message)
+
+		connection, resp, err := (&gorilla.Dialer{EnableCompression: true}).Dial(fmt.Sprintf("ws://localhost:%d/", port), nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer connection.Close()
+		Expect(resp.Header.Get("Sec-Websocket-Extensions")).To(ContainSubstring("permessage-deflate"))
+
+		_, data, err := connection.ReadMessage()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(Equal(message))
+	})
+
+	It("pings readers when configured to", func() {
+		config.SetString(websocket.PingInterval, "20ms")
+		initWriter()
+		defer writer.Close()
+
+		connection := dial(gorilla.DefaultDialer)
+		defer connection.Close()
+
+		pings := make(chan string, 10)
+		connection.SetPingHandler(func(data string) error {
+			pings <- data
+			return nil
+		})
+		go connection.ReadMessage()
+
+		Eventually(pings).Should(Receive())
+		Eventually(pings).Should(Receive())
+	})
+
+	It("stops attempting to write when closed", func() {
+		initWriter()
+
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+
+			count, err := writer.Write(make([]byte, 10))
+			Expect(err).To(HaveOccurred())
+			Expect(count).To(Equal(0))
+
+			close(done)
+		}()
+
+		// Test needs to wait for Write() to be called
+		time.Sleep(10 * time.Millisecond)
+
+		err := writer.Close()
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("reads replies sent by a reader", func() {
+		initWriter()
+
+		connection := dial(gorilla.DefaultDialer)
+		defer connection.Close()
+
+		err := connection.WriteMessage(gorilla.BinaryMessage, []byte("pong"))
+		Expect(err).NotTo(HaveOccurred())
+
+		reply := make([]byte, 1024)
+		count, err := writer.Read(reply)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reply[:count]).To(Equal([]byte("pong")))
+
+		err = writer.Close()
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = writer.Read(reply)
+		Expect(err).To(Equal(io.EOF))
+	})
+})
@@ -0,0 +1,304 @@
+package clock
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/factory"
+	"github.com/myshkin5/netspel/logs"
+	"github.com/myshkin5/netspel/utils"
+)
+
+const (
+	prefix = ".clock."
+
+	Sync             = prefix + "sync"
+	Port             = prefix + "port"
+	RemoteReaderAddr = prefix + "remote-reader-addr"
+	Probes           = prefix + "probes"
+	Timeout          = prefix + "timeout"
+
+	DefaultSync             = false
+	DefaultPort             = 57958
+	DefaultRemoteReaderAddr = "localhost"
+	DefaultProbes           = 8
+	DefaultTimeout          = 5 * time.Second
+
+	frameSize = 25
+
+	probeFrame  = 'P'
+	resultFrame = 'R'
+)
+
+// ConfigKeys are read by schemes that estimate the reader's clock offset.
+var ConfigKeys = []factory.ConfigKey{
+	{Path: Sync, Type: factory.BoolType, Default: fmt.Sprint(DefaultSync),
+		Doc: "When true, the writer and reader estimate their clock offset. The same value must be used by the writer and the reader."},
+	{Path: Port, Type: factory.IntType, Default: fmt.Sprint(DefaultPort), Range: factory.Between(0, 65535),
+		Doc: "The port of the reader's control channel."},
+	{Path: RemoteReaderAddr, Type: factory.StringType, Default: DefaultRemoteReaderAddr,
+		Doc: "The address of the reader's host. Used only in write mode."},
+	{Path: Probes, Type: factory.IntType, Default: fmt.Sprint(DefaultProbes), Range: factory.AtLeast(1),
+		Doc: "The count of probes sent for each estimate."},
+	{Path: Timeout, Type: factory.DurationType, Default: fmt.Sprint(DefaultTimeout),
+		Doc: "How long the writer waits for each estimate, including waiting for the reader to start. Used only in write mode."},
+}
+
+// Estimate is an NTP-style estimate of how far the server's clock is ahead
+// of the client's. The true offset is within ErrorBound of Offset.
+type Estimate struct {
+	Offset    time.Duration `json:"offset-ns"`
+	RoundTrip time.Duration `json:"round-trip-ns"`
+}
+
+// ErrorBound is half the round trip, the most the offset can be wrong by if
+// the probe and its reply took all of the round trip in one direction.
+func (e Estimate) ErrorBound() time.Duration {
+	return e.RoundTrip / 2
+}
+
+func (e Estimate) String() string {
+	return fmt.Sprintf("%s ±%s", e.Offset, e.ErrorBound())
+}
+
+// Config holds the settings of the reader's server and the writer's probes.
+// The reader listens on the port on all addresses and the writer connects to
+// the port at the remote reader address.
+type Config struct {
+	Port             int
+	RemoteReaderAddr string
+	Probes           int
+	Timeout          time.Duration
+}
+
+// NewConfig returns nil when clock sync isn't enabled.
+func NewConfig(config jsonstruct.JSONStruct) (*Config, error) {
+	enabled, err := utils.BoolWithDefault(config, Sync, DefaultSync)
+	if err != nil || !enabled {
+		return nil, err
+	}
+
+	c := &Config{
+		Port:             config.IntWithDefault(Port, DefaultPort),
+		RemoteReaderAddr: config.StringWithDefault(RemoteReaderAddr, DefaultRemoteReaderAddr),
+		Probes:           config.IntWithDefault(Probes, DefaultProbes),
+	}
+	if c.Probes < 1 {
+		return nil, fmt.Errorf("At least one clock probe is required, %d", c.Probes)
+	}
+	c.Timeout, err = config.DurationWithDefault(Timeout, DefaultTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Server answers clock probes and keeps the estimates clients send back once
+// they are done probing.
+type Server struct {
+	listener net.Listener
+	done     sync.WaitGroup
+
+	mutex     sync.Mutex
+	estimates []Estimate
+}
+
+func Listen(config Config) (*Server, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort("", strconv.Itoa(config.Port)))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		listener: listener,
+	}
+	s.done.Add(1)
+	go s.accept()
+
+	return s, nil
+}
+
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Estimates returns the estimates received so far, in the order they were
+// made.
+func (s *Server) Estimates() []Estimate {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]Estimate(nil), s.estimates...)
+}
+
+// First returns the first estimate received, if any.
+func (s *Server) First() (Estimate, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.estimates) == 0 {
+		return Estimate{}, false
+	}
+	return s.estimates[0], true
+}
+
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.done.Wait()
+	return err
+}
+
+func (s *Server) accept() {
+	defer s.done.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.done.Add(1)
+		go func() {
+			defer s.done.Done()
+			defer conn.Close()
+			s.serve(conn)
+		}()
+	}
+}
+
+func (s *Server) serve(conn net.Conn) {
+	frame := make([]byte, frameSize)
+	for {
+		_, err := io.ReadFull(conn, frame)
+		if err != nil {
+			return
+		}
+		received := time.Now()
+
+		switch frame[0] {
+		case probeFrame:
+			putTime(frame, 2, received)
+			putTime(frame, 3, time.Now())
+			_, err = conn.Write(frame)
+			if err != nil {
+				return
+			}
+		case resultFrame:
+			s.add(Estimate{
+				Offset:    time.Duration(int64(binary.BigEndian.Uint64(frame[1:9]))),
+				RoundTrip: time.Duration(int64(binary.BigEndian.Uint64(frame[9:17]))),
+			})
+			_, err = conn.Write(frame)
+			if err != nil {
+				return
+			}
+		default:
+			logs.Logger.Warning("Unknown clock frame, %q", frame[0])
+			return
+		}
+	}
+}
+
+func (s *Server) add(estimate Estimate) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.estimates = append(s.estimates, estimate)
+}
+
+// Probe estimates the offset of the server's clock by sending it probes and
+// then sends the server the estimate, waiting for the server to acknowledge
+// it. The estimate is taken from the probe
+// with the shortest round trip, which has the smallest error bound. Probe
+// keeps trying to connect until the timeout, in case the server isn't up yet.
+func Probe(config Config) (Estimate, error) {
+	deadline := time.Now().Add(config.Timeout)
+	address := net.JoinHostPort(config.RemoteReaderAddr, strconv.Itoa(config.Port))
+	conn, err := dial(address, deadline)
+	if err != nil {
+		return Estimate{}, err
+	}
+	defer conn.Close()
+
+	err = conn.SetDeadline(deadline)
+	if err != nil {
+		return Estimate{}, err
+	}
+
+	var best Estimate
+	frame := make([]byte, frameSize)
+	for i := 0; i < config.Probes; i++ {
+		frame[0] = probeFrame
+		t1 := time.Now()
+		putTime(frame, 1, t1)
+		_, err = conn.Write(frame)
+		if err != nil {
+			return Estimate{}, err
+		}
+		_, err = io.ReadFull(conn, frame)
+		if err != nil {
+			return Estimate{}, err
+		}
+		t4 := time.Now()
+
+		sample := estimate(t1, getTime(frame, 2), getTime(frame, 3), t4)
+		if i == 0 || sample.RoundTrip < best.RoundTrip {
+			best = sample
+		}
+	}
+
+	frame[0] = resultFrame
+	binary.BigEndian.PutUint64(frame[1:9], uint64(best.Offset))
+	binary.BigEndian.PutUint64(frame[9:17], uint64(best.RoundTrip))
+	binary.BigEndian.PutUint64(frame[17:25], 0)
+	_, err = conn.Write(frame)
+	if err != nil {
+		return Estimate{}, err
+	}
+	_, err = io.ReadFull(conn, frame)
+	if err != nil {
+		return Estimate{}, err
+	}
+
+	return best, nil
+}
+
+// estimate calculates the offset and round trip from the client's send and
+// receive times, t1 and t4, and the server's receive and send times, t2 and
+// t3, as NTP does.
+func estimate(t1, t2, t3, t4 time.Time) Estimate {
+	return Estimate{
+		Offset:    (t2.Sub(t1) + t3.Sub(t4)) / 2,
+		RoundTrip: t4.Sub(t1) - t3.Sub(t2),
+	}
+}
+
+func dial(address string, deadline time.Time) (net.Conn, error) {
+	for {
+		conn, err := net.DialTimeout("tcp", address, time.Until(deadline))
+		if err == nil {
+			return conn, nil
+		}
+		if time.Now().Add(100 * time.Millisecond).After(deadline) {
+			return nil, fmt.Errorf("Timed out connecting to the clock server, %s", err.Error())
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// putTime writes a time into one of the three 8 byte fields after a frame's
+// kind. Fields are numbered from 1.
+func putTime(frame []byte, field int, t time.Time) {
+	binary.BigEndian.PutUint64(frame[1+(field-1)*8:], uint64(t.UnixNano()))
+}
+
+func getTime(frame []byte, field int) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(frame[1+(field-1)*8:])))
+}
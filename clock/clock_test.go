@@ -0,0 +1,111 @@
+package clock_test
+
+import (
+	"net"
+	"time"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/clock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Clock", func() {
+	var (
+		server *clock.Server
+		config clock.Config
+	)
+
+	BeforeEach(func() {
+		var err error
+		server, err = clock.Listen(clock.Config{})
+		Expect(err).NotTo(HaveOccurred())
+
+		config = clock.Config{
+			Port:             server.Addr().(*net.TCPAddr).Port,
+			RemoteReaderAddr: "127.0.0.1",
+			Probes:           8,
+			Timeout:          time.Second,
+		}
+	})
+
+	AfterEach(func() {
+		Expect(server.Close()).To(Succeed())
+	})
+
+	It("estimates no offset on a single machine", func() {
+		estimate, err := clock.Probe(config)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(estimate.RoundTrip).To(BeNumerically(">", 0))
+		Expect(estimate.RoundTrip).To(BeNumerically("<", 100*time.Millisecond))
+		Expect(estimate.Offset).To(BeNumerically("~", 0, estimate.ErrorBound()+time.Microsecond))
+	})
+
+	It("sends the server each estimate", func() {
+		config.Probes = 2
+		before, err := clock.Probe(config)
+		Expect(err).NotTo(HaveOccurred())
+		after, err := clock.Probe(config)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(server.Estimates()).To(Equal([]clock.Estimate{before, after}))
+		first, ok := server.First()
+		Expect(ok).To(BeTrue())
+		Expect(first).To(Equal(before))
+	})
+
+	It("gives up when no server answers before the timeout", func() {
+		Expect(server.Close()).To(Succeed())
+
+		config.Timeout = 200 * time.Millisecond
+		_, err := clock.Probe(config)
+		Expect(err).To(MatchError(ContainSubstring("Timed out connecting to the clock server")))
+
+		server, err = clock.Listen(clock.Config{})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("reports the error bound with the offset", func() {
+		estimate := clock.Estimate{Offset: -3 * time.Millisecond, RoundTrip: 400 * time.Microsecond}
+		Expect(estimate.String()).To(Equal("-3ms ±200µs"))
+	})
+
+	Context("config", func() {
+		var additional jsonstruct.JSONStruct
+
+		BeforeEach(func() {
+			additional = jsonstruct.New()
+		})
+
+		It("is disabled by default", func() {
+			c, err := clock.NewConfig(additional)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c).To(BeNil())
+		})
+
+		It("reads the settings when enabled", func() {
+			additional.SetString(clock.Sync, "true")
+			additional.SetString(clock.RemoteReaderAddr, "reader.example.com")
+			additional.SetInt(clock.Port, 1234)
+
+			c, err := clock.NewConfig(additional)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*c).To(Equal(clock.Config{
+				Port:             1234,
+				RemoteReaderAddr: "reader.example.com",
+				Probes:           clock.DefaultProbes,
+				Timeout:          clock.DefaultTimeout,
+			}))
+		})
+
+		It("requires at least one probe", func() {
+			additional.SetString(clock.Sync, "true")
+			additional.SetInt(clock.Probes, 0)
+
+			_, err := clock.NewConfig(additional)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -1,7 +1,10 @@
 package factory
 
 import (
+	"fmt"
 	"io"
+	"net"
+	"strings"
 
 	"github.com/myshkin5/jsonstruct"
 )
@@ -15,3 +18,87 @@ type Reader interface {
 	Init(config jsonstruct.JSONStruct) error
 	io.ReadCloser
 }
+
+// DuplexWriter is implemented by writers that can also read the replies sent
+// back by their readers. Read returns io.EOF once the writer is closed.
+type DuplexWriter interface {
+	Writer
+	io.Reader
+}
+
+// DuplexReader is implemented by readers that can reply to the writer of the
+// most recently read message.
+type DuplexReader interface {
+	Reader
+	io.Writer
+}
+
+// Listener is implemented by writers that readers connect to, such as SSE,
+// rather than writers that connect to their readers. A Listener accepts
+// connections once Init returns so it must be initialized before its readers.
+type Listener interface {
+	Writer
+	Addr() net.Addr
+}
+
+// Wrapper is implemented by writers that wrap another writer, such as the
+// impair writer. WrappedType returns the type of the writer wrapped as
+// configured so that callers can tell, before Init, whether it is a Listener.
+type Wrapper interface {
+	Writer
+	WrappedType(config jsonstruct.JSONStruct) string
+}
+
+// SizedAdapter is implemented by adapters whose framing depends on the sizes
+// of messages, such as fixed size records. SetMessageSizes is called before
+// Init.
+type SizedAdapter interface {
+	SetMessageSizes(min, max int)
+}
+
+// ShareMessageSizes passes the message sizes of an initialized scheme to an
+// adapter about to be initialized when the scheme is a MessageSizer and the
+// adapter is a SizedAdapter.
+func ShareMessageSizes(scheme Scheme, adapter interface{}) {
+	sizer, ok := scheme.(MessageSizer)
+	if !ok {
+		return
+	}
+	sized, ok := adapter.(SizedAdapter)
+	if !ok {
+		return
+	}
+	sized.SetMessageSizes(sizer.MessageSizes())
+}
+
+// Stat is a named count collected by an adapter.
+type Stat struct {
+	Name  string `json:"name"`
+	Value uint64 `json:"value"`
+}
+
+// StatsCollector is implemented by adapters that collect stats the scheme
+// can't see, such as messages dropped by the kernel. Stats is called once the
+// adapter is closed and covers the whole run.
+type StatsCollector interface {
+	Stats() []Stat
+}
+
+// CollectStats returns the stats of a closed adapter when it collects any.
+func CollectStats(adapter interface{}) []Stat {
+	collector, ok := adapter.(StatsCollector)
+	if !ok {
+		return nil
+	}
+	return collector.Stats()
+}
+
+// DescribeStats formats stats for logging, such as "3 socket drops, 0 host
+// InErrors".
+func DescribeStats(stats []Stat) string {
+	described := make([]string, len(stats))
+	for i, stat := range stats {
+		described[i] = fmt.Sprintf("%d %s", stat.Value, stat.Name)
+	}
+	return strings.Join(described, ", ")
+}
@@ -0,0 +1,197 @@
+package factory
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Kind is the role a registered type plays in a run.
+type Kind string
+
+const (
+	KindWriter Kind = "writer"
+	KindReader Kind = "reader"
+	KindScheme Kind = "scheme"
+)
+
+// ConfigType is the type of a configuration value as written in the JSON
+// configuration.
+type ConfigType string
+
+const (
+	IntType      ConfigType = "int"
+	FloatType    ConfigType = "float"
+	StringType   ConfigType = "string"
+	BoolType     ConfigType = "bool"
+	DurationType ConfigType = "duration"
+)
+
+// ConfigKey documents one value read from the additional configuration.
+type ConfigKey struct {
+	// Path is the dot path of the key, such as .udp.port.
+	Path string
+	Type ConfigType
+	// Default is the value used when the key is missing, as it would be
+	// written on the command line. Empty when there is no default.
+	Default  string
+	Required bool
+	// Values lists the allowed values of keys that take one of a few strings.
+	Values []string
+	// Range limits the values of numeric and duration keys.
+	Range *Range
+	// Names is set on keys whose value names another registered type, such
+	// as the writer wrapped by the impair writer. That type's keys are read
+	// too.
+	Names Kind
+	Doc   string
+}
+
+// Descriptor tells users what a registered type is and which configuration
+// it reads.
+type Descriptor struct {
+	Name        string
+	Kind        Kind
+	Description string
+	Config      []ConfigKey
+}
+
+// DefaultRegistry holds the writers, readers and schemes that register
+// themselves from their packages' init functions.
+var DefaultRegistry = NewRegistry()
+
+// Registry creates writers, readers and schemes by name. It is safe for
+// concurrent use.
+type Registry struct {
+	mutex   sync.RWMutex
+	entries map[Kind]map[string]entry
+}
+
+type entry struct {
+	descriptor Descriptor
+	new        func() interface{}
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		entries: map[Kind]map[string]entry{
+			KindWriter: make(map[string]entry),
+			KindReader: make(map[string]entry),
+			KindScheme: make(map[string]entry),
+		},
+	}
+}
+
+// RegisterWriter registers a writer's constructor. It panics if a writer with
+// the same name is already registered.
+func (r *Registry) RegisterWriter(descriptor Descriptor, new func() Writer) {
+	r.register(KindWriter, descriptor, func() interface{} { return new() })
+}
+
+// RegisterReader registers a reader's constructor. It panics if a reader with
+// the same name is already registered.
+func (r *Registry) RegisterReader(descriptor Descriptor, new func() Reader) {
+	r.register(KindReader, descriptor, func() interface{} { return new() })
+}
+
+// RegisterScheme registers a scheme's constructor. It panics if a scheme with
+// the same name is already registered.
+func (r *Registry) RegisterScheme(descriptor Descriptor, new func() Scheme) {
+	r.register(KindScheme, descriptor, func() interface{} { return new() })
+}
+
+func (r *Registry) register(kind Kind, descriptor Descriptor, new func() interface{}) {
+	descriptor.Kind = kind
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.entries[kind][descriptor.Name]; ok {
+		panic(fmt.Sprintf("A %s is already registered, %s", kind, descriptor.Name))
+	}
+	r.entries[kind][descriptor.Name] = entry{descriptor: descriptor, new: new}
+}
+
+func (r *Registry) CreateWriter(name string) (Writer, error) {
+	instance, err := r.create(KindWriter, name)
+	if err != nil {
+		return nil, err
+	}
+	return instance.(Writer), nil
+}
+
+func (r *Registry) CreateReader(name string) (Reader, error) {
+	instance, err := r.create(KindReader, name)
+	if err != nil {
+		return nil, err
+	}
+	return instance.(Reader), nil
+}
+
+func (r *Registry) CreateScheme(name string) (Scheme, error) {
+	instance, err := r.create(KindScheme, name)
+	if err != nil {
+		return nil, err
+	}
+	return instance.(Scheme), nil
+}
+
+func (r *Registry) create(kind Kind, name string) (interface{}, error) {
+	r.mutex.RLock()
+	entry, ok := r.entries[kind][name]
+	r.mutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("Type not found, %s", name)
+	}
+
+	return entry.new(), nil
+}
+
+// Describe returns the descriptor of a registered type.
+func (r *Registry) Describe(kind Kind, name string) (Descriptor, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	entry, ok := r.entries[kind][name]
+	return entry.descriptor, ok
+}
+
+// Descriptors returns the descriptors of every registered type of a kind,
+// sorted by name.
+func (r *Registry) Descriptors(kind Kind) []Descriptor {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	descriptors := make([]Descriptor, 0, len(r.entries[kind]))
+	for _, entry := range r.entries[kind] {
+		descriptors = append(descriptors, entry.descriptor)
+	}
+	sort.Slice(descriptors, func(i, j int) bool {
+		return descriptors[i].Name < descriptors[j].Name
+	})
+	return descriptors
+}
+
+func RegisterWriter(descriptor Descriptor, new func() Writer) {
+	DefaultRegistry.RegisterWriter(descriptor, new)
+}
+
+func RegisterReader(descriptor Descriptor, new func() Reader) {
+	DefaultRegistry.RegisterReader(descriptor, new)
+}
+
+func RegisterScheme(descriptor Descriptor, new func() Scheme) {
+	DefaultRegistry.RegisterScheme(descriptor, new)
+}
+
+func CreateWriter(name string) (Writer, error) {
+	return DefaultRegistry.CreateWriter(name)
+}
+
+func CreateReader(name string) (Reader, error) {
+	return DefaultRegistry.CreateReader(name)
+}
+
+func CreateScheme(name string) (Scheme, error) {
+	return DefaultRegistry.CreateScheme(name)
+}
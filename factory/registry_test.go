@@ -0,0 +1,136 @@
+package factory_test
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/factory"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type coolWriter struct {
+	coolValue int
+}
+
+func (w *coolWriter) Init(config jsonstruct.JSONStruct) error {
+	return nil
+}
+
+func (w *coolWriter) Write(message []byte) (int, error) {
+	return len(message), nil
+}
+
+func (w *coolWriter) Close() error {
+	return nil
+}
+
+var _ = Describe("Registry", func() {
+	var (
+		registry *factory.Registry
+	)
+
+	BeforeEach(func() {
+		registry = factory.NewRegistry()
+	})
+
+	It("returns an error when attempting to create an unregistered type", func() {
+		_, err := registry.CreateWriter("don't matter")
+		Expect(err).To(MatchError("Type not found, don't matter"))
+	})
+
+	It("returns a new instance from the registered constructor", func() {
+		registry.RegisterWriter(factory.Descriptor{Name: "cool"}, func() factory.Writer {
+			return &coolWriter{coolValue: 42}
+		})
+
+		first, err := registry.CreateWriter("cool")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(first.(*coolWriter).coolValue).To(Equal(42))
+
+		second, err := registry.CreateWriter("cool")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(second).NotTo(BeIdenticalTo(first))
+	})
+
+	It("keeps each kind separate", func() {
+		registry.RegisterWriter(factory.Descriptor{Name: "cool"}, func() factory.Writer {
+			return &coolWriter{}
+		})
+
+		_, err := registry.CreateReader("cool")
+		Expect(err).To(HaveOccurred())
+		_, ok := registry.Describe(factory.KindReader, "cool")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("panics when a name is registered twice", func() {
+		register := func() {
+			registry.RegisterWriter(factory.Descriptor{Name: "cool"}, func() factory.Writer {
+				return &coolWriter{}
+			})
+		}
+		register()
+		Expect(register).To(Panic())
+	})
+
+	It("describes registered types", func() {
+		key := factory.ConfigKey{Path: ".cool.value", Type: factory.IntType, Default: "42", Doc: "How cool."}
+		registry.RegisterWriter(factory.Descriptor{
+			Name:        "cool",
+			Description: "A cool writer.",
+			Config:      []factory.ConfigKey{key},
+		}, func() factory.Writer {
+			return &coolWriter{}
+		})
+
+		descriptor, ok := registry.Describe(factory.KindWriter, "cool")
+		Expect(ok).To(BeTrue())
+		Expect(descriptor).To(Equal(factory.Descriptor{
+			Name:        "cool",
+			Kind:        factory.KindWriter,
+			Description: "A cool writer.",
+			Config:      []factory.ConfigKey{key},
+		}))
+	})
+
+	It("lists descriptors by name", func() {
+		for _, name := range []string{"tepid", "cool", "warm"} {
+			registry.RegisterWriter(factory.Descriptor{Name: name}, func() factory.Writer {
+				return &coolWriter{}
+			})
+		}
+
+		var names []string
+		for _, descriptor := range registry.Descriptors(factory.KindWriter) {
+			names = append(names, descriptor.Name)
+		}
+		Expect(names).To(Equal([]string{"cool", "tepid", "warm"}))
+		Expect(registry.Descriptors(factory.KindScheme)).To(BeEmpty())
+	})
+
+	It("is safe for concurrent use", func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				name := fmt.Sprintf("cool %d", i)
+				registry.RegisterWriter(factory.Descriptor{Name: name}, func() factory.Writer {
+					return &coolWriter{coolValue: i}
+				})
+				writer, err := registry.CreateWriter(name)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(writer.(*coolWriter).coolValue).To(Equal(i))
+				registry.Descriptors(factory.KindWriter)
+			}(i)
+		}
+		wg.Wait()
+
+		Expect(registry.Descriptors(factory.KindWriter)).To(HaveLen(10))
+	})
+})
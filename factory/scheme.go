@@ -1,6 +1,10 @@
 package factory
 
-import "github.com/myshkin5/jsonstruct"
+import (
+	"time"
+
+	"github.com/myshkin5/jsonstruct"
+)
 
 type Scheme interface {
 	Init(config jsonstruct.JSONStruct) error
@@ -8,3 +12,23 @@ type Scheme interface {
 	RunWriter(writer Writer)
 	RunReader(reader Reader)
 }
+
+// Summary holds the totals of a completed run from either the writer's or the
+// reader's side.
+type Summary struct {
+	MessageCount uint64
+	ByteCount    uint64
+	ErrorCount   uint64
+	RunTime      time.Duration
+}
+
+// Summarizer is implemented by schemes that can summarize a completed run.
+type Summarizer interface {
+	Summary() Summary
+}
+
+// MessageSizer is implemented by schemes that know the sizes of the messages
+// they write and expect to read once initialized.
+type MessageSizer interface {
+	MessageSizes() (min, max int)
+}
@@ -0,0 +1,313 @@
+package factory
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/utils"
+)
+
+// maxTypoDistance is the most edits an unknown key may be from a known key
+// to be suggested as a typo of it.
+const maxTypoDistance = 2
+
+// Range limits a numeric value, including both ends. Durations are compared
+// in seconds.
+type Range struct {
+	Min float64
+	Max float64
+}
+
+func Between(min, max float64) *Range {
+	return &Range{Min: min, Max: max}
+}
+
+func AtLeast(min float64) *Range {
+	return &Range{Min: min, Max: math.Inf(1)}
+}
+
+func (r Range) contains(value float64) bool {
+	return value >= r.Min && value <= r.Max
+}
+
+func (r Range) String() string {
+	if math.IsInf(r.Max, 1) {
+		return fmt.Sprintf("at least %g", r.Min)
+	}
+	return fmt.Sprintf("from %g to %g", r.Min, r.Max)
+}
+
+// Validate checks the additional configuration against the keys read by the
+// configured scheme, writer and reader and any extra keys read outside of
+// them. Every unknown key, value of the wrong type, value out of range and
+// missing required key is reported in one error. Types that aren't
+// registered are left to be reported when they are created.
+func (r *Registry) Validate(config Config, extra []ConfigKey) error {
+	keys := make(map[string]ConfigKey)
+	for _, key := range extra {
+		keys[key.Path] = key
+	}
+
+	var problems []string
+	visited := make(map[Kind]map[string]bool)
+	var add func(kind Kind, name string)
+	add = func(kind Kind, name string) {
+		if name == "" || visited[kind][name] {
+			return
+		}
+		if visited[kind] == nil {
+			visited[kind] = make(map[string]bool)
+		}
+		visited[kind][name] = true
+
+		descriptor, ok := r.Describe(kind, name)
+		if !ok {
+			return
+		}
+		for _, key := range descriptor.Config {
+			keys[key.Path] = key
+			if key.Names == "" {
+				continue
+			}
+
+			value, ok := utils.Lookup(config.Additional, key.Path)
+			if !ok {
+				continue
+			}
+			named, ok := value.(string)
+			if !ok {
+				continue
+			}
+			if _, ok := r.Describe(key.Names, named); !ok {
+				problems = append(problems, fmt.Sprintf("%s must name a registered %s, not %q", key.Path, key.Names, named))
+				continue
+			}
+			add(key.Names, named)
+		}
+	}
+	add(KindScheme, config.SchemeType)
+	add(KindWriter, config.WriterType)
+	add(KindReader, config.ReaderType)
+
+	problems = append(problems, walk(map[string]interface{}(config.Additional), "", keys)...)
+
+	var required []string
+	for path, key := range keys {
+		if _, ok := utils.Lookup(config.Additional, path); key.Required && !ok {
+			required = append(required, fmt.Sprintf("%s is required", path))
+		}
+	}
+	sort.Strings(required)
+	problems = append(problems, required...)
+
+	if len(problems) > 0 {
+		return fmt.Errorf("Invalid configuration, %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func Validate(config Config, extra []ConfigKey) error {
+	return DefaultRegistry.Validate(config, extra)
+}
+
+// walk checks every value in an object, in order of their paths.
+func walk(object map[string]interface{}, prefix string, keys map[string]ConfigKey) []string {
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var problems []string
+	for _, name := range names {
+		path := prefix + "." + name
+		value := object[name]
+		key, known := keys[path]
+
+		child, isObject := asObject(value)
+		switch {
+		case isObject && known:
+			problems = append(problems, fmt.Sprintf("%s must be %s, not an object", path, article(key.Type)))
+		case isObject:
+			problems = append(problems, walk(child, path, keys)...)
+		case !known:
+			problems = append(problems, unknown(path, keys))
+		default:
+			problem := check(key, value)
+			if problem != "" {
+				problems = append(problems, problem)
+			}
+		}
+	}
+
+	return problems
+}
+
+// check returns the problem with a value, if any. Values are accepted as the
+// lookups reading them accept them, so numbers and booleans may be strings as
+// set with --config-string, except for ints.
+func check(key ConfigKey, value interface{}) string {
+	var number float64
+	ok := true
+	switch key.Type {
+	case IntType:
+		switch typed := value.(type) {
+		case int:
+			number = float64(typed)
+		case float64:
+			number = typed
+			ok = typed == math.Trunc(typed)
+		case string:
+			return fmt.Sprintf("%s must be an int, not %q (use --config-int)", key.Path, typed)
+		default:
+			ok = false
+		}
+	case FloatType:
+		switch typed := value.(type) {
+		case int:
+			number = float64(typed)
+		case float64:
+			number = typed
+		case string:
+			var err error
+			number, err = strconv.ParseFloat(typed, 64)
+			ok = err == nil
+		default:
+			ok = false
+		}
+	case StringType:
+		_, ok = value.(string)
+	case BoolType:
+		switch typed := value.(type) {
+		case bool:
+		case string:
+			_, err := strconv.ParseBool(typed)
+			ok = err == nil
+		default:
+			ok = false
+		}
+	case DurationType:
+		typed, isString := value.(string)
+		duration, err := time.ParseDuration(typed)
+		ok = isString && err == nil
+		number = duration.Seconds()
+	}
+	if !ok {
+		return fmt.Sprintf("%s must be %s, not %s", key.Path, article(key.Type), format(value))
+	}
+
+	if typed, ok := value.(string); ok && len(key.Values) > 0 && !contains(key.Values, typed) {
+		return fmt.Sprintf("%s must be one of %s, not %s", key.Path, strings.Join(key.Values, ", "), format(value))
+	}
+
+	if key.Range != nil && !key.Range.contains(number) {
+		return fmt.Sprintf("%s must be %s, not %s", key.Path, key.Range, format(value))
+	}
+
+	return ""
+}
+
+// unknown reports an unknown key, suggesting the closest known key when the
+// unknown key looks like a typo of it.
+func unknown(path string, keys map[string]ConfigKey) string {
+	known := make([]string, 0, len(keys))
+	for key := range keys {
+		known = append(known, key)
+	}
+	sort.Strings(known)
+
+	closest := ""
+	closestDistance := maxTypoDistance + 1
+	for _, key := range known {
+		distance := editDistance(path, key)
+		if distance < closestDistance {
+			closest = key
+			closestDistance = distance
+		}
+	}
+
+	if closest == "" {
+		return fmt.Sprintf("unknown key %s", path)
+	}
+	return fmt.Sprintf("unknown key %s (did you mean %s?)", path, closest)
+}
+
+// editDistance is the Levenshtein distance between two strings.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minimum(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
+
+func minimum(values ...int) int {
+	result := values[0]
+	for _, value := range values[1:] {
+		if value < result {
+			result = value
+		}
+	}
+	return result
+}
+
+func asObject(value interface{}) (map[string]interface{}, bool) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		return typed, true
+	case jsonstruct.JSONStruct:
+		return typed, true
+	default:
+		return nil, false
+	}
+}
+
+func article(configType ConfigType) string {
+	switch configType {
+	case IntType:
+		return "an int"
+	case FloatType:
+		return "a number"
+	case BoolType:
+		return "a boolean"
+	case DurationType:
+		return "a duration, such as 5s"
+	default:
+		return "a string"
+	}
+}
+
+func format(value interface{}) string {
+	if typed, ok := value.(string); ok {
+		return strconv.Quote(typed)
+	}
+	return fmt.Sprint(value)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+package factory_test
+
+import (
+	"github.com/myshkin5/netspel/factory"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Validate", func() {
+	var (
+		registry *factory.Registry
+		config   factory.Config
+	)
+
+	BeforeEach(func() {
+		registry = factory.NewRegistry()
+		registry.RegisterWriter(factory.Descriptor{
+			Name: "cool",
+			Config: []factory.ConfigKey{
+				{Path: ".cool.port", Type: factory.IntType, Range: factory.Between(0, 65535)},
+				{Path: ".cool.ratio", Type: factory.FloatType, Range: factory.Between(0, 1)},
+				{Path: ".cool.mode", Type: factory.StringType, Values: []string{"hot", "cold"}},
+				{Path: ".cool.enabled", Type: factory.BoolType},
+				{Path: ".cool.wait", Type: factory.DurationType, Range: factory.AtLeast(0)},
+			},
+		}, func() factory.Writer {
+			return &coolWriter{}
+		})
+		registry.RegisterWriter(factory.Descriptor{
+			Name: "wrapper",
+			Config: []factory.ConfigKey{
+				{Path: ".wrapper.writer-type", Type: factory.StringType, Required: true, Names: factory.KindWriter},
+			},
+		}, func() factory.Writer {
+			return &coolWriter{}
+		})
+
+		var err error
+		config, err = factory.Parse([]byte(`{"writer-type": "cool"}`))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("accepts values as JSON or as set on the command line", func() {
+		config.Additional.SetInt(".cool.port", 1234)
+		config.Additional.SetString(".cool.ratio", "0.5")
+		config.Additional.SetString(".cool.mode", "hot")
+		config.Additional.SetString(".cool.enabled", "true")
+		config.Additional.SetString(".cool.wait", "5s")
+		Expect(registry.Validate(config, nil)).To(Succeed())
+
+		config, err := factory.Parse([]byte(`{
+			"writer-type": "cool",
+			"additional": {
+				"cool": {
+					"port": 1234,
+					"ratio": 1,
+					"enabled": false
+				}
+			}
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(registry.Validate(config, nil)).To(Succeed())
+	})
+
+	It("suggests a known key for a misspelled key", func() {
+		config.Additional.SetInt(".cool.prot", 1234)
+		config.Additional.SetInt(".warm.port", 1234)
+
+		Expect(registry.Validate(config, nil)).To(MatchError("Invalid configuration, " +
+			"unknown key .cool.prot (did you mean .cool.port?); unknown key .warm.port"))
+	})
+
+	It("reports values of the wrong type", func() {
+		config, err := factory.Parse([]byte(`{
+			"writer-type": "cool",
+			"additional": {
+				"cool": {
+					"port": 12.5,
+					"ratio": "half",
+					"mode": 3,
+					"enabled": "sometimes",
+					"wait": 5
+				}
+			}
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(registry.Validate(config, nil)).To(MatchError("Invalid configuration, " +
+			".cool.enabled must be a boolean, not \"sometimes\"; " +
+			".cool.mode must be a string, not 3; " +
+			".cool.port must be an int, not 12.5; " +
+			".cool.ratio must be a number, not \"half\"; " +
+			".cool.wait must be a duration, such as 5s, not 5"))
+	})
+
+	It("tells how to set an int on the command line", func() {
+		config.Additional.SetString(".cool.port", "1234")
+
+		Expect(registry.Validate(config, nil)).To(MatchError(
+			"Invalid configuration, .cool.port must be an int, not \"1234\" (use --config-int)"))
+	})
+
+	It("reports an object in place of a value", func() {
+		config.Additional.SetInt(".cool.port.number", 1234)
+
+		Expect(registry.Validate(config, nil)).To(MatchError(
+			"Invalid configuration, .cool.port must be an int, not an object"))
+	})
+
+	It("reports values that aren't allowed", func() {
+		config.Additional.SetInt(".cool.port", 70000)
+		config.Additional.SetString(".cool.ratio", "1.5")
+		config.Additional.SetString(".cool.mode", "warm")
+		config.Additional.SetString(".cool.wait", "-1s")
+
+		Expect(registry.Validate(config, nil)).To(MatchError("Invalid configuration, " +
+			".cool.mode must be one of hot, cold, not \"warm\"; " +
+			".cool.port must be from 0 to 65535, not 70000; " +
+			".cool.ratio must be from 0 to 1, not \"1.5\"; " +
+			".cool.wait must be at least 0, not \"-1s\""))
+	})
+
+	It("accepts the keys of the type a key names", func() {
+		config.WriterType = "wrapper"
+		config.Additional.SetString(".wrapper.writer-type", "cool")
+		config.Additional.SetInt(".cool.port", 1234)
+
+		Expect(registry.Validate(config, nil)).To(Succeed())
+	})
+
+	It("reports a key naming an unregistered type", func() {
+		config.WriterType = "wrapper"
+		config.Additional.SetString(".wrapper.writer-type", "warm")
+
+		Expect(registry.Validate(config, nil)).To(MatchError(
+			"Invalid configuration, .wrapper.writer-type must name a registered writer, not \"warm\""))
+	})
+
+	It("reports missing required keys", func() {
+		config.WriterType = "wrapper"
+
+		Expect(registry.Validate(config, nil)).To(MatchError(
+			"Invalid configuration, .wrapper.writer-type is required"))
+	})
+
+	It("accepts extra keys", func() {
+		config.Additional.SetString(".output.format", "json")
+		Expect(registry.Validate(config, nil)).To(HaveOccurred())
+
+		extra := []factory.ConfigKey{{Path: ".output.format", Type: factory.StringType}}
+		Expect(registry.Validate(config, extra)).To(Succeed())
+	})
+
+	It("leaves unregistered types to be reported when they are created", func() {
+		config.SchemeType = "not there"
+		Expect(registry.Validate(config, nil)).To(Succeed())
+	})
+})
@@ -0,0 +1,187 @@
+package histogram
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+const (
+	// subBucketBits sets the precision of recorded values. Values are kept to
+	// within 1/1024 (~0.1%) of their actual value.
+	subBucketBits  = 11
+	subBucketCount = 1 << subBucketBits
+	subBucketHalf  = subBucketCount / 2
+)
+
+// Histogram records durations into logarithmic buckets, each split into linear
+// sub-buckets, in the style of HdrHistogram. Memory grows with the largest
+// value recorded rather than the count of values. A Histogram is not safe for
+// concurrent use.
+type Histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+	min    int64
+	max    int64
+}
+
+func New() *Histogram {
+	return &Histogram{}
+}
+
+func (h *Histogram) Record(value time.Duration) {
+	nanos := int64(value)
+	if nanos < 0 {
+		nanos = 0
+	}
+
+	index := bucketIndex(uint64(nanos))
+	if index >= len(h.counts) {
+		counts := make([]uint64, index+1)
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	h.counts[index]++
+
+	if h.count == 0 || nanos < h.min {
+		h.min = nanos
+	}
+	if nanos > h.max {
+		h.max = nanos
+	}
+	h.count++
+	h.sum += float64(nanos)
+}
+
+func (h *Histogram) Count() uint64 {
+	return h.count
+}
+
+func (h *Histogram) Min() time.Duration {
+	return time.Duration(h.min)
+}
+
+func (h *Histogram) Max() time.Duration {
+	return time.Duration(h.max)
+}
+
+func (h *Histogram) Mean() time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	return time.Duration(h.sum / float64(h.count))
+}
+
+// Percentile returns the value at or below which the given percent (0 to 100)
+// of recorded values fall.
+func (h *Histogram) Percentile(percent float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+
+	target := uint64(math.Ceil(percent / 100 * float64(h.count)))
+	if target < 1 {
+		target = 1
+	}
+
+	var total uint64
+	for index, count := range h.counts {
+		total += count
+		if total >= target {
+			value := highestEquivalentValue(index)
+			if value > h.max {
+				value = h.max
+			}
+			if value < h.min {
+				value = h.min
+			}
+			return time.Duration(value)
+		}
+	}
+
+	return time.Duration(h.max)
+}
+
+// Stats holds the count and the commonly reported percentiles of a
+// histogram's values. Durations are encoded as nanoseconds.
+type Stats struct {
+	Count uint64        `json:"count"`
+	P50   time.Duration `json:"p50-ns"`
+	P90   time.Duration `json:"p90-ns"`
+	P99   time.Duration `json:"p99-ns"`
+	P999  time.Duration `json:"p999-ns"`
+	Max   time.Duration `json:"max-ns"`
+}
+
+func (h *Histogram) Stats() Stats {
+	return Stats{
+		Count: h.count,
+		P50:   h.Percentile(50),
+		P90:   h.Percentile(90),
+		P99:   h.Percentile(99),
+		P999:  h.Percentile(99.9),
+		Max:   h.Max(),
+	}
+}
+
+// Merge adds all values recorded by other into h.
+func (h *Histogram) Merge(other *Histogram) {
+	if other.count == 0 {
+		return
+	}
+
+	if len(other.counts) > len(h.counts) {
+		counts := make([]uint64, len(other.counts))
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	for index, count := range other.counts {
+		h.counts[index] += count
+	}
+
+	if h.count == 0 || other.min < h.min {
+		h.min = other.min
+	}
+	if other.max > h.max {
+		h.max = other.max
+	}
+	h.count += other.count
+	h.sum += other.sum
+}
+
+func (h *Histogram) Reset() {
+	for index := range h.counts {
+		h.counts[index] = 0
+	}
+	h.count = 0
+	h.sum = 0
+	h.min = 0
+	h.max = 0
+}
+
+// Copy returns an independent copy of h.
+func (h *Histogram) Copy() *Histogram {
+	copied := *h
+	copied.counts = make([]uint64, len(h.counts))
+	copy(copied.counts, h.counts)
+	return &copied
+}
+
+func bucketIndex(value uint64) int {
+	shift := bits.Len64(value) - subBucketBits
+	if shift < 0 {
+		shift = 0
+	}
+	return shift*subBucketHalf + int(value>>uint(shift))
+}
+
+func highestEquivalentValue(index int) int64 {
+	if index < subBucketCount {
+		return int64(index)
+	}
+
+	shift := index/subBucketHalf - 1
+	lowest := uint64(index-shift*subBucketHalf) << uint(shift)
+	return int64(lowest + 1<<uint(shift) - 1)
+}
@@ -0,0 +1,102 @@
+package histogram_test
+
+import (
+	"time"
+
+	"github.com/myshkin5/netspel/histogram"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Histogram", func() {
+	var (
+		h *histogram.Histogram
+	)
+
+	BeforeEach(func() {
+		h = histogram.New()
+	})
+
+	within := func(expected time.Duration) OmegaMatcher {
+		return BeNumerically("~", expected, expected/1000+1)
+	}
+
+	It("returns zeros when empty", func() {
+		Expect(h.Count()).To(BeZero())
+		Expect(h.Percentile(50)).To(BeZero())
+		Expect(h.Mean()).To(BeZero())
+		Expect(h.Max()).To(BeZero())
+	})
+
+	It("tracks count, min, max and mean exactly", func() {
+		h.Record(10 * time.Microsecond)
+		h.Record(20 * time.Microsecond)
+		h.Record(3 * time.Second)
+
+		Expect(h.Count()).To(BeEquivalentTo(3))
+		Expect(h.Min()).To(Equal(10 * time.Microsecond))
+		Expect(h.Max()).To(Equal(3 * time.Second))
+		Expect(h.Mean()).To(Equal((3*time.Second + 30*time.Microsecond) / 3))
+	})
+
+	It("returns percentiles to within a tenth of a percent", func() {
+		for i := 1; i <= 10000; i++ {
+			h.Record(time.Duration(i) * time.Microsecond)
+		}
+
+		Expect(h.Percentile(50)).To(within(5000 * time.Microsecond))
+		Expect(h.Percentile(90)).To(within(9000 * time.Microsecond))
+		Expect(h.Percentile(99)).To(within(9900 * time.Microsecond))
+		Expect(h.Percentile(99.9)).To(within(9990 * time.Microsecond))
+		Expect(h.Percentile(100)).To(Equal(10000 * time.Microsecond))
+	})
+
+	It("records small values exactly", func() {
+		for i := 0; i < 100; i++ {
+			h.Record(time.Duration(i))
+		}
+
+		Expect(h.Percentile(50)).To(Equal(time.Duration(49)))
+		Expect(h.Percentile(0)).To(BeZero())
+	})
+
+	It("summarizes the commonly reported percentiles", func() {
+		for i := 0; i < 100; i++ {
+			h.Record(time.Duration(i))
+		}
+
+		Expect(h.Stats()).To(Equal(histogram.Stats{
+			Count: 100,
+			P50:   49,
+			P90:   89,
+			P99:   98,
+			P999:  99,
+			Max:   99,
+		}))
+	})
+
+	It("merges other histograms", func() {
+		other := histogram.New()
+		h.Record(time.Millisecond)
+		other.Record(time.Second)
+		other.Record(time.Microsecond)
+
+		h.Merge(other)
+
+		Expect(h.Count()).To(BeEquivalentTo(3))
+		Expect(h.Min()).To(Equal(time.Microsecond))
+		Expect(h.Max()).To(Equal(time.Second))
+		Expect(h.Percentile(50)).To(within(time.Millisecond))
+	})
+
+	It("resets and copies", func() {
+		h.Record(time.Millisecond)
+		copied := h.Copy()
+		h.Reset()
+
+		Expect(h.Count()).To(BeZero())
+		Expect(copied.Count()).To(BeEquivalentTo(1))
+		Expect(copied.Max()).To(Equal(time.Millisecond))
+	})
+})
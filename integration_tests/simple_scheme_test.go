@@ -6,6 +6,7 @@ import (
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
 	"github.com/onsi/gomega/gexec"
 )
 
@@ -44,4 +45,20 @@ var _ = Describe("simple.Scheme", func() {
 		Eventually(readerSession, 10*time.Second).Should(gexec.Exit(0))
 		Eventually(writerSession, 10*time.Second).Should(gexec.Exit(0))
 	})
+
+	It("compiles, sends and receives messages via UDP in a single process", func() {
+		executablePath, err := gexec.Build("github.com/myshkin5/netspel/netspel")
+		Expect(err).NotTo(HaveOccurred())
+
+		runCommand := exec.Command(executablePath, "--config", "./simple.json", "run")
+		runSession, err := gexec.Start(runCommand,
+			gexec.NewPrefixedWriter("\x1b[37m[o]\x1b[33m[run]\x1b[0m ", GinkgoWriter),
+			gexec.NewPrefixedWriter("\x1b[31m[e]\x1b[33m[run]\x1b[0m ", GinkgoWriter))
+		Expect(err).NotTo(HaveOccurred())
+		defer runSession.Terminate()
+
+		Eventually(runSession, 10*time.Second).Should(gexec.Exit(0))
+		Expect(runSession.Out).To(gbytes.Say("Sent"))
+		Expect(runSession.Out).To(gbytes.Say("Messages:\\s+10\\s+10"))
+	})
 })
@@ -1,6 +1,7 @@
 package logs
 
 import (
+	"io"
 	"os"
 
 	gologging "github.com/op/go-logging"
@@ -13,8 +14,20 @@ var (
 
 func init() {
 	Logger = gologging.MustGetLogger("netspel")
+	setBackend(os.Stdout)
+}
+
+// SetOutput sends the log to writer, keeping the level already set. Commands
+// writing records to standard output log to standard error instead.
+func SetOutput(writer io.Writer) {
+	level := LogLevel.GetLevel("netspel")
+	setBackend(writer)
+	LogLevel.SetLevel(level, "netspel")
+}
+
+func setBackend(writer io.Writer) {
 	format := gologging.MustStringFormatter("%{time:2006-01-02T15:04:05.000000Z} %{level} %{message}")
-	backend := gologging.NewLogBackend(os.Stdout, "", 0)
+	backend := gologging.NewLogBackend(writer, "", 0)
 	backendFormatter := gologging.NewBackendFormatter(backend, format)
 	LogLevel = gologging.AddModuleLevel(backendFormatter)
 	gologging.SetBackend(LogLevel)
@@ -0,0 +1,234 @@
+package loopback
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/factory"
+	"github.com/myshkin5/netspel/logs"
+	"github.com/myshkin5/netspel/utils"
+)
+
+const (
+	prefix = ".loopback."
+
+	DrainWait = prefix + "drain-wait"
+
+	DefaultDrainWait = time.Second
+)
+
+// ConfigKeys are read by commands running the reader and writer in one
+// process.
+var ConfigKeys = []factory.ConfigKey{
+	{Path: DrainWait, Type: factory.DurationType, Default: fmt.Sprint(DefaultDrainWait), Range: factory.AtLeast(0),
+		Doc: "How long a reader that doesn't stop on its own is given to read after the writer finishes."},
+}
+
+// Result holds each side's summary of a loopback run. A summary is nil when
+// the scheme doesn't implement factory.Summarizer.
+type Result struct {
+	Writer *factory.Summary
+	Reader *factory.Summary
+}
+
+// Run drives both the reader and the writer of a scheme in a single process.
+// The reader is started and ready to read before the writer starts writing.
+// Schemes whose readers don't stop on their own must implement io.Closer; they
+// are closed once the writer finishes and the drain wait has passed. Closing
+// stop closes a writer scheme implementing io.Closer to end the run early.
+func Run(config factory.Config, stop <-chan struct{}) (Result, error) {
+	return RunSplit(config, config, stop)
+}
+
+// RunSplit is Run with separate configurations for the writer's and the
+// reader's scheme and adapter. The types and the drain wait are taken from the
+// writer's configuration.
+func RunSplit(writerConfig, readerConfig factory.Config, stop <-chan struct{}) (Result, error) {
+	drainWait, err := writerConfig.Additional.DurationWithDefault(DrainWait, DefaultDrainWait)
+	if err != nil {
+		return Result{}, err
+	}
+
+	readerConfig.SchemeType = writerConfig.SchemeType
+	readerConfig.WriterType = writerConfig.WriterType
+	readerConfig.ReaderType = writerConfig.ReaderType
+
+	writerScheme, err := createScheme(writerConfig)
+	if err != nil {
+		return Result{}, err
+	}
+	readerScheme, err := createScheme(readerConfig)
+	if err != nil {
+		return Result{}, err
+	}
+
+	writer, reader, err := createAdapters(writerConfig, readerConfig, writerScheme, readerScheme)
+	if err != nil {
+		return Result{}, err
+	}
+
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		readerScheme.RunReader(reader)
+	}()
+
+	writerDone := make(chan struct{})
+	if closer, ok := writerScheme.(io.Closer); ok && stop != nil {
+		go func() {
+			select {
+			case <-stop:
+				err := closer.Close()
+				if err != nil {
+					logs.Logger.Warning("Error closing writer scheme, %s", err.Error())
+				}
+			case <-writerDone:
+			}
+		}()
+	}
+
+	writerScheme.RunWriter(writer)
+	close(writerDone)
+
+	if closer, ok := readerScheme.(io.Closer); ok {
+		time.Sleep(drainWait)
+		err := closer.Close()
+		if err != nil {
+			logs.Logger.Warning("Error closing reader scheme, %s", err.Error())
+		}
+	}
+	<-readerDone
+
+	return Result{
+		Writer: summarize(writerScheme),
+		Reader: summarize(readerScheme),
+	}, nil
+}
+
+// Lost returns the count of messages written but not read. It is negative when
+// more messages were read than written, e.g. when messages are duplicated.
+func (r Result) Lost() int64 {
+	if r.Writer == nil || r.Reader == nil {
+		return 0
+	}
+	return int64(r.Writer.MessageCount) - int64(r.Reader.MessageCount)
+}
+
+// LogReport logs the writer's and reader's summaries side by side.
+func LogReport(result Result) {
+	if result.Writer == nil || result.Reader == nil {
+		logs.Logger.Warning("Scheme doesn't summarize runs, no combined report available")
+		return
+	}
+
+	sent, received := result.Writer, result.Reader
+	logs.Logger.Info("%-12s %20s %20s", "", "Sent", "Received")
+	logs.Logger.Info("%-12s %20d %20d", "Messages:", sent.MessageCount, received.MessageCount)
+	logs.Logger.Info("%-12s %20d %20d", "Bytes:", sent.ByteCount, received.ByteCount)
+	logs.Logger.Info("%-12s %20d %20d", "Errors:", sent.ErrorCount, received.ErrorCount)
+	logs.Logger.Info("%-12s %20s %20s", "Run time:", sent.RunTime, received.RunTime)
+	logs.Logger.Info("%-12s %20s %20s", "Rates:", byteRate(sent)+"/s", byteRate(received)+"/s")
+	logs.Logger.Info("%-12s %20.1f %20.1f", "Messages/s:", messageRate(sent), messageRate(received))
+
+	lost := result.Lost()
+	var percent float64
+	if sent.MessageCount > 0 {
+		percent = float64(lost) / float64(sent.MessageCount) * 100
+	}
+	logs.Logger.Info("%-12s %20d messages (%.2f%%)", "Lost:", lost, percent)
+}
+
+func byteRate(summary *factory.Summary) string {
+	if summary.RunTime <= 0 {
+		return utils.ByteSize(0).String()
+	}
+	return (utils.ByteSize(summary.ByteCount) * utils.ByteSize(time.Second) / utils.ByteSize(summary.RunTime)).String()
+}
+
+func messageRate(summary *factory.Summary) float64 {
+	if summary.RunTime <= 0 {
+		return 0
+	}
+	return float64(summary.MessageCount) * float64(time.Second) / float64(summary.RunTime)
+}
+
+func createScheme(config factory.Config) (factory.Scheme, error) {
+	scheme, err := factory.CreateScheme(config.SchemeType)
+	if err != nil {
+		return nil, err
+	}
+
+	err = scheme.Init(config.Additional)
+	if err != nil {
+		return nil, err
+	}
+
+	return scheme, nil
+}
+
+// createAdapters initializes whichever side accepts connections first so that
+// the other side has something to connect to.
+func createAdapters(writerConfig, readerConfig factory.Config, writerScheme, readerScheme factory.Scheme) (factory.Writer, factory.Reader, error) {
+	writer, err := factory.CreateWriter(writerConfig.WriterType)
+	if err != nil {
+		return nil, nil, err
+	}
+	reader, err := factory.CreateReader(readerConfig.ReaderType)
+	if err != nil {
+		return nil, nil, err
+	}
+	factory.ShareMessageSizes(writerScheme, writer)
+	factory.ShareMessageSizes(readerScheme, reader)
+
+	if isListener(writer, writerConfig.Additional) {
+		err = writer.Init(writerConfig.Additional)
+		if err != nil {
+			return nil, nil, err
+		}
+		err = reader.Init(readerConfig.Additional)
+		if err != nil {
+			writer.Close()
+			return nil, nil, err
+		}
+	} else {
+		err = reader.Init(readerConfig.Additional)
+		if err != nil {
+			return nil, nil, err
+		}
+		err = writer.Init(writerConfig.Additional)
+		if err != nil {
+			reader.Close()
+			return nil, nil, err
+		}
+	}
+
+	return writer, reader, nil
+}
+
+// isListener returns whether a writer, or the writer it wraps, accepts
+// connections from its reader.
+func isListener(writer factory.Writer, config jsonstruct.JSONStruct) bool {
+	if wrapper, ok := writer.(factory.Wrapper); ok {
+		wrapped, err := factory.CreateWriter(wrapper.WrappedType(config))
+		if err != nil {
+			// Init reports the unknown type
+			return false
+		}
+		writer = wrapped
+	}
+
+	_, ok := writer.(factory.Listener)
+	return ok
+}
+
+func summarize(scheme factory.Scheme) *factory.Summary {
+	summarizer, ok := scheme.(factory.Summarizer)
+	if !ok {
+		return nil
+	}
+
+	summary := summarizer.Summary()
+	return &summary
+}
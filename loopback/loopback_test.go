@@ -0,0 +1,209 @@
+package loopback_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/myshkin5/netspel/adapters/impair"
+	"github.com/myshkin5/netspel/adapters/quic"
+	_ "github.com/myshkin5/netspel/adapters/sse"
+	"github.com/myshkin5/netspel/adapters/tcp"
+	_ "github.com/myshkin5/netspel/adapters/udp"
+	"github.com/myshkin5/netspel/adapters/unix"
+	_ "github.com/myshkin5/netspel/adapters/websocket"
+	"github.com/myshkin5/netspel/factory"
+	"github.com/myshkin5/netspel/loopback"
+	"github.com/myshkin5/netspel/payload"
+	"github.com/myshkin5/netspel/schemes/simple"
+	"github.com/myshkin5/netspel/schemes/streaming"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Loopback", func() {
+	parse := func(adapter string, port int) factory.Config {
+		config, err := factory.Parse([]byte(`{
+			"scheme-type": "simple",
+			"writer-type": "` + adapter + `",
+			"reader-type": "` + adapter + `"
+		}`))
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+
+		config.Additional.SetInt(simple.MessagesPerRun, 100)
+		config.Additional.SetInt(simple.BytesPerMessage, 100)
+		config.Additional.SetString(simple.WaitForLastMessage, "100ms")
+		config.Additional.SetInt("."+adapter+".port", port)
+		return config
+	}
+
+	It("runs a reader that accepts connections before its writer", func() {
+		result, err := loopback.Run(parse("tcp", 53101), nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(result.Writer.MessageCount).To(BeEquivalentTo(100))
+		Expect(result.Reader.MessageCount).To(BeEquivalentTo(100))
+		Expect(result.Reader.ByteCount).To(BeEquivalentTo(100 * 100))
+		Expect(result.Lost()).To(BeZero())
+	})
+
+	It("matches fixed records to the scheme's message size", func() {
+		config := parse("tcp", 53110)
+		config.Additional.SetString(tcp.Framing, "fixed")
+
+		result, err := loopback.Run(config, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(result.Reader.MessageCount).To(BeEquivalentTo(100))
+		Expect(result.Reader.ByteCount).To(BeEquivalentTo(100 * 100))
+		Expect(result.Lost()).To(BeZero())
+	})
+
+	It("delimits messages containing newlines", func() {
+		config := parse("tcp", 53111)
+		config.Additional.SetString(tcp.Framing, "newline")
+		config.Additional.SetString(simple.SequenceHeader, "true")
+		config.Additional.SetString(payload.Type, payload.Random)
+
+		result, err := loopback.Run(config, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(result.Writer.ErrorCount).To(BeZero())
+		Expect(result.Reader.MessageCount).To(BeEquivalentTo(100))
+		Expect(result.Reader.ByteCount).To(BeEquivalentTo(100 * 100))
+		Expect(result.Lost()).To(BeZero())
+	})
+
+	It("runs a writer that accepts connections before its reader", func() {
+		result, err := loopback.Run(parse("sse", 53102), nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(result.Writer.MessageCount).To(BeEquivalentTo(100))
+		Expect(result.Reader.MessageCount).To(BeEquivalentTo(100))
+		Expect(result.Lost()).To(BeZero())
+	})
+
+	It("runs an impaired writer that accepts connections before its reader", func() {
+		config := parse("sse", 53112)
+		config.WriterType = "impair"
+		config.Additional.SetString(impair.WriterType, "sse")
+
+		result, err := loopback.Run(config, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(result.Writer.MessageCount).To(BeEquivalentTo(100))
+		Expect(result.Reader.MessageCount).To(BeEquivalentTo(100))
+		Expect(result.Lost()).To(BeZero())
+	})
+
+	It("runs a websocket writer that accepts connections before its reader", func() {
+		result, err := loopback.Run(parse("websocket", 53107), nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(result.Writer.MessageCount).To(BeEquivalentTo(100))
+		Expect(result.Reader.MessageCount).To(BeEquivalentTo(100))
+		Expect(result.Lost()).To(BeZero())
+	})
+
+	It("runs QUIC over parallel streams", func() {
+		config := parse("quic", 53108)
+		config.Additional.SetInt(quic.Streams, 4)
+
+		result, err := loopback.Run(config, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(result.Writer.MessageCount).To(BeEquivalentTo(100))
+		Expect(result.Reader.MessageCount).To(BeEquivalentTo(100))
+		Expect(result.Lost()).To(BeZero())
+	})
+
+	It("runs each type of unix domain socket", func() {
+		dir, err := ioutil.TempDir("", "netspel")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		for _, socketType := range []string{unix.Stream, unix.Datagram, unix.SeqPacket} {
+			config := parse("unix", 0)
+			config.Additional.SetString(unix.Path, filepath.Join(dir, "netspel.sock"))
+			config.Additional.SetString(unix.Type, socketType)
+
+			result, err := loopback.Run(config, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(result.Writer.MessageCount).To(BeEquivalentTo(100))
+			Expect(result.Reader.MessageCount).To(BeEquivalentTo(100))
+			Expect(result.Lost()).To(BeZero())
+		}
+	})
+
+	It("runs connectionless adapters", func() {
+		result, err := loopback.Run(parse("udp", 53103), nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(result.Writer.MessageCount).To(BeEquivalentTo(100))
+		Expect(result.Reader.MessageCount).To(BeNumerically(">", 0))
+	})
+
+	It("stops a simple reader that never reads a message", func() {
+		config := parse("udp", 53109)
+		config.WriterType = "impair"
+		config.Additional.SetString(impair.WriterType, "udp")
+		config.Additional.SetString(impair.Loss, "1")
+		config.Additional.SetString(loopback.DrainWait, "10ms")
+
+		result, err := loopback.Run(config, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(result.Writer.MessageCount).To(BeEquivalentTo(100))
+		Expect(result.Reader.MessageCount).To(BeZero())
+		Expect(result.Lost()).To(BeEquivalentTo(100))
+	})
+
+	It("closes readers that don't stop on their own", func() {
+		config := parse("tcp", 53105)
+		config.SchemeType = "streaming"
+		config.Additional.SetInt(streaming.MessagesPerSecond, 0)
+		config.Additional.SetInt(streaming.MaxMessages, 1000)
+		config.Additional.SetInt(streaming.BytesPerMessage, 100)
+		config.Additional.SetString(loopback.DrainWait, "100ms")
+
+		result, err := loopback.Run(config, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(result.Writer.MessageCount).To(BeEquivalentTo(1000))
+		Expect(result.Reader.MessageCount).To(BeEquivalentTo(1000))
+	})
+
+	It("stops the writer early when told to", func() {
+		config := parse("udp", 53106)
+		config.SchemeType = "streaming"
+		config.Additional.SetString(loopback.DrainWait, "10ms")
+
+		stop := make(chan struct{})
+		close(stop)
+
+		result, err := loopback.Run(config, stop)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Writer).NotTo(BeNil())
+		Expect(result.Reader).NotTo(BeNil())
+	})
+
+	It("returns an error for unknown types", func() {
+		config := parse("udp", 53104)
+		config.WriterType = "not-there"
+
+		_, err := loopback.Run(config, nil)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("computes lost messages", func() {
+		result := loopback.Result{
+			Writer: &factory.Summary{MessageCount: 100},
+			Reader: &factory.Summary{MessageCount: 90},
+		}
+
+		Expect(result.Lost()).To(BeEquivalentTo(10))
+		Expect(loopback.Result{}.Lost()).To(BeZero())
+	})
+})
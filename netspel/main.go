@@ -2,30 +2,35 @@ package main
 
 import (
 	"fmt"
-	"reflect"
+	"io"
+	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
+	"text/tabwriter"
 
 	"github.com/codegangsta/cli"
-	"github.com/myshkin5/netspel/adapters/sse"
-	"github.com/myshkin5/netspel/adapters/udp"
 	"github.com/myshkin5/netspel/factory"
 	"github.com/myshkin5/netspel/logs"
-	"github.com/myshkin5/netspel/schemes/simple"
-	"github.com/myshkin5/netspel/schemes/streaming"
+	"github.com/myshkin5/netspel/loopback"
+	"github.com/myshkin5/netspel/proxy"
+	"github.com/myshkin5/netspel/results"
+	"github.com/myshkin5/netspel/search"
 	"github.com/op/go-logging"
-)
-
-func init() {
-	factory.WriterManager.RegisterType("udp", reflect.TypeOf(udp.Writer{}))
-	factory.ReaderManager.RegisterType("udp", reflect.TypeOf(udp.Reader{}))
 
-	factory.WriterManager.RegisterType("sse", reflect.TypeOf(sse.Writer{}))
-	factory.ReaderManager.RegisterType("sse", reflect.TypeOf(sse.Reader{}))
-
-	factory.SchemeManager.RegisterType("simple", reflect.TypeOf(simple.Scheme{}))
-	factory.SchemeManager.RegisterType("streaming", reflect.TypeOf(streaming.Scheme{}))
-}
+	// Writers, readers and schemes register themselves when imported
+	_ "github.com/myshkin5/netspel/adapters/impair"
+	_ "github.com/myshkin5/netspel/adapters/quic"
+	_ "github.com/myshkin5/netspel/adapters/sse"
+	_ "github.com/myshkin5/netspel/adapters/tcp"
+	_ "github.com/myshkin5/netspel/adapters/udp"
+	_ "github.com/myshkin5/netspel/adapters/unix"
+	_ "github.com/myshkin5/netspel/adapters/websocket"
+	_ "github.com/myshkin5/netspel/schemes/pingpong"
+	_ "github.com/myshkin5/netspel/schemes/simple"
+	_ "github.com/myshkin5/netspel/schemes/streaming"
+)
 
 func main() {
 	app := cli.NewApp()
@@ -80,6 +85,42 @@ func main() {
 				read(context)
 			},
 		},
+		cli.Command{
+			Name:  "run",
+			Usage: "write and read messages in a single process",
+			Action: func(context *cli.Context) {
+				run(context)
+			},
+		},
+		cli.Command{
+			Name:  "search",
+			Usage: "search for the maximum rate within a loss tolerance",
+			Action: func(context *cli.Context) {
+				runSearch(context)
+			},
+		},
+		cli.Command{
+			Name:  "list",
+			Usage: "list the registered writers, readers and schemes",
+			Action: func(context *cli.Context) {
+				list()
+			},
+		},
+		cli.Command{
+			Name:      "describe",
+			Usage:     "describe a writer, reader or scheme and the configuration it reads",
+			ArgsUsage: "<type>",
+			Action: func(context *cli.Context) {
+				describe(context)
+			},
+		},
+		cli.Command{
+			Name:  "proxy",
+			Usage: "forward UDP datagrams or TCP connections to another port with impairments",
+			Action: func(context *cli.Context) {
+				runProxy(context)
+			},
+		},
 	}
 
 	app.RunAndExitOnError()
@@ -89,6 +130,9 @@ func write(context *cli.Context) {
 	initLogs(context)
 
 	config := config(context)
+	validate(context, config)
+	initResults(config)
+	defer closeResults()
 	scheme := scheme(config, context)
 
 	writer, err := factory.CreateWriter(config.WriterType)
@@ -96,12 +140,14 @@ func write(context *cli.Context) {
 		panic(err)
 	}
 
+	factory.ShareMessageSizes(scheme, writer)
 	err = writer.Init(config.Additional)
 	if err != nil {
 		cli.ShowAppHelp(context)
 		panic(err)
 	}
 
+	closeOnSignal(scheme)
 	scheme.RunWriter(writer)
 }
 
@@ -109,6 +155,9 @@ func read(context *cli.Context) {
 	initLogs(context)
 
 	config := config(context)
+	validate(context, config)
+	initResults(config)
+	defer closeResults()
 	scheme := scheme(config, context)
 
 	reader, err := factory.CreateReader(config.ReaderType)
@@ -117,14 +166,210 @@ func read(context *cli.Context) {
 		panic(err)
 	}
 
+	factory.ShareMessageSizes(scheme, reader)
 	err = reader.Init(config.Additional)
 	if err != nil {
 		panic(err)
 	}
 
+	closeOnSignal(scheme)
 	scheme.RunReader(reader)
 }
 
+func run(context *cli.Context) {
+	initLogs(context)
+
+	config := config(context)
+	validate(context, config)
+	initResults(config)
+	defer closeResults()
+
+	var stop chan struct{}
+	probe, err := factory.CreateScheme(config.SchemeType)
+	if _, ok := probe.(io.Closer); ok && err == nil {
+		stop = make(chan struct{})
+		go func() {
+			<-interrupted()
+			close(stop)
+		}()
+	}
+
+	result, err := loopback.Run(config, stop)
+	if err != nil {
+		cli.ShowAppHelp(context)
+		panic(err)
+	}
+
+	loopback.LogReport(result)
+}
+
+func runSearch(context *cli.Context) {
+	initLogs(context)
+
+	config := config(context)
+	if config.SchemeType == "" {
+		config.SchemeType = search.SchemeType
+	}
+	validate(context, config)
+	initResults(config)
+	defer closeResults()
+
+	stop := make(chan struct{})
+	go func() {
+		<-interrupted()
+		close(stop)
+	}()
+
+	result, err := search.Run(config, stop)
+	if err != nil {
+		cli.ShowAppHelp(context)
+		panic(err)
+	}
+
+	search.LogReport(result)
+}
+
+func runProxy(context *cli.Context) {
+	initLogs(context)
+
+	config := config(context)
+	validate(context, config)
+
+	p, err := proxy.New(config.Additional)
+	if err != nil {
+		cli.ShowAppHelp(context)
+		panic(err)
+	}
+
+	<-interrupted()
+	err = p.Close()
+	if err != nil {
+		logs.Logger.Warning("Error closing proxy, %s", err.Error())
+	}
+
+	for _, stat := range p.Stats() {
+		logs.Logger.Info("%d %s", stat.Value, stat.Name)
+	}
+}
+
+var kinds = []struct {
+	kind  factory.Kind
+	title string
+}{
+	{factory.KindWriter, "Writers"},
+	{factory.KindReader, "Readers"},
+	{factory.KindScheme, "Schemes"},
+}
+
+func list() {
+	out := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for i, k := range kinds {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		fmt.Fprintf(out, "%s:\n", k.title)
+		for _, descriptor := range factory.DefaultRegistry.Descriptors(k.kind) {
+			fmt.Fprintf(out, "  %s\t%s\n", descriptor.Name, descriptor.Description)
+		}
+	}
+	out.Flush()
+}
+
+// describe prints every registered type with the given name, such as both
+// the udp writer and the udp reader, along with the configuration each reads.
+func describe(context *cli.Context) {
+	name := context.Args().First()
+
+	var descriptors []factory.Descriptor
+	for _, k := range kinds {
+		descriptor, ok := factory.DefaultRegistry.Describe(k.kind, name)
+		if ok {
+			descriptors = append(descriptors, descriptor)
+		}
+	}
+	if len(descriptors) == 0 {
+		cli.ShowCommandHelp(context, "describe")
+		panic(fmt.Errorf("Type not found, %s", name))
+	}
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for i, descriptor := range descriptors {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		fmt.Fprintf(out, "%s %s: %s\n", descriptor.Name, descriptor.Kind, descriptor.Description)
+		if len(descriptor.Config) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(out, "\n  Dot path\tType\tDefault\tDescription\n")
+		for _, key := range descriptor.Config {
+			fmt.Fprintf(out, "  %s\t%s\t%s\t%s\n", key.Path, key.Type, defaultOf(key), docOf(key))
+		}
+	}
+	out.Flush()
+}
+
+func defaultOf(key factory.ConfigKey) string {
+	switch {
+	case key.Required:
+		return "required"
+	case key.Default == "":
+		return "none"
+	default:
+		return key.Default
+	}
+}
+
+func docOf(key factory.ConfigKey) string {
+	doc := key.Doc
+	if len(key.Values) > 0 {
+		doc += fmt.Sprintf(" One of %s.", strings.Join(key.Values, ", "))
+	}
+	if key.Range != nil {
+		doc += fmt.Sprintf(" Must be %s.", key.Range)
+	}
+	if key.Names != "" {
+		doc += fmt.Sprintf(" The %s's keys are also read.", key.Names)
+	}
+	return doc
+}
+
+// closeOnSignal closes schemes that can be stopped early when the process is
+// interrupted, letting them report before exiting. Other schemes are killed by
+// the signal as usual.
+func closeOnSignal(scheme factory.Scheme) {
+	closer, ok := scheme.(io.Closer)
+	if !ok {
+		return
+	}
+
+	go func() {
+		<-interrupted()
+		err := closer.Close()
+		if err != nil {
+			logs.Logger.Warning("Error closing scheme, %s", err.Error())
+		}
+	}()
+}
+
+// interrupted returns a channel receiving the first SIGINT or SIGTERM. Later
+// signals kill the process.
+func interrupted() <-chan os.Signal {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	first := make(chan os.Signal, 1)
+	go func() {
+		sig := <-signals
+		signal.Stop(signals)
+		logs.Logger.Info("Received %s, stopping...", sig)
+		first <- sig
+	}()
+
+	return first
+}
+
 func initLogs(context *cli.Context) {
 	level, err := logging.LogLevel(context.GlobalString("log-level"))
 	if err != nil {
@@ -134,6 +379,20 @@ func initLogs(context *cli.Context) {
 	logs.LogLevel.SetLevel(level, "netspel")
 }
 
+func initResults(config factory.Config) {
+	err := results.Init(config)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func closeResults() {
+	err := results.Close()
+	if err != nil {
+		logs.Logger.Warning("Error closing results, %s", err.Error())
+	}
+}
+
 func config(context *cli.Context) factory.Config {
 	configPath := context.GlobalString("config")
 	var config factory.Config
@@ -195,6 +454,22 @@ func parseAssignment(assignment string) ([]string, error) {
 	return keyValue, nil
 }
 
+// validate checks the configuration against the keys read by the configured
+// types and by the commands, so that a shared configuration file can be used
+// with any command.
+func validate(context *cli.Context, config factory.Config) {
+	var keys []factory.ConfigKey
+	for _, extra := range [][]factory.ConfigKey{results.ConfigKeys, loopback.ConfigKeys, search.ConfigKeys, proxy.ConfigKeys} {
+		keys = append(keys, extra...)
+	}
+
+	err := factory.Validate(config, keys)
+	if err != nil {
+		cli.ShowAppHelp(context)
+		panic(err)
+	}
+}
+
 func scheme(config factory.Config, context *cli.Context) factory.Scheme {
 	scheme, err := factory.CreateScheme(config.SchemeType)
 	if err != nil {
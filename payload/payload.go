@@ -0,0 +1,223 @@
+package payload
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/factory"
+	"github.com/myshkin5/netspel/utils"
+)
+
+const (
+	prefix = ".payload."
+
+	Type            = prefix + "type"
+	Seed            = prefix + "seed"
+	Pattern         = prefix + "pattern"
+	Compressibility = prefix + "compressibility"
+	Path            = prefix + "path"
+
+	DefaultType            = Zeros
+	DefaultSeed            = 1
+	DefaultPattern         = "netspel "
+	DefaultCompressibility = 0.5
+	DefaultPath            = ""
+
+	Zeros        = "zeros"
+	Random       = "random"
+	Text         = "text"
+	Compressible = "compressible"
+	File         = "file"
+	Corpus       = "corpus"
+
+	// blockSize is the span over which the compressible generator mixes
+	// random and repeated bytes, well within a compressor's window
+	blockSize = 256
+)
+
+// ConfigKeys are read by schemes that fill messages with a payload.
+var ConfigKeys = []factory.ConfigKey{
+	{Path: Type, Type: factory.StringType, Default: DefaultType, Values: []string{Zeros, Random, Text, Compressible, File, Corpus},
+		Doc: "The payload generator filling each message."},
+	{Path: Seed, Type: factory.IntType, Default: fmt.Sprint(DefaultSeed),
+		Doc: "The seed of the random and compressible payloads."},
+	{Path: Pattern, Type: factory.StringType, Default: DefaultPattern,
+		Doc: "The text repeated by the text payload."},
+	{Path: Compressibility, Type: factory.FloatType, Default: fmt.Sprint(DefaultCompressibility), Range: factory.Between(0, 1),
+		Doc: "The fraction of each message a compressor removes, from 0 for incompressible to 1 for all zeros."},
+	{Path: Path, Type: factory.StringType,
+		Doc: "The file read by the file and corpus payloads. Required by both."},
+}
+
+// Generator fills messages with a payload. Successive calls continue the
+// payload so messages differ unless the payload is all zeros. The sequence
+// header, when enabled, is stamped over the start of the payload.
+type Generator interface {
+	Fill(message []byte)
+}
+
+func New(config jsonstruct.JSONStruct) (Generator, error) {
+	payloadType := config.StringWithDefault(Type, DefaultType)
+	switch payloadType {
+	case Zeros:
+		return zeros{}, nil
+	case Random:
+		return newRandom(config), nil
+	case Text:
+		pattern := config.StringWithDefault(Pattern, DefaultPattern)
+		if pattern == "" {
+			return nil, errors.New("Text pattern must not be empty")
+		}
+		return &repeating{source: []byte(pattern)}, nil
+	case Compressible:
+		return newCompressible(config)
+	case File:
+		source, err := readSource(config)
+		if err != nil {
+			return nil, err
+		}
+		return &repeating{source: source}, nil
+	case Corpus:
+		source, err := readSource(config)
+		if err != nil {
+			return nil, err
+		}
+		return newCorpus(source)
+	default:
+		return nil, fmt.Errorf("Unknown payload type, %s", payloadType)
+	}
+}
+
+// Static reports whether a generator fills every message the same, so a
+// buffer filled once needs no refilling before each write.
+func Static(generator Generator) bool {
+	_, ok := generator.(zeros)
+	return ok
+}
+
+type zeros struct{}
+
+func (zeros) Fill(message []byte) {
+	for i := range message {
+		message[i] = 0
+	}
+}
+
+type random struct {
+	rand *rand.Rand
+}
+
+func newRandom(config jsonstruct.JSONStruct) *random {
+	return &random{rand: rand.New(rand.NewSource(int64(config.IntWithDefault(Seed, DefaultSeed))))}
+}
+
+func (g *random) Fill(message []byte) {
+	g.rand.Read(message)
+}
+
+// repeating fills messages from a source repeated end to end, each message
+// starting where the previous one ended.
+type repeating struct {
+	source []byte
+	offset int
+}
+
+func (g *repeating) Fill(message []byte) {
+	for filled := 0; filled < len(message); {
+		count := copy(message[filled:], g.source[g.offset:])
+		filled += count
+		g.offset = (g.offset + count) % len(g.source)
+	}
+}
+
+// compressible starts each block with random bytes and repeats a single byte
+// for the rest, so a compressor shrinks the block by about the ratio.
+type compressible struct {
+	random      *random
+	randomBytes int
+}
+
+func newCompressible(config jsonstruct.JSONStruct) (*compressible, error) {
+	ratio, err := utils.Float64WithDefault(config, Compressibility, DefaultCompressibility)
+	if err != nil {
+		return nil, err
+	}
+	if ratio < 0 || ratio > 1 {
+		return nil, fmt.Errorf("Compressibility must be between 0 and 1, %g", ratio)
+	}
+
+	return &compressible{
+		random:      newRandom(config),
+		randomBytes: int(float64(blockSize)*(1-ratio) + 0.5),
+	}, nil
+}
+
+func (g *compressible) Fill(message []byte) {
+	for start := 0; start < len(message); start += blockSize {
+		block := message[start:]
+		if len(block) > blockSize {
+			block = block[:blockSize]
+		}
+
+		randomBytes := g.randomBytes
+		if randomBytes > len(block) {
+			randomBytes = len(block)
+		}
+		g.random.Fill(block[:randomBytes])
+		for i := randomBytes; i < len(block); i++ {
+			block[i] = 0
+		}
+	}
+}
+
+// corpus starts each message with the next line of the corpus and follows it
+// with as many more lines, newline separated, as fit. The last line is cut
+// short at the end of the message.
+type corpus struct {
+	lines [][]byte
+	next  int
+}
+
+func newCorpus(source []byte) (*corpus, error) {
+	var lines [][]byte
+	for _, line := range bytes.Split(source, []byte("\n")) {
+		if len(line) > 0 {
+			lines = append(lines, append(line, '\n'))
+		}
+	}
+	if len(lines) == 0 {
+		return nil, errors.New("Corpus has no lines")
+	}
+
+	return &corpus{lines: lines}, nil
+}
+
+func (g *corpus) Fill(message []byte) {
+	start := g.next
+	for filled := 0; filled < len(message); {
+		filled += copy(message[filled:], g.lines[g.next])
+		g.next = (g.next + 1) % len(g.lines)
+	}
+	g.next = (start + 1) % len(g.lines)
+}
+
+func readSource(config jsonstruct.JSONStruct) ([]byte, error) {
+	path := config.StringWithDefault(Path, DefaultPath)
+	if path == "" {
+		return nil, fmt.Errorf("A path is required for %s payloads", config.StringWithDefault(Type, DefaultType))
+	}
+
+	source, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(source) == 0 {
+		return nil, fmt.Errorf("Payload file is empty, %s", path)
+	}
+
+	return source, nil
+}
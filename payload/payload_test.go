@@ -0,0 +1,170 @@
+package payload_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/payload"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Payload", func() {
+	var (
+		config  jsonstruct.JSONStruct
+		message []byte
+		dir     string
+	)
+
+	BeforeEach(func() {
+		config = jsonstruct.New()
+		message = make([]byte, 10)
+
+		var err error
+		dir, err = ioutil.TempDir("", "payload")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	newGenerator := func() payload.Generator {
+		generator, err := payload.New(config)
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+		return generator
+	}
+
+	writeFile := func(contents string) string {
+		path := filepath.Join(dir, "payload.txt")
+		ExpectWithOffset(1, ioutil.WriteFile(path, []byte(contents), 0644)).To(Succeed())
+		return path
+	}
+
+	It("fills messages with zeros by default", func() {
+		copy(message, "dirty")
+		newGenerator().Fill(message)
+		Expect(message).To(Equal(make([]byte, 10)))
+	})
+
+	It("reports only the zeros payload as static", func() {
+		Expect(payload.Static(newGenerator())).To(BeTrue())
+
+		config.SetString(payload.Type, payload.Random)
+		Expect(payload.Static(newGenerator())).To(BeFalse())
+	})
+
+	It("fills messages with pseudo-random bytes repeatable by seed", func() {
+		config.SetString(payload.Type, payload.Random)
+		config.SetInt(payload.Seed, 42)
+
+		first := newGenerator()
+		first.Fill(message)
+		Expect(message).NotTo(Equal(make([]byte, 10)))
+
+		again := make([]byte, 10)
+		newGenerator().Fill(again)
+		Expect(again).To(Equal(message))
+
+		first.Fill(again)
+		Expect(again).NotTo(Equal(message))
+	})
+
+	It("repeats a text pattern across messages", func() {
+		config.SetString(payload.Type, payload.Text)
+		config.SetString(payload.Pattern, "abcd")
+
+		generator := newGenerator()
+		generator.Fill(message)
+		Expect(string(message)).To(Equal("abcdabcdab"))
+		generator.Fill(message)
+		Expect(string(message)).To(Equal("cdabcdabcd"))
+	})
+
+	It("rejects an empty text pattern", func() {
+		config.SetString(payload.Type, payload.Text)
+		config.SetString(payload.Pattern, "")
+
+		_, err := payload.New(config)
+		Expect(err).To(MatchError("Text pattern must not be empty"))
+	})
+
+	It("fills messages to a target compressibility", func() {
+		config.SetString(payload.Type, payload.Compressible)
+		for _, ratio := range []float64{0, 0.25, 0.5, 0.9} {
+			config.SetString(payload.Compressibility, strconv.FormatFloat(ratio, 'g', -1, 64))
+
+			message := make([]byte, 64*1024)
+			newGenerator().Fill(message)
+
+			compressed := &bytes.Buffer{}
+			compressor, err := flate.NewWriter(compressed, flate.BestCompression)
+			Expect(err).NotTo(HaveOccurred())
+			compressor.Write(message)
+			compressor.Close()
+
+			saved := 1 - float64(compressed.Len())/float64(len(message))
+			Expect(saved).To(BeNumerically("~", ratio, 0.05), "ratio %g", ratio)
+		}
+	})
+
+	It("rejects a compressibility out of range", func() {
+		config.SetString(payload.Type, payload.Compressible)
+		config.SetString(payload.Compressibility, "1.5")
+
+		_, err := payload.New(config)
+		Expect(err).To(MatchError("Compressibility must be between 0 and 1, 1.5"))
+	})
+
+	It("repeats the contents of a file", func() {
+		config.SetString(payload.Type, payload.File)
+		config.SetString(payload.Path, writeFile("0123456"))
+
+		generator := newGenerator()
+		generator.Fill(message)
+		Expect(string(message)).To(Equal("0123456012"))
+		generator.Fill(message)
+		Expect(string(message)).To(Equal("3456012345"))
+	})
+
+	It("starts each message with the next line of a corpus", func() {
+		config.SetString(payload.Type, payload.Corpus)
+		config.SetString(payload.Path, writeFile("one\ntwo\n\nthree\n"))
+
+		generator := newGenerator()
+		generator.Fill(message)
+		Expect(string(message)).To(Equal("one\ntwo\nth"))
+		generator.Fill(message)
+		Expect(string(message)).To(Equal("two\nthree\n"))
+		generator.Fill(message)
+		Expect(string(message)).To(Equal("three\none\n"))
+	})
+
+	It("requires a path for files", func() {
+		config.SetString(payload.Type, payload.Corpus)
+
+		_, err := payload.New(config)
+		Expect(err).To(MatchError("A path is required for corpus payloads"))
+	})
+
+	It("rejects a corpus without lines", func() {
+		config.SetString(payload.Type, payload.Corpus)
+		config.SetString(payload.Path, writeFile("\n\n"))
+
+		_, err := payload.New(config)
+		Expect(err).To(MatchError("Corpus has no lines"))
+	})
+
+	It("rejects an unknown type", func() {
+		config.SetString(payload.Type, "emoji")
+
+		_, err := payload.New(config)
+		Expect(err).To(MatchError("Unknown payload type, emoji"))
+	})
+})
@@ -0,0 +1,236 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/adapters/impair"
+	"github.com/myshkin5/netspel/factory"
+	"github.com/myshkin5/netspel/logs"
+)
+
+const (
+	prefix = ".proxy."
+
+	Network         = prefix + "network"
+	Port            = prefix + "port"
+	TargetAddr      = prefix + "target-addr"
+	TargetPort      = prefix + "target-port"
+	Direction       = prefix + "direction"
+	RetransmitDelay = prefix + "retransmit-delay"
+
+	DefaultNetwork         = TCP
+	DefaultPort            = 57959
+	DefaultTargetAddr      = "localhost"
+	DefaultTargetPort      = 0
+	DefaultDirection       = Both
+	DefaultRetransmitDelay = 200 * time.Millisecond
+
+	TCP = "tcp"
+	UDP = "udp"
+
+	Both    = "both"
+	Forward = "forward"
+	Reverse = "reverse"
+)
+
+// ConfigKeys are read by the proxy. The impairments are those of the impair
+// writer, whose writer type the proxy ignores.
+var ConfigKeys = append([]factory.ConfigKey{
+	{Path: Network, Type: factory.StringType, Default: DefaultNetwork, Values: []string{TCP, UDP},
+		Doc: "The network proxied. tcp is also used for HTTP."},
+	{Path: Port, Type: factory.IntType, Default: fmt.Sprint(DefaultPort), Range: factory.Between(0, 65535),
+		Doc: "The port on which the proxy listens."},
+	{Path: TargetAddr, Type: factory.StringType, Default: DefaultTargetAddr,
+		Doc: "The address traffic is forwarded to."},
+	{Path: TargetPort, Type: factory.IntType, Range: factory.Between(1, 65535),
+		Doc: "The port traffic is forwarded to. Required by the proxy."},
+	{Path: Direction, Type: factory.StringType, Default: DefaultDirection, Values: []string{Both, Forward, Reverse},
+		Doc: "The directions impaired."},
+	{Path: RetransmitDelay, Type: factory.DurationType, Default: fmt.Sprint(DefaultRetransmitDelay), Range: factory.AtLeast(0),
+		Doc: "The extra delay of TCP bytes that would be lost."},
+}, impairments()...)
+
+// Proxy forwards UDP datagrams or TCP connections accepted on one port to a
+// target, impairing them as configured under .impair. Traffic from clients to
+// the target is forwarded and replies from the target are reversed; either
+// or both directions may be impaired.
+type Proxy struct {
+	network         string
+	target          string
+	config          jsonstruct.JSONStruct
+	forward         bool
+	reverse         bool
+	retransmitDelay time.Duration
+
+	addr  net.Addr
+	stop  func() error
+	done  sync.WaitGroup
+	mutex sync.Mutex
+	conns map[net.Conn]struct{}
+	names []string
+	stats map[string]uint64
+}
+
+// New starts a proxy which runs until it is closed.
+func New(config jsonstruct.JSONStruct) (*Proxy, error) {
+	p := &Proxy{
+		network: config.StringWithDefault(Network, DefaultNetwork),
+		config:  config,
+		conns:   make(map[net.Conn]struct{}),
+		stats:   make(map[string]uint64),
+	}
+
+	targetPort := config.IntWithDefault(TargetPort, DefaultTargetPort)
+	if targetPort == 0 {
+		return nil, fmt.Errorf("A target port is required, %s", TargetPort)
+	}
+	p.target = net.JoinHostPort(config.StringWithDefault(TargetAddr, DefaultTargetAddr), strconv.Itoa(targetPort))
+
+	direction := config.StringWithDefault(Direction, DefaultDirection)
+	switch direction {
+	case Both:
+		p.forward, p.reverse = true, true
+	case Forward:
+		p.forward = true
+	case Reverse:
+		p.reverse = true
+	default:
+		return nil, fmt.Errorf("Unknown proxy direction, %s", direction)
+	}
+
+	var err error
+	p.retransmitDelay, err = config.DurationWithDefault(RetransmitDelay, DefaultRetransmitDelay)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the impairments before accepting any traffic
+	check, err := p.impair(nopCloser{ioutil.Discard}, true)
+	if err != nil {
+		return nil, err
+	}
+	check.Close()
+
+	address := net.JoinHostPort("", strconv.Itoa(config.IntWithDefault(Port, DefaultPort)))
+	switch p.network {
+	case TCP:
+		err = p.listenTCP(address)
+	case UDP:
+		err = p.listenUDP(address)
+	default:
+		return nil, fmt.Errorf("Unknown proxy network, %s", p.network)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	logs.Logger.Info("Proxying %s from %s to %s, impairing %s", p.network, p.addr, p.target, direction)
+	return p, nil
+}
+
+func (p *Proxy) Addr() net.Addr {
+	return p.addr
+}
+
+// Close stops accepting traffic and closes open connections. TCP traffic
+// still delayed is dropped while UDP traffic is forwarded first.
+func (p *Proxy) Close() error {
+	err := p.stop()
+
+	p.mutex.Lock()
+	for conn := range p.conns {
+		conn.Close()
+	}
+	p.mutex.Unlock()
+
+	p.done.Wait()
+	return err
+}
+
+// Stats returns the counts of impaired traffic in each direction of the
+// connections closed so far.
+func (p *Proxy) Stats() []factory.Stat {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	stats := make([]factory.Stat, len(p.names))
+	for i, name := range p.names {
+		stats[i] = factory.Stat{Name: name, Value: p.stats[name]}
+	}
+	return stats
+}
+
+// impair wraps one direction of a connection when that direction is
+// impaired.
+func (p *Proxy) impair(inner io.WriteCloser, impaired bool) (io.WriteCloser, error) {
+	if !impaired {
+		return inner, nil
+	}
+	if p.network == TCP {
+		return impair.WrapStream(inner, p.config, p.retransmitDelay)
+	}
+	return impair.Wrap(inner, p.config)
+}
+
+// closeDirection closes one direction of a connection, adding the counts of
+// its impaired traffic to the proxy's stats.
+func (p *Proxy) closeDirection(direction string, writer io.WriteCloser) {
+	err := writer.Close()
+	if err != nil {
+		logs.Logger.Debug("Error closing %s direction, %v", direction, err)
+	}
+
+	collector, ok := writer.(factory.StatsCollector)
+	if !ok {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, stat := range collector.Stats() {
+		name := direction + " " + stat.Name
+		if _, ok := p.stats[name]; !ok {
+			p.names = append(p.names, name)
+		}
+		p.stats[name] += stat.Value
+	}
+}
+
+func (p *Proxy) track(conn net.Conn) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.conns[conn] = struct{}{}
+}
+
+func (p *Proxy) untrack(conn net.Conn) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	delete(p.conns, conn)
+}
+
+// impairments returns the impair writer's keys without requiring a writer
+// type.
+func impairments() []factory.ConfigKey {
+	keys := make([]factory.ConfigKey, len(impair.ConfigKeys))
+	for i, key := range impair.ConfigKeys {
+		key.Required = false
+		key.Names = ""
+		keys[i] = key
+	}
+	return keys
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
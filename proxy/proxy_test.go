@@ -0,0 +1,205 @@
+package proxy_test
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"time"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/adapters/impair"
+	"github.com/myshkin5/netspel/factory"
+	"github.com/myshkin5/netspel/proxy"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Proxy", func() {
+	var (
+		config jsonstruct.JSONStruct
+		p      *proxy.Proxy
+	)
+
+	BeforeEach(func() {
+		config = jsonstruct.New()
+		config.SetInt(proxy.Port, 0)
+		p = nil
+	})
+
+	AfterEach(func() {
+		if p != nil {
+			Expect(p.Close()).To(Succeed())
+		}
+	})
+
+	It("requires a target port", func() {
+		_, err := proxy.New(config)
+		Expect(err).To(MatchError(ContainSubstring("A target port is required")))
+	})
+
+	It("rejects an unknown direction", func() {
+		config.SetInt(proxy.TargetPort, 51170)
+		config.SetString(proxy.Direction, "sideways")
+		_, err := proxy.New(config)
+		Expect(err).To(MatchError("Unknown proxy direction, sideways"))
+	})
+
+	It("rejects impairments a stream can't have", func() {
+		config.SetInt(proxy.TargetPort, 51170)
+		config.SetString(impair.Duplicate, "0.1")
+		_, err := proxy.New(config)
+		Expect(err).To(HaveOccurred())
+	})
+
+	Context("UDP", func() {
+		var echo *net.UDPConn
+
+		BeforeEach(func() {
+			var err error
+			echo, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			Expect(err).NotTo(HaveOccurred())
+			go func() {
+				buffer := make([]byte, 1024)
+				for {
+					count, addr, err := echo.ReadFromUDP(buffer)
+					if err != nil {
+						return
+					}
+					echo.WriteToUDP(buffer[:count], addr)
+				}
+			}()
+
+			config.SetString(proxy.Network, proxy.UDP)
+			config.SetString(proxy.TargetAddr, "127.0.0.1")
+			config.SetInt(proxy.TargetPort, echo.LocalAddr().(*net.UDPAddr).Port)
+		})
+
+		AfterEach(func() {
+			echo.Close()
+		})
+
+		dial := func() net.Conn {
+			conn, err := net.Dial("udp", net.JoinHostPort("127.0.0.1", portOf(p.Addr())))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conn.SetReadDeadline(time.Now().Add(time.Second))).To(Succeed())
+			return conn
+		}
+
+		It("returns replies to the client", func() {
+			var err error
+			p, err = proxy.New(config)
+			Expect(err).NotTo(HaveOccurred())
+
+			conn := dial()
+			defer conn.Close()
+			buffer := make([]byte, 1024)
+			for _, message := range []string{"one", "two"} {
+				_, err = conn.Write([]byte(message))
+				Expect(err).NotTo(HaveOccurred())
+				count, err := conn.Read(buffer)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(buffer[:count])).To(Equal(message))
+			}
+		})
+
+		It("delays datagrams in both directions", func() {
+			config.SetDuration(impair.Delay, 50*time.Millisecond)
+			var err error
+			p, err = proxy.New(config)
+			Expect(err).NotTo(HaveOccurred())
+
+			conn := dial()
+			defer conn.Close()
+			start := time.Now()
+			_, err = conn.Write([]byte("slow"))
+			Expect(err).NotTo(HaveOccurred())
+			buffer := make([]byte, 1024)
+			count, err := conn.Read(buffer)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(buffer[:count])).To(Equal("slow"))
+			Expect(time.Since(start)).To(BeNumerically(">=", 100*time.Millisecond))
+		})
+
+		It("counts the datagrams lost in each direction", func() {
+			config.SetString(impair.Loss, "1")
+			config.SetString(proxy.Direction, proxy.Forward)
+			var err error
+			p, err = proxy.New(config)
+			Expect(err).NotTo(HaveOccurred())
+
+			conn := dial()
+			defer conn.Close()
+			for i := 0; i < 3; i++ {
+				_, err = conn.Write([]byte("lost"))
+				Expect(err).NotTo(HaveOccurred())
+			}
+			Expect(conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))).To(Succeed())
+			_, err = conn.Read(make([]byte, 1024))
+			Expect(err).To(HaveOccurred())
+
+			Expect(p.Close()).To(Succeed())
+			Expect(p.Stats()).To(ContainElement(factory.Stat{Name: "forward impair lost", Value: 3}))
+			p = nil
+		})
+	})
+
+	Context("TCP", func() {
+		var echo net.Listener
+
+		BeforeEach(func() {
+			var err error
+			echo, err = net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			go func() {
+				for {
+					conn, err := echo.Accept()
+					if err != nil {
+						return
+					}
+					go func() {
+						defer conn.Close()
+						io.Copy(conn, conn)
+					}()
+				}
+			}()
+
+			config.SetString(proxy.TargetAddr, "127.0.0.1")
+			config.SetInt(proxy.TargetPort, echo.Addr().(*net.TCPAddr).Port)
+		})
+
+		AfterEach(func() {
+			echo.Close()
+		})
+
+		It("delays the stream and closes it once the client is done", func() {
+			config.SetDuration(impair.Delay, 50*time.Millisecond)
+			var err error
+			p, err = proxy.New(config)
+			Expect(err).NotTo(HaveOccurred())
+
+			conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", portOf(p.Addr())))
+			Expect(err).NotTo(HaveOccurred())
+			defer conn.Close()
+			Expect(conn.SetReadDeadline(time.Now().Add(time.Second))).To(Succeed())
+
+			start := time.Now()
+			_, err = conn.Write([]byte("hello, "))
+			Expect(err).NotTo(HaveOccurred())
+			_, err = conn.Write([]byte("world"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conn.(*net.TCPConn).CloseWrite()).To(Succeed())
+
+			reply, err := ioutil.ReadAll(conn)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(reply)).To(Equal("hello, world"))
+			Expect(time.Since(start)).To(BeNumerically(">=", 100*time.Millisecond))
+		})
+	})
+})
+
+func portOf(addr net.Addr) string {
+	_, port, err := net.SplitHostPort(addr.String())
+	Expect(err).NotTo(HaveOccurred())
+	return port
+}
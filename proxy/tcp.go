@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"io"
+	"net"
+
+	"github.com/myshkin5/netspel/logs"
+)
+
+const copyBufferSize = 32 * 1024
+
+func (p *Proxy) listenTCP(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	p.addr = listener.Addr()
+	p.stop = listener.Close
+
+	p.done.Add(1)
+	go p.acceptTCP(listener)
+	return nil
+}
+
+func (p *Proxy) acceptTCP(listener net.Listener) {
+	defer p.done.Done()
+
+	for {
+		client, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		p.done.Add(1)
+		go func() {
+			defer p.done.Done()
+			p.relayTCP(client)
+		}()
+	}
+}
+
+// relayTCP connects the client to the target and copies each direction until
+// both sides have finished writing.
+func (p *Proxy) relayTCP(client net.Conn) {
+	p.track(client)
+	defer p.untrack(client)
+	defer client.Close()
+
+	upstream, err := net.Dial("tcp", p.target)
+	if err != nil {
+		logs.Logger.Warning("Error connecting to %s, %s", p.target, err.Error())
+		return
+	}
+	p.track(upstream)
+	defer p.untrack(upstream)
+	defer upstream.Close()
+
+	forward, err := p.impair(halfCloser{upstream}, p.forward)
+	if err != nil {
+		logs.Logger.Warning("Error impairing connection, %s", err.Error())
+		return
+	}
+	reverse, err := p.impair(halfCloser{client}, p.reverse)
+	if err != nil {
+		forward.Close()
+		logs.Logger.Warning("Error impairing connection, %s", err.Error())
+		return
+	}
+	logs.Logger.Info("Proxying TCP from %s to %s", client.RemoteAddr(), p.target)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.copyTCP(Forward, forward, client)
+	}()
+	p.copyTCP(Reverse, reverse, upstream)
+	<-done
+}
+
+// copyTCP copies until the source is closed and then closes the destination
+// for writing once any delayed bytes are written.
+func (p *Proxy) copyTCP(direction string, to io.WriteCloser, from io.Reader) {
+	buffer := make([]byte, copyBufferSize)
+	for {
+		count, err := from.Read(buffer)
+		if count > 0 {
+			_, writeErr := to.Write(buffer[:count])
+			if writeErr != nil {
+				logs.Logger.Debug("Error writing %s, %v", direction, writeErr)
+				break
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	p.closeDirection(direction, to)
+}
+
+// halfCloser closes only the writing side of a TCP connection so that the
+// other direction keeps flowing.
+type halfCloser struct {
+	net.Conn
+}
+
+func (h halfCloser) Close() error {
+	if conn, ok := h.Conn.(*net.TCPConn); ok {
+		return conn.CloseWrite()
+	}
+	return h.Conn.Close()
+}
@@ -0,0 +1,136 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"time"
+
+	"github.com/myshkin5/netspel/logs"
+)
+
+const maxDatagramSize = 64 * 1024
+
+func (p *Proxy) listenUDP(address string) error {
+	laddr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		return err
+	}
+	p.addr = conn.LocalAddr()
+	p.stop = func() error {
+		return conn.SetReadDeadline(time.Now())
+	}
+
+	p.done.Add(1)
+	go p.serveUDP(conn)
+	return nil
+}
+
+// serveUDP forwards each client's datagrams from its own socket so that the
+// target's replies can be returned to the right client. Clients are
+// remembered until the proxy is closed.
+func (p *Proxy) serveUDP(conn *net.UDPConn) {
+	defer p.done.Done()
+	defer conn.Close()
+
+	sessions := make(map[string]*udpSession)
+	buffer := make([]byte, maxDatagramSize)
+	for {
+		count, client, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			break
+		}
+
+		session, ok := sessions[client.String()]
+		if !ok {
+			session, err = p.newUDPSession(conn, client)
+			if err != nil {
+				logs.Logger.Warning("Error proxying UDP from %s, %s", client, err.Error())
+				continue
+			}
+			sessions[client.String()] = session
+		}
+
+		_, err = session.forward.Write(buffer[:count])
+		if err != nil {
+			logs.Logger.Debug("Error writing %s, %v", Forward, err)
+		}
+	}
+
+	for _, session := range sessions {
+		p.closeDirection(Forward, session.forward)
+		<-session.done
+		p.closeDirection(Reverse, session.reverse)
+	}
+}
+
+type udpSession struct {
+	forward io.WriteCloser
+	reverse io.WriteCloser
+	done    chan struct{}
+}
+
+func (p *Proxy) newUDPSession(conn *net.UDPConn, client *net.UDPAddr) (*udpSession, error) {
+	raddr, err := net.ResolveUDPAddr("udp", p.target)
+	if err != nil {
+		return nil, err
+	}
+	upstream, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &udpSession{done: make(chan struct{})}
+	session.forward, err = p.impair(upstream, p.forward)
+	if err != nil {
+		upstream.Close()
+		return nil, err
+	}
+	session.reverse, err = p.impair(clientWriter{conn: conn, client: client}, p.reverse)
+	if err != nil {
+		session.forward.Close()
+		return nil, err
+	}
+	logs.Logger.Info("Proxying UDP from %s to %s", client, p.target)
+
+	go func() {
+		defer close(session.done)
+		relayReplies(upstream, session.reverse)
+	}()
+
+	return session, nil
+}
+
+// relayReplies returns the target's replies to the client until the upstream
+// socket is closed along with the forward direction.
+func relayReplies(upstream *net.UDPConn, reverse io.Writer) {
+	buffer := make([]byte, maxDatagramSize)
+	for {
+		count, err := upstream.Read(buffer)
+		if err != nil {
+			return
+		}
+
+		_, err = reverse.Write(buffer[:count])
+		if err != nil {
+			logs.Logger.Debug("Error writing %s, %v", Reverse, err)
+		}
+	}
+}
+
+// clientWriter sends replies to a client from the proxy's listening socket.
+type clientWriter struct {
+	conn   *net.UDPConn
+	client *net.UDPAddr
+}
+
+func (c clientWriter) Write(message []byte) (int, error) {
+	return c.conn.WriteToUDP(message, c.client)
+}
+
+func (c clientWriter) Close() error {
+	return nil
+}
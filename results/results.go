@@ -0,0 +1,311 @@
+package results
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/clock"
+	"github.com/myshkin5/netspel/factory"
+	"github.com/myshkin5/netspel/histogram"
+	"github.com/myshkin5/netspel/logs"
+	"github.com/myshkin5/netspel/sequence"
+	"github.com/myshkin5/netspel/sizes"
+)
+
+const (
+	prefix = ".output."
+
+	Format = prefix + "format"
+	Path   = prefix + "path"
+
+	DefaultFormat = ""
+	DefaultPath   = "-"
+
+	JSON = "json"
+	CSV  = "csv"
+
+	KindInterval = "interval"
+	KindSummary  = "summary"
+
+	RoleWriter = "writer"
+	RoleReader = "reader"
+)
+
+// ConfigKeys are read by every command writing results.
+var ConfigKeys = []factory.ConfigKey{
+	{Path: Format, Type: factory.StringType, Values: []string{JSON, CSV},
+		Doc: "The format of the records written. No records are written when no format is specified."},
+	{Path: Path, Type: factory.StringType, Default: DefaultPath,
+		Doc: "The file records are written to. - writes records to standard output and moves the log to standard error."},
+}
+
+// Record is a single structured result. Schemes emit one interval record per
+// report cycle and one summary record at the end of a run.
+type Record struct {
+	Kind         string                `json:"kind"`
+	Role         string                `json:"role"`
+	Start        time.Time             `json:"start"`
+	End          time.Time             `json:"end"`
+	SchemeType   string                `json:"scheme-type"`
+	WriterType   string                `json:"writer-type"`
+	ReaderType   string                `json:"reader-type"`
+	MessageCount uint64                `json:"message-count"`
+	ByteCount    uint64                `json:"byte-count"`
+	ErrorCount   uint64                `json:"error-count"`
+	Sequence     *sequence.Stats       `json:"sequence,omitempty"`
+	Latency      *histogram.Stats      `json:"latency,omitempty"`
+	Clock        *clock.Estimate       `json:"clock,omitempty"`
+	SizeBuckets  []sizes.BucketStats   `json:"size-buckets,omitempty"`
+	AdapterStats []factory.Stat        `json:"adapter-stats,omitempty"`
+	Config       jsonstruct.JSONStruct `json:"config"`
+}
+
+type Sink interface {
+	Write(record Record) error
+	Close() error
+}
+
+var (
+	mutex  sync.Mutex
+	sink   Sink
+	config factory.Config
+)
+
+// Init selects the sink for all records emitted by this process from the
+// .output section of the config. No sink is used when no format is
+// configured. Records written to standard output move the log to standard
+// error so the two don't mix.
+func Init(runConfig factory.Config) error {
+	format := runConfig.Additional.StringWithDefault(Format, DefaultFormat)
+	if format == "" {
+		SetSink(nil, runConfig)
+		return nil
+	}
+
+	path := runConfig.Additional.StringWithDefault(Path, DefaultPath)
+	var writer io.WriteCloser = nopCloser{os.Stdout}
+	if path == "-" {
+		logs.SetOutput(os.Stderr)
+	} else {
+		var err error
+		writer, err = os.Create(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	newSink, err := NewSink(format, writer)
+	if err != nil {
+		writer.Close()
+		return err
+	}
+
+	SetSink(newSink, runConfig)
+	return nil
+}
+
+func SetSink(newSink Sink, runConfig factory.Config) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	sink = newSink
+	config = runConfig
+}
+
+// Emit completes the record with the run's types and config and writes it to
+// the sink, if any.
+func Emit(record Record) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if sink == nil {
+		return
+	}
+
+	record.SchemeType = config.SchemeType
+	record.WriterType = config.WriterType
+	record.ReaderType = config.ReaderType
+	record.Config = config.Additional
+
+	err := sink.Write(record)
+	if err != nil {
+		logs.Logger.Warning("Error writing result record, %s", err.Error())
+	}
+}
+
+func Close() error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if sink == nil {
+		return nil
+	}
+
+	err := sink.Close()
+	sink = nil
+	return err
+}
+
+func NewSink(format string, writer io.WriteCloser) (Sink, error) {
+	switch format {
+	case JSON:
+		return &jsonSink{writer: writer, encoder: json.NewEncoder(writer)}, nil
+	case CSV:
+		return &csvSink{writer: writer, csv: csv.NewWriter(writer)}, nil
+	default:
+		return nil, fmt.Errorf("Unknown output format, %s", format)
+	}
+}
+
+type jsonSink struct {
+	writer  io.WriteCloser
+	encoder *json.Encoder
+}
+
+func (s *jsonSink) Write(record Record) error {
+	return s.encoder.Encode(record)
+}
+
+func (s *jsonSink) Close() error {
+	return s.writer.Close()
+}
+
+var csvHeader = []string{
+	"kind",
+	"role",
+	"start",
+	"end",
+	"scheme-type",
+	"writer-type",
+	"reader-type",
+	"message-count",
+	"byte-count",
+	"error-count",
+	"received",
+	"lost",
+	"out-of-order",
+	"duplicate",
+	"late",
+	"latency-count",
+	"latency-p50-ns",
+	"latency-p90-ns",
+	"latency-p99-ns",
+	"latency-p999-ns",
+	"latency-max-ns",
+	"clock-offset-ns",
+	"clock-round-trip-ns",
+	"size-buckets",
+	"adapter-stats",
+	"config",
+}
+
+type csvSink struct {
+	writer        io.WriteCloser
+	csv           *csv.Writer
+	headerWritten bool
+}
+
+func (s *csvSink) Write(record Record) error {
+	if !s.headerWritten {
+		err := s.csv.Write(csvHeader)
+		if err != nil {
+			return err
+		}
+		s.headerWritten = true
+	}
+
+	config, err := json.Marshal(record.Config)
+	if err != nil {
+		return err
+	}
+
+	row := []string{
+		record.Kind,
+		record.Role,
+		record.Start.Format(time.RFC3339Nano),
+		record.End.Format(time.RFC3339Nano),
+		record.SchemeType,
+		record.WriterType,
+		record.ReaderType,
+		strconv.FormatUint(record.MessageCount, 10),
+		strconv.FormatUint(record.ByteCount, 10),
+		strconv.FormatUint(record.ErrorCount, 10),
+	}
+	if record.Sequence != nil {
+		row = append(row,
+			strconv.FormatUint(record.Sequence.Received, 10),
+			strconv.FormatInt(record.Sequence.Lost, 10),
+			strconv.FormatUint(record.Sequence.OutOfOrder, 10),
+			strconv.FormatUint(record.Sequence.Duplicate, 10),
+			strconv.FormatUint(record.Sequence.Late, 10))
+	} else {
+		row = append(row, "", "", "", "", "")
+	}
+	if record.Latency != nil {
+		row = append(row,
+			strconv.FormatUint(record.Latency.Count, 10),
+			strconv.FormatInt(int64(record.Latency.P50), 10),
+			strconv.FormatInt(int64(record.Latency.P90), 10),
+			strconv.FormatInt(int64(record.Latency.P99), 10),
+			strconv.FormatInt(int64(record.Latency.P999), 10),
+			strconv.FormatInt(int64(record.Latency.Max), 10))
+	} else {
+		row = append(row, "", "", "", "", "", "")
+	}
+	if record.Clock != nil {
+		row = append(row,
+			strconv.FormatInt(int64(record.Clock.Offset), 10),
+			strconv.FormatInt(int64(record.Clock.RoundTrip), 10))
+	} else {
+		row = append(row, "", "")
+	}
+	sizeBuckets, err := jsonColumn(len(record.SizeBuckets), record.SizeBuckets)
+	if err != nil {
+		return err
+	}
+	adapterStats, err := jsonColumn(len(record.AdapterStats), record.AdapterStats)
+	if err != nil {
+		return err
+	}
+	row = append(row, sizeBuckets, adapterStats)
+	row = append(row, string(config))
+
+	err = s.csv.Write(row)
+	if err != nil {
+		return err
+	}
+
+	s.csv.Flush()
+	return s.csv.Error()
+}
+
+// jsonColumn encodes a variable count of stats as JSON, leaving the column
+// empty when there are none.
+func jsonColumn(count int, stats interface{}) (string, error) {
+	if count == 0 {
+		return "", nil
+	}
+
+	encoded, err := json.Marshal(stats)
+	return string(encoded), err
+}
+
+func (s *csvSink) Close() error {
+	s.csv.Flush()
+	return s.writer.Close()
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
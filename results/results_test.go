@@ -0,0 +1,275 @@
+package results_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/clock"
+	"github.com/myshkin5/netspel/factory"
+	"github.com/myshkin5/netspel/histogram"
+	"github.com/myshkin5/netspel/logs"
+	"github.com/myshkin5/netspel/results"
+	"github.com/myshkin5/netspel/sequence"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type bufferCloser struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *bufferCloser) Close() error {
+	b.closed = true
+	return nil
+}
+
+type recordingSink struct {
+	records []results.Record
+}
+
+func (s *recordingSink) Write(record results.Record) error {
+	s.records = append(s.records, record)
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	return nil
+}
+
+var _ = Describe("Results", func() {
+	var (
+		start  time.Time
+		record results.Record
+	)
+
+	BeforeEach(func() {
+		start = time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+
+		config := jsonstruct.New()
+		config.SetInt(".udp.port", 12345)
+
+		record = results.Record{
+			Kind:         results.KindInterval,
+			Role:         results.RoleReader,
+			Start:        start,
+			End:          start.Add(time.Second),
+			SchemeType:   "streaming",
+			WriterType:   "udp",
+			ReaderType:   "udp",
+			MessageCount: 10,
+			ByteCount:    1000,
+			ErrorCount:   1,
+			Config:       config,
+		}
+	})
+
+	It("writes JSON records one per line", func() {
+		buffer := &bufferCloser{}
+		sink, err := results.NewSink(results.JSON, buffer)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(sink.Write(record)).To(Succeed())
+		record.Sequence = &sequence.Stats{Received: 9, Lost: 1}
+		Expect(sink.Write(record)).To(Succeed())
+		Expect(sink.Close()).To(Succeed())
+		Expect(buffer.closed).To(BeTrue())
+
+		lines := bytes.Split(bytes.TrimSpace(buffer.Bytes()), []byte("\n"))
+		Expect(lines).To(HaveLen(2))
+
+		var first map[string]interface{}
+		Expect(json.Unmarshal(lines[0], &first)).To(Succeed())
+		Expect(first["kind"]).To(Equal("interval"))
+		Expect(first["role"]).To(Equal("reader"))
+		Expect(first["start"]).To(Equal("2016-01-02T03:04:05Z"))
+		Expect(first["end"]).To(Equal("2016-01-02T03:04:06Z"))
+		Expect(first["scheme-type"]).To(Equal("streaming"))
+		Expect(first["message-count"]).To(BeEquivalentTo(10))
+		Expect(first["byte-count"]).To(BeEquivalentTo(1000))
+		Expect(first["error-count"]).To(BeEquivalentTo(1))
+		Expect(first).NotTo(HaveKey("sequence"))
+		Expect(first["config"]).To(Equal(map[string]interface{}{
+			"udp": map[string]interface{}{"port": float64(12345)},
+		}))
+
+		var second map[string]interface{}
+		Expect(json.Unmarshal(lines[1], &second)).To(Succeed())
+		Expect(second).To(HaveKey("sequence"))
+	})
+
+	It("writes CSV records after a header row", func() {
+		buffer := &bufferCloser{}
+		sink, err := results.NewSink(results.CSV, buffer)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(sink.Write(record)).To(Succeed())
+		record.Sequence = &sequence.Stats{Received: 9, Lost: 1, OutOfOrder: 2, Duplicate: 3, Late: 4}
+		Expect(sink.Write(record)).To(Succeed())
+		Expect(sink.Close()).To(Succeed())
+
+		rows, err := csv.NewReader(&buffer.Buffer).ReadAll()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rows).To(HaveLen(3))
+		Expect(rows[0][0]).To(Equal("kind"))
+		Expect(rows[1]).To(Equal([]string{
+			"interval", "reader", "2016-01-02T03:04:05Z", "2016-01-02T03:04:06Z", "streaming", "udp", "udp",
+			"10", "1000", "1", "", "", "", "", "", "", "", "", "", "", "", "", "", "", "", `{"udp":{"port":12345}}`,
+		}))
+		Expect(rows[2][10:15]).To(Equal([]string{"9", "1", "2", "3", "4"}))
+	})
+
+	It("writes latency stats", func() {
+		record.Latency = &histogram.Stats{Count: 9, P50: 1000, P90: 1500, P99: 2000, P999: 3000, Max: 4000}
+
+		buffer := &bufferCloser{}
+		sink, err := results.NewSink(results.CSV, buffer)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sink.Write(record)).To(Succeed())
+
+		rows, err := csv.NewReader(&buffer.Buffer).ReadAll()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rows[0][15:21]).To(Equal([]string{"latency-count", "latency-p50-ns", "latency-p90-ns", "latency-p99-ns", "latency-p999-ns", "latency-max-ns"}))
+		Expect(rows[1][15:21]).To(Equal([]string{"9", "1000", "1500", "2000", "3000", "4000"}))
+
+		buffer = &bufferCloser{}
+		sink, err = results.NewSink(results.JSON, buffer)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sink.Write(record)).To(Succeed())
+
+		var decoded map[string]interface{}
+		Expect(json.Unmarshal(buffer.Bytes(), &decoded)).To(Succeed())
+		Expect(decoded["latency"]).To(Equal(map[string]interface{}{
+			"count": float64(9), "p50-ns": float64(1000), "p90-ns": float64(1500), "p99-ns": float64(2000), "p999-ns": float64(3000), "max-ns": float64(4000),
+		}))
+	})
+
+	It("writes the clock offset estimate", func() {
+		record.Clock = &clock.Estimate{Offset: -1500, RoundTrip: 400}
+
+		buffer := &bufferCloser{}
+		sink, err := results.NewSink(results.CSV, buffer)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sink.Write(record)).To(Succeed())
+
+		rows, err := csv.NewReader(&buffer.Buffer).ReadAll()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rows[0][21:23]).To(Equal([]string{"clock-offset-ns", "clock-round-trip-ns"}))
+		Expect(rows[1][21:23]).To(Equal([]string{"-1500", "400"}))
+	})
+
+	It("writes adapter stats", func() {
+		record.AdapterStats = []factory.Stat{{Name: "socket drops", Value: 12}}
+
+		buffer := &bufferCloser{}
+		sink, err := results.NewSink(results.CSV, buffer)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sink.Write(record)).To(Succeed())
+
+		rows, err := csv.NewReader(&buffer.Buffer).ReadAll()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rows[0][24]).To(Equal("adapter-stats"))
+		Expect(rows[1][24]).To(Equal(`[{"name":"socket drops","value":12}]`))
+
+		buffer = &bufferCloser{}
+		sink, err = results.NewSink(results.JSON, buffer)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sink.Write(record)).To(Succeed())
+
+		var decoded map[string]interface{}
+		Expect(json.Unmarshal(buffer.Bytes(), &decoded)).To(Succeed())
+		Expect(decoded["adapter-stats"]).To(Equal([]interface{}{
+			map[string]interface{}{"name": "socket drops", "value": float64(12)},
+		}))
+	})
+
+	It("rejects an unknown format", func() {
+		_, err := results.NewSink("xml", &bufferCloser{})
+		Expect(err).To(HaveOccurred())
+	})
+
+	Context("emitting", func() {
+		var config factory.Config
+
+		BeforeEach(func() {
+			var err error
+			config, err = factory.Parse([]byte(`{
+				"scheme-type": "simple",
+				"writer-type": "tcp",
+				"reader-type": "tcp",
+				"additional": {"simple": {"messages-per-run": 5}}
+			}`))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(results.Close()).To(Succeed())
+		})
+
+		It("completes records with the run's types and config", func() {
+			sink := &recordingSink{}
+			results.SetSink(sink, config)
+
+			results.Emit(results.Record{Kind: results.KindSummary, Role: results.RoleWriter, MessageCount: 5})
+
+			Expect(sink.records).To(HaveLen(1))
+			Expect(sink.records[0].SchemeType).To(Equal("simple"))
+			Expect(sink.records[0].WriterType).To(Equal("tcp"))
+			Expect(sink.records[0].ReaderType).To(Equal("tcp"))
+			Expect(sink.records[0].Config).To(Equal(config.Additional))
+			Expect(sink.records[0].MessageCount).To(BeEquivalentTo(5))
+		})
+
+		It("discards records when no format is configured", func() {
+			Expect(results.Init(config)).To(Succeed())
+
+			results.Emit(results.Record{Kind: results.KindSummary})
+		})
+
+		It("writes records to the configured path", func() {
+			dir, err := ioutil.TempDir("", "results")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(dir)
+
+			path := filepath.Join(dir, "results.json")
+			config.Additional.SetString(results.Format, results.JSON)
+			config.Additional.SetString(results.Path, path)
+			Expect(results.Init(config)).To(Succeed())
+
+			results.Emit(results.Record{Kind: results.KindSummary, Role: results.RoleReader})
+			Expect(results.Close()).To(Succeed())
+
+			contents, err := ioutil.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			var written map[string]interface{}
+			Expect(json.Unmarshal(contents, &written)).To(Succeed())
+			Expect(written["kind"]).To(Equal("summary"))
+			Expect(written["scheme-type"]).To(Equal("simple"))
+		})
+
+		It("moves the log to standard error when writing records to standard output", func() {
+			log := &bytes.Buffer{}
+			logs.SetOutput(log)
+			defer logs.SetOutput(os.Stdout)
+
+			config.Additional.SetString(results.Format, results.JSON)
+			Expect(results.Init(config)).To(Succeed())
+			defer results.SetSink(nil, config)
+
+			logs.Logger.Warning("Not a record")
+			Expect(log.Len()).To(BeZero())
+		})
+
+		It("fails to initialize an unknown format", func() {
+			config.Additional.SetString(results.Format, "xml")
+			Expect(results.Init(config)).NotTo(Succeed())
+		})
+	})
+})
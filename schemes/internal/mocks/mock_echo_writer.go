@@ -0,0 +1,52 @@
+package mocks
+
+import (
+	"io"
+
+	"github.com/myshkin5/jsonstruct"
+)
+
+// MockEchoWriter is a duplex writer whose reader replies to every message
+// written unless told to drop it.
+type MockEchoWriter struct {
+	Messages chan []byte
+	Drop     func(message []byte) bool
+	replies  chan []byte
+	closed   chan struct{}
+}
+
+func NewMockEchoWriter() *MockEchoWriter {
+	return &MockEchoWriter{
+		Messages: make(chan []byte, 10000),
+		replies:  make(chan []byte, 10000),
+		closed:   make(chan struct{}),
+	}
+}
+
+func (m *MockEchoWriter) Init(config jsonstruct.JSONStruct) error {
+	return nil
+}
+
+func (m *MockEchoWriter) Write(message []byte) (int, error) {
+	written := make([]byte, len(message))
+	copy(written, message)
+	m.Messages <- written
+	if m.Drop == nil || !m.Drop(written) {
+		m.replies <- written
+	}
+	return len(message), nil
+}
+
+func (m *MockEchoWriter) Read(message []byte) (int, error) {
+	select {
+	case reply := <-m.replies:
+		return copy(message, reply), nil
+	case <-m.closed:
+		return 0, io.EOF
+	}
+}
+
+func (m *MockEchoWriter) Close() error {
+	close(m.closed)
+	return nil
+}
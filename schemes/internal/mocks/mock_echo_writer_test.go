@@ -0,0 +1,50 @@
+package mocks_test
+
+import (
+	"io"
+
+	"github.com/myshkin5/netspel/schemes/internal/mocks"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MockEchoWriter", func() {
+	It("replies to each write", func() {
+		writer := mocks.NewMockEchoWriter()
+
+		bytesWritten, err := writer.Write([]byte("ping"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bytesWritten).To(Equal(4))
+
+		buffer := make([]byte, 10)
+		bytesRead, err := writer.Read(buffer)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(buffer[:bytesRead]).To(Equal([]byte("ping")))
+
+		Expect(writer.Messages).To(Receive(Equal([]byte("ping"))))
+	})
+
+	It("drops replies when told to", func() {
+		writer := mocks.NewMockEchoWriter()
+		writer.Drop = func(message []byte) bool {
+			return message[0] == 'x'
+		}
+
+		writer.Write([]byte("xxx"))
+		writer.Write([]byte("ok"))
+
+		buffer := make([]byte, 10)
+		bytesRead, err := writer.Read(buffer)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(buffer[:bytesRead]).To(Equal([]byte("ok")))
+	})
+
+	It("returns EOF from Read once closed", func() {
+		writer := mocks.NewMockEchoWriter()
+		writer.Close()
+
+		_, err := writer.Read(make([]byte, 10))
+		Expect(err).To(Equal(io.EOF))
+	})
+})
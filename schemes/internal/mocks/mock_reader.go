@@ -13,11 +13,13 @@ type ReadMessage struct {
 
 type MockReader struct {
 	ReadMessages chan ReadMessage
+	Replies      chan []byte
 }
 
 func NewMockReader() *MockReader {
 	return &MockReader{
 		ReadMessages: make(chan ReadMessage, 10000),
+		Replies:      make(chan []byte, 10000),
 	}
 }
 
@@ -38,6 +40,13 @@ func (m *MockReader) Read(message []byte) (int, error) {
 	return bytesRead, readMessage.Error
 }
 
+func (m *MockReader) Write(message []byte) (int, error) {
+	reply := make([]byte, len(message))
+	copy(reply, message)
+	m.Replies <- reply
+	return len(message), nil
+}
+
 func (m *MockReader) Close() error {
 	m.ReadMessages <- ReadMessage{Buffer: []byte{}, Error: io.EOF}
 	return nil
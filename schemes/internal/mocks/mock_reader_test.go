@@ -32,4 +32,16 @@ var _ = Describe("MockReader", func() {
 		bytesRead, err = reader.Read(buffer)
 		Expect(err).To(HaveOccurred())
 	})
+
+	It("stores replies in order", func() {
+		reader := mocks.NewMockReader()
+
+		bytesWritten, err := reader.Write([]byte("reply 1"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bytesWritten).To(Equal(7))
+		reader.Write([]byte("reply 2"))
+
+		Expect(reader.Replies).To(Receive(Equal([]byte("reply 1"))))
+		Expect(reader.Replies).To(Receive(Equal([]byte("reply 2"))))
+	})
 })
@@ -17,7 +17,10 @@ func (m *MockWriter) Init(config jsonstruct.JSONStruct) error {
 }
 
 func (m *MockWriter) Write(message []byte) (int, error) {
-	m.Messages <- message
+	// Schemes reuse their buffers so keep a copy of what was written
+	written := make([]byte, len(message))
+	copy(written, message)
+	m.Messages <- written
 	return len(message), nil
 }
 
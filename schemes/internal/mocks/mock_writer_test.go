@@ -28,4 +28,16 @@ var _ = Describe("MockWriter", func() {
 		Expect(writer.Messages).To(Receive(&sentMessage))
 		Expect(sentMessage).To(Equal(message2))
 	})
+
+	It("keeps a copy of each write", func() {
+		writer := mocks.NewMockWriter()
+
+		message := []byte("message 1")
+		writer.Write(message)
+		message[8] = '2'
+
+		var sentMessage []byte
+		Expect(writer.Messages).To(Receive(&sentMessage))
+		Expect(sentMessage).To(Equal([]byte("message 1")))
+	})
 })
@@ -0,0 +1,344 @@
+package pingpong
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/factory"
+	"github.com/myshkin5/netspel/histogram"
+	"github.com/myshkin5/netspel/logs"
+	"github.com/myshkin5/netspel/results"
+	"github.com/myshkin5/netspel/sequence"
+)
+
+const (
+	prefix = ".ping-pong."
+
+	MessagesPerRun     = prefix + "messages-per-run"
+	BytesPerMessage    = prefix + "bytes-per-message"
+	ReplyTimeout       = prefix + "reply-timeout"
+	ReportCycle        = prefix + "report-cycle"
+	WaitForLastMessage = prefix + "wait-for-last-message"
+
+	DefaultMessagesPerRun     = 10000
+	DefaultBytesPerMessage    = 64
+	DefaultReplyTimeout       = time.Second
+	DefaultReportCycle        = time.Second
+	DefaultWaitForLastMessage = 5 * time.Second
+)
+
+var configKeys = []factory.ConfigKey{
+	{Path: MessagesPerRun, Type: factory.IntType, Default: fmt.Sprint(DefaultMessagesPerRun), Range: factory.AtLeast(0),
+		Doc: "The count of messages sent by the writer."},
+	{Path: BytesPerMessage, Type: factory.IntType, Default: fmt.Sprint(DefaultBytesPerMessage), Range: factory.AtLeast(16),
+		Doc: "The count of bytes per message. Must be at least 16."},
+	{Path: ReplyTimeout, Type: factory.DurationType, Default: fmt.Sprint(DefaultReplyTimeout),
+		Doc: "The time the writer waits for a reply before counting the message as timed out. Used only in write mode."},
+	{Path: ReportCycle, Type: factory.DurationType, Default: fmt.Sprint(DefaultReportCycle),
+		Doc: "The length of time between round trip reports. Used only in write mode."},
+	{Path: WaitForLastMessage, Type: factory.DurationType, Default: fmt.Sprint(DefaultWaitForLastMessage),
+		Doc: "The time to wait after the last message is echoed before a run is considered complete. Used only in read mode."},
+}
+
+func init() {
+	factory.RegisterScheme(factory.Descriptor{
+		Name:        "ping-pong",
+		Description: "Sends one message at a time and times its echo from the reader.",
+		Config:      configKeys,
+	}, func() factory.Scheme {
+		return &Scheme{}
+	})
+}
+
+type Scheme struct {
+	buffer       []byte
+	roundTrips   *histogram.Histogram
+	byteCount    uint64
+	echoCount    uint32
+	timeoutCount uint32
+	errorCount   uint32
+
+	messagesPerRun     int
+	bytesPerMessage    int
+	replyTimeout       time.Duration
+	reportCycle        time.Duration
+	waitForLastMessage time.Duration
+}
+
+type reply struct {
+	sequence uint64
+	bytes    int
+	sent     time.Time
+	received time.Time
+}
+
+func (s *Scheme) Init(config jsonstruct.JSONStruct) error {
+	s.messagesPerRun = config.IntWithDefault(MessagesPerRun, DefaultMessagesPerRun)
+	s.bytesPerMessage = config.IntWithDefault(BytesPerMessage, DefaultBytesPerMessage)
+	if s.bytesPerMessage < sequence.HeaderSize {
+		return fmt.Errorf("Messages must be at least %d bytes to hold a sequence header, %d", sequence.HeaderSize, s.bytesPerMessage)
+	}
+	s.buffer = make([]byte, s.bytesPerMessage)
+
+	var err error
+	s.replyTimeout, err = config.DurationWithDefault(ReplyTimeout, DefaultReplyTimeout)
+	if err != nil {
+		return err
+	}
+	s.reportCycle, err = config.DurationWithDefault(ReportCycle, DefaultReportCycle)
+	if err != nil {
+		return err
+	}
+	s.waitForLastMessage, err = config.DurationWithDefault(WaitForLastMessage, DefaultWaitForLastMessage)
+	if err != nil {
+		return err
+	}
+
+	s.roundTrips = histogram.New()
+
+	return nil
+}
+
+// MessageSizes returns the size of every message, which is the same for all.
+func (s *Scheme) MessageSizes() (int, int) {
+	return s.bytesPerMessage, s.bytesPerMessage
+}
+
+// RoundTrips returns the round trip times recorded by a writer.
+func (s *Scheme) RoundTrips() *histogram.Histogram {
+	return s.roundTrips
+}
+
+func (s *Scheme) EchoCount() uint32 {
+	return s.echoCount
+}
+
+func (s *Scheme) TimeoutCount() uint32 {
+	return s.timeoutCount
+}
+
+func (s *Scheme) ErrorCount() uint32 {
+	return s.errorCount
+}
+
+func (s *Scheme) RunWriter(writer factory.Writer) {
+	duplex, ok := writer.(factory.DuplexWriter)
+	if !ok {
+		logs.Logger.Error("The ping-pong scheme requires a writer that can read replies")
+		return
+	}
+
+	replies := make(chan reply, 100)
+	go s.readReplies(duplex, replies)
+
+	cycle := histogram.New()
+	var cycleBytes, cycleErrors uint64
+
+	logs.Logger.Info("Starting ping-pong of %d messages...", s.messagesPerRun)
+	startTime := time.Now()
+	lastReport := startTime
+	for i := 0; i < s.messagesPerRun; i++ {
+		sequence.Stamp(s.buffer, uint64(i), time.Now())
+		_, err := writer.Write(s.buffer)
+		if err != nil {
+			s.errorCount++
+			cycleErrors++
+			continue
+		}
+
+		r, ok := s.awaitReply(replies, uint64(i))
+		if ok {
+			cycle.Record(r.received.Sub(r.sent))
+			cycleBytes += uint64(r.bytes)
+		} else {
+			s.timeoutCount++
+			cycleErrors++
+		}
+
+		if now := time.Now(); now.Sub(lastReport) >= s.reportCycle {
+			emitCycle(lastReport, now, cycle, cycleBytes, cycleErrors)
+			s.roundTrips.Merge(cycle)
+			s.byteCount += cycleBytes
+			cycle.Reset()
+			cycleBytes, cycleErrors = 0, 0
+			lastReport = now
+		}
+	}
+	s.roundTrips.Merge(cycle)
+	s.byteCount += cycleBytes
+	endTime := time.Now()
+	logs.Logger.Info("Finished.")
+
+	err := writer.Close()
+	if err != nil {
+		logs.Logger.Warning("Error closing writer, %s", err.Error())
+	}
+
+	logs.Logger.Info("Round trip count: %d", s.roundTrips.Count())
+	logs.Logger.Info("Timeout count: %d", s.TimeoutCount())
+	logs.Logger.Info("Error count: %d", s.ErrorCount())
+	reportLatency("Total", s.roundTrips)
+	adapterStats := reportAdapterStats(writer)
+
+	latency := s.roundTrips.Stats()
+	results.Emit(results.Record{
+		Kind:         results.KindSummary,
+		Role:         results.RoleWriter,
+		Start:        startTime,
+		End:          endTime,
+		MessageCount: s.roundTrips.Count(),
+		ByteCount:    s.byteCount,
+		ErrorCount:   uint64(s.errorCount + s.timeoutCount),
+		Latency:      &latency,
+		AdapterStats: adapterStats,
+	})
+}
+
+func (s *Scheme) RunReader(reader factory.Reader) {
+	duplex, ok := reader.(factory.DuplexReader)
+	if !ok {
+		logs.Logger.Error("The ping-pong scheme requires a reader that can send replies")
+		return
+	}
+
+	startTime := time.Now()
+	timer := time.NewTimer(time.Duration(1<<63 - 1))
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.echo(duplex, timer)
+	}()
+
+	<-timer.C
+
+	err := reader.Close()
+	if err != nil {
+		logs.Logger.Warning("Error closing reader, %s", err.Error())
+	}
+
+	wg.Wait()
+
+	logs.Logger.Info("Echo count: %d", s.EchoCount())
+	logs.Logger.Info("Error count: %d", s.ErrorCount())
+	adapterStats := reportAdapterStats(reader)
+
+	results.Emit(results.Record{
+		Kind:         results.KindSummary,
+		Role:         results.RoleReader,
+		Start:        startTime,
+		End:          time.Now(),
+		MessageCount: uint64(s.echoCount),
+		ByteCount:    s.byteCount,
+		ErrorCount:   uint64(s.errorCount),
+		AdapterStats: adapterStats,
+	})
+}
+
+func (s *Scheme) echo(reader factory.DuplexReader, timer *time.Timer) {
+	logs.Logger.Info("Starting echoing messages...")
+	buffer := make([]byte, s.bytesPerMessage*2)
+	for {
+		count, err := reader.Read(buffer)
+		if err == io.EOF {
+			break
+		}
+
+		timer.Reset(s.waitForLastMessage)
+
+		if err == nil {
+			count, err = reader.Write(buffer[:count])
+		}
+		if err != nil {
+			s.errorCount++
+			continue
+		}
+		s.echoCount++
+		s.byteCount += uint64(count)
+	}
+	logs.Logger.Info("Finished.")
+}
+
+func (s *Scheme) readReplies(writer factory.DuplexWriter, replies chan<- reply) {
+	defer close(replies)
+
+	buffer := make([]byte, s.bytesPerMessage*2)
+	for {
+		count, err := writer.Read(buffer)
+		received := time.Now()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			logs.Logger.Debug("Error reading reply, %v", err)
+			continue
+		}
+
+		number, sent, ok := sequence.Parse(buffer[:count])
+		if !ok {
+			continue
+		}
+		replies <- reply{sequence: number, bytes: count, sent: sent, received: received}
+	}
+}
+
+// awaitReply waits for the reply to the given message, discarding any late
+// replies to earlier messages that already timed out.
+func (s *Scheme) awaitReply(replies <-chan reply, number uint64) (reply, bool) {
+	timeout := time.NewTimer(s.replyTimeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case r, ok := <-replies:
+			if !ok {
+				return reply{}, false
+			}
+			if r.sequence == number {
+				return r, true
+			}
+		case <-timeout.C:
+			return reply{}, false
+		}
+	}
+}
+
+// emitCycle logs and records the round trips of a report cycle.
+func emitCycle(start, end time.Time, roundTrips *histogram.Histogram, byteCount, errorCount uint64) {
+	reportLatency("Cycle", roundTrips)
+
+	latency := roundTrips.Stats()
+	results.Emit(results.Record{
+		Kind:         results.KindInterval,
+		Role:         results.RoleWriter,
+		Start:        start,
+		End:          end,
+		MessageCount: roundTrips.Count(),
+		ByteCount:    byteCount,
+		ErrorCount:   errorCount,
+		Latency:      &latency,
+	})
+}
+
+// reportAdapterStats logs and returns the stats of a closed adapter.
+func reportAdapterStats(adapter io.Closer) []factory.Stat {
+	stats := factory.CollectStats(adapter)
+	if len(stats) > 0 {
+		logs.Logger.Info("Adapter: %s", factory.DescribeStats(stats))
+	}
+	return stats
+}
+
+func reportLatency(label string, roundTrips *histogram.Histogram) {
+	logs.Logger.Info("%s round trips: %d, p50 %s, p90 %s, p99 %s, p99.9 %s, max %s",
+		label,
+		roundTrips.Count(),
+		roundTrips.Percentile(50),
+		roundTrips.Percentile(90),
+		roundTrips.Percentile(99),
+		roundTrips.Percentile(99.9),
+		roundTrips.Max())
+}
@@ -0,0 +1,149 @@
+package pingpong_test
+
+import (
+	"errors"
+	"time"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/factory"
+	"github.com/myshkin5/netspel/results"
+	"github.com/myshkin5/netspel/schemes/internal/mocks"
+	"github.com/myshkin5/netspel/schemes/pingpong"
+	"github.com/myshkin5/netspel/sequence"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Scheme", func() {
+	var (
+		scheme *pingpong.Scheme
+		config jsonstruct.JSONStruct
+	)
+
+	BeforeEach(func() {
+		scheme = &pingpong.Scheme{}
+		config = jsonstruct.New()
+		config.SetInt(pingpong.MessagesPerRun, 100)
+		config.SetInt(pingpong.BytesPerMessage, 32)
+		config.SetString(pingpong.ReplyTimeout, "50ms")
+		config.SetString(pingpong.WaitForLastMessage, "100ms")
+	})
+
+	initScheme := func() {
+		err := scheme.Init(config)
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+	}
+
+	It("records the round trip time of each message", func() {
+		initScheme()
+		writer := mocks.NewMockEchoWriter()
+
+		scheme.RunWriter(writer)
+
+		Expect(writer.Messages).To(HaveLen(100))
+		Expect(scheme.RoundTrips().Count()).To(BeEquivalentTo(100))
+		Expect(scheme.RoundTrips().Max()).To(BeNumerically(">", 0))
+		Expect(scheme.RoundTrips().Max()).To(BeNumerically("<", 50*time.Millisecond))
+		Expect(scheme.TimeoutCount()).To(BeZero())
+	})
+
+	It("writes a record each report cycle and a summary with the round trip latency", func() {
+		config.SetString(pingpong.ReportCycle, "1ns")
+		initScheme()
+		writer := mocks.NewMockEchoWriter()
+		sink := &recordingSink{}
+		results.SetSink(sink, factory.Config{})
+		defer results.SetSink(nil, factory.Config{})
+
+		scheme.RunWriter(writer)
+
+		Expect(sink.records).To(HaveLen(101))
+		interval := sink.records[0]
+		Expect(interval.Kind).To(Equal(results.KindInterval))
+		Expect(interval.MessageCount).To(BeEquivalentTo(1))
+		Expect(interval.ByteCount).To(BeEquivalentTo(32))
+		Expect(interval.Latency.Count).To(BeEquivalentTo(1))
+
+		summary := sink.records[100]
+		Expect(summary.Kind).To(Equal(results.KindSummary))
+		Expect(summary.MessageCount).To(BeEquivalentTo(100))
+		Expect(summary.ByteCount).To(BeEquivalentTo(100 * 32))
+		Expect(summary.Latency.Count).To(BeEquivalentTo(100))
+		Expect(summary.Latency.P90).To(BeNumerically(">", 0))
+		Expect(summary.Latency.P90).To(BeNumerically("<=", summary.Latency.Max))
+	})
+
+	It("counts messages without a reply as timeouts", func() {
+		initScheme()
+		writer := mocks.NewMockEchoWriter()
+		writer.Drop = func(message []byte) bool {
+			number, _, _ := sequence.Parse(message)
+			return number%10 == 0
+		}
+
+		scheme.RunWriter(writer)
+
+		Expect(scheme.RoundTrips().Count()).To(BeEquivalentTo(90))
+		Expect(scheme.TimeoutCount()).To(BeEquivalentTo(10))
+	})
+
+	It("doesn't run with a writer that can't read replies", func() {
+		initScheme()
+		writer := mocks.NewMockWriter()
+
+		scheme.RunWriter(writer)
+
+		Expect(writer.Messages).To(BeEmpty())
+	})
+
+	It("echoes messages back to the writer", func() {
+		initScheme()
+		reader := mocks.NewMockReader()
+		reader.ReadMessages <- mocks.ReadMessage{Buffer: []byte("ping 1"), Error: nil}
+		reader.ReadMessages <- mocks.ReadMessage{Buffer: []byte{}, Error: errors.New("Bad stuff")}
+		reader.ReadMessages <- mocks.ReadMessage{Buffer: []byte("ping 2"), Error: nil}
+
+		scheme.RunReader(reader)
+
+		Expect(reader.Replies).To(Receive(Equal([]byte("ping 1"))))
+		Expect(reader.Replies).To(Receive(Equal([]byte("ping 2"))))
+		Expect(scheme.EchoCount()).To(BeEquivalentTo(2))
+		Expect(scheme.ErrorCount()).To(BeEquivalentTo(1))
+	})
+
+	It("counts the bytes echoed", func() {
+		initScheme()
+		reader := mocks.NewMockReader()
+		reader.ReadMessages <- mocks.ReadMessage{Buffer: []byte("ping 1"), Error: nil}
+		reader.ReadMessages <- mocks.ReadMessage{Buffer: []byte("ping 22"), Error: nil}
+		sink := &recordingSink{}
+		results.SetSink(sink, factory.Config{})
+		defer results.SetSink(nil, factory.Config{})
+
+		scheme.RunReader(reader)
+
+		Expect(sink.records).To(HaveLen(1))
+		Expect(sink.records[0].MessageCount).To(BeEquivalentTo(2))
+		Expect(sink.records[0].ByteCount).To(BeEquivalentTo(13))
+	})
+
+	It("requires messages large enough for a header", func() {
+		config.SetInt(pingpong.BytesPerMessage, sequence.HeaderSize-1)
+		err := scheme.Init(config)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+type recordingSink struct {
+	records []results.Record
+}
+
+func (s *recordingSink) Write(record results.Record) error {
+	s.records = append(s.records, record)
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	return nil
+}
@@ -1,6 +1,7 @@
 package simple
 
 import (
+	"fmt"
 	"io"
 	"sync"
 	"time"
@@ -8,6 +9,10 @@ import (
 	"github.com/myshkin5/jsonstruct"
 	"github.com/myshkin5/netspel/factory"
 	"github.com/myshkin5/netspel/logs"
+	"github.com/myshkin5/netspel/payload"
+	"github.com/myshkin5/netspel/results"
+	"github.com/myshkin5/netspel/sequence"
+	"github.com/myshkin5/netspel/sizes"
 	"github.com/myshkin5/netspel/utils"
 )
 
@@ -17,6 +22,8 @@ const (
 	MessagesPerRun     = prefix + "messages-per-run"
 	BytesPerMessage    = prefix + "bytes-per-message"
 	WaitForLastMessage = prefix + "wait-for-last-message"
+	SequenceHeader     = prefix + "sequence-header"
+	LateAfter          = prefix + "late-after"
 
 	WarmupMessagesPerRun = prefix + "warmup-messages-per-run"
 	WarmupWait           = prefix + "warmup-wait"
@@ -24,32 +31,94 @@ const (
 	DefaultMessagesPerRun     = 10000
 	DefaultBytesPerMessage    = 1024
 	DefaultWaitForLastMessage = 5 * time.Second
+	DefaultSequenceHeader     = false
+	DefaultLateAfter          = time.Second
 
 	DefaultWarmupMessagesPerRun = 0
 	DefaultWarmupWait           = 5 * time.Second
 )
 
+var configKeys = append(append([]factory.ConfigKey{
+	{Path: MessagesPerRun, Type: factory.IntType, Default: fmt.Sprint(DefaultMessagesPerRun), Range: factory.AtLeast(0),
+		Doc: "The count of messages sent to a writer and expected from a reader."},
+	{Path: BytesPerMessage, Type: factory.IntType, Default: fmt.Sprint(DefaultBytesPerMessage), Range: factory.AtLeast(1),
+		Doc: "The count of bytes per message when using the fixed size distribution."},
+	{Path: WaitForLastMessage, Type: factory.DurationType, Default: fmt.Sprint(DefaultWaitForLastMessage),
+		Doc: "The time to wait after the last message is read before a run is considered complete. Used only in read mode."},
+	{Path: WarmupMessagesPerRun, Type: factory.IntType, Default: fmt.Sprint(DefaultWarmupMessagesPerRun), Range: factory.AtLeast(0),
+		Doc: "The count of messages used to warm up the network channel before the run."},
+	{Path: WarmupWait, Type: factory.DurationType, Default: fmt.Sprint(DefaultWarmupWait),
+		Doc: "The time to wait after warmup messages are sent before sending actual messages."},
+	{Path: SequenceHeader, Type: factory.BoolType, Default: fmt.Sprint(DefaultSequenceHeader),
+		Doc: "When true, messages are stamped with a sequence number and send timestamp so the reader reports lost, out of order, duplicate and late messages."},
+	{Path: LateAfter, Type: factory.DurationType, Default: fmt.Sprint(DefaultLateAfter),
+		Doc: "Messages received longer than this after their send timestamp are counted as late. Used only in read mode."},
+}, payload.ConfigKeys...), sizes.ConfigKeys...)
+
+func init() {
+	factory.RegisterScheme(factory.Descriptor{
+		Name:        "simple",
+		Description: "Writes a fixed count of messages as quickly as possible and times how long they take to read.",
+		Config:      configKeys,
+	}, func() factory.Scheme {
+		return &Scheme{}
+	})
+}
+
 type Scheme struct {
-	buffer     []byte
-	byteCount  uint64
-	errorCount uint32
-	firstError error
-	runTime    time.Duration
+	buffer       []byte
+	payload      payload.Generator
+	static       bool
+	sizes        sizes.Sizes
+	buckets      *sizes.Counter
+	messageCount uint64
+	byteCount    uint64
+	errorCount   uint32
+	firstError   error
+	startTime    time.Time
+	runTime      time.Duration
+
+	nextSequence uint64
+	tracker      *sequence.Tracker
 
 	bytesPerMessage    int
 	messagesPerRun     int
 	waitForLastMessage time.Duration
+	sequenceHeader     bool
+	lateAfter          time.Duration
 
 	warmupMessagesPerRun int
 	warmupWait           time.Duration
+
+	timerLock sync.Mutex
+	timer     *time.Timer
+	closed    bool
 }
 
 func (s *Scheme) Init(config jsonstruct.JSONStruct) error {
 	s.messagesPerRun = config.IntWithDefault(MessagesPerRun, DefaultMessagesPerRun)
 	s.bytesPerMessage = config.IntWithDefault(BytesPerMessage, DefaultBytesPerMessage)
-	s.buffer = make([]byte, s.bytesPerMessage)
 
 	var err error
+	s.payload, err = payload.New(config)
+	if err != nil {
+		return err
+	}
+
+	s.sizes, err = sizes.New(config, s.bytesPerMessage)
+	if err != nil {
+		return err
+	}
+	s.buckets, err = sizes.NewCounter(config, s.sizes)
+	if err != nil {
+		return err
+	}
+	s.buffer = make([]byte, s.sizes.Max())
+	s.static = payload.Static(s.payload)
+	if s.static {
+		s.payload.Fill(s.buffer)
+	}
+
 	s.waitForLastMessage, err = config.DurationWithDefault(WaitForLastMessage, DefaultWaitForLastMessage)
 	if err != nil {
 		return err
@@ -61,6 +130,18 @@ func (s *Scheme) Init(config jsonstruct.JSONStruct) error {
 		return err
 	}
 
+	s.sequenceHeader, err = utils.BoolWithDefault(config, SequenceHeader, DefaultSequenceHeader)
+	if err != nil {
+		return err
+	}
+	if s.sequenceHeader && s.sizes.Min() < sequence.HeaderSize {
+		return fmt.Errorf("Messages must be at least %d bytes to hold a sequence header, %d", sequence.HeaderSize, s.sizes.Min())
+	}
+	s.lateAfter, err = config.DurationWithDefault(LateAfter, DefaultLateAfter)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -80,13 +161,36 @@ func (s *Scheme) RunTime() time.Duration {
 	return s.runTime
 }
 
+func (s *Scheme) Summary() factory.Summary {
+	return factory.Summary{
+		MessageCount: s.messageCount,
+		ByteCount:    s.byteCount,
+		ErrorCount:   uint64(s.errorCount),
+		RunTime:      s.runTime,
+	}
+}
+
+// MessageSizes returns the sizes of the smallest and largest messages written.
+func (s *Scheme) MessageSizes() (int, int) {
+	return s.sizes.Min(), s.sizes.Max()
+}
+
+// SequenceStats returns the loss, reordering and duplication counts seen by a
+// reader when sequence headers are enabled.
+func (s *Scheme) SequenceStats() (sequence.Stats, bool) {
+	if s.tracker == nil {
+		return sequence.Stats{}, false
+	}
+	return s.tracker.Stats(), true
+}
+
 func (s *Scheme) RunWriter(writer factory.Writer) {
 	if s.warmupMessagesPerRun > 0 {
 		logs.Logger.Info("Writing %d warmup messages", s.warmupMessagesPerRun)
 	}
 
 	for i := 0; i < s.warmupMessagesPerRun; i++ {
-		writer.Write(s.buffer)
+		writer.Write(s.nextMessage())
 	}
 
 	if s.warmupMessagesPerRun > 0 {
@@ -94,11 +198,15 @@ func (s *Scheme) RunWriter(writer factory.Writer) {
 	}
 
 	logs.Logger.Info("Starting writing %d messages...", s.messagesPerRun)
-	startTime := time.Now()
+	s.startTime = time.Now()
 	for i := 0; i < s.messagesPerRun; i++ {
-		s.countMessage(writer.Write(s.buffer))
+		count, err := writer.Write(s.nextMessage())
+		s.countMessage(count, err)
+		if err == nil && s.buckets != nil {
+			s.buckets.Count(count)
+		}
 	}
-	s.runTime = time.Now().Sub(startTime)
+	s.runTime = time.Now().Sub(s.startTime)
 	logs.Logger.Info("Finished.")
 
 	err := writer.Close()
@@ -106,11 +214,20 @@ func (s *Scheme) RunWriter(writer factory.Writer) {
 		logs.Logger.Warning("Error closing writer, %s", err.Error())
 	}
 
-	s.outputReport()
+	s.outputReport(results.RoleWriter, writer)
 }
 
 func (s *Scheme) RunReader(reader factory.Reader) {
-	timer := time.NewTimer(time.Duration(1<<63 - 1))
+	if s.sequenceHeader {
+		s.tracker = sequence.NewTracker(s.lateAfter)
+		if s.messagesPerRun > 0 {
+			// Warmup messages take the first sequence numbers
+			first := uint64(s.warmupMessagesPerRun)
+			s.tracker.Expect(first, first+uint64(s.messagesPerRun)-1)
+		}
+	}
+
+	timer := s.startTimer()
 	wg := sync.WaitGroup{}
 	wg.Add(1)
 	go func() {
@@ -127,7 +244,33 @@ func (s *Scheme) RunReader(reader factory.Reader) {
 
 	wg.Wait()
 
-	s.outputReport()
+	s.outputReport(results.RoleReader, reader)
+}
+
+// Close stops a reader once no message has been read for the wait for last
+// message, even if no message was ever read.
+func (s *Scheme) Close() error {
+	s.timerLock.Lock()
+	defer s.timerLock.Unlock()
+
+	s.closed = true
+	if s.timer != nil {
+		s.timer.Reset(s.waitForLastMessage)
+	}
+	return nil
+}
+
+// startTimer returns the timer ending a read. It is armed by the first message
+// read or by Close.
+func (s *Scheme) startTimer() *time.Timer {
+	s.timerLock.Lock()
+	defer s.timerLock.Unlock()
+
+	s.timer = time.NewTimer(time.Duration(1<<63 - 1))
+	if s.closed {
+		s.timer.Reset(s.waitForLastMessage)
+	}
+	return s.timer
 }
 
 func (s *Scheme) runReader(reader factory.Reader, timer *time.Timer) {
@@ -135,8 +278,8 @@ func (s *Scheme) runReader(reader factory.Reader, timer *time.Timer) {
 		logs.Logger.Info("Reading %d warmup messages", s.warmupMessagesPerRun)
 	}
 
-	var startTime, lastMessageTime time.Time
-	buffer := make([]byte, s.bytesPerMessage*2)
+	var lastMessageTime time.Time
+	buffer := make([]byte, s.sizes.Max()*2)
 	for i := 0; i < s.warmupMessagesPerRun; i++ {
 		reader.Read(buffer)
 	}
@@ -149,22 +292,59 @@ func (s *Scheme) runReader(reader factory.Reader, timer *time.Timer) {
 		}
 
 		lastMessageTime = time.Now()
-		if startTime.IsZero() {
-			startTime = lastMessageTime
+		if s.startTime.IsZero() {
+			s.startTime = lastMessageTime
 		}
 
 		timer.Reset(s.waitForLastMessage)
 
 		s.countMessage(count, err)
+		if err == nil {
+			s.track(buffer[:count], lastMessageTime)
+		}
 	}
 	logs.Logger.Info("Finished.")
 
-	s.runTime = lastMessageTime.Sub(startTime)
+	s.runTime = lastMessageTime.Sub(s.startTime)
+}
+
+// nextMessage returns the next message, sized by the size distribution,
+// filled with the next payload and stamped with a sequence header when
+// enabled.
+func (s *Scheme) nextMessage() []byte {
+	message := s.buffer[:s.sizes.Size(s.nextSequence)]
+	if !s.static {
+		s.payload.Fill(message)
+	}
+	if s.sequenceHeader {
+		sequence.Stamp(message, s.nextSequence, time.Now())
+	}
+	s.nextSequence++
+
+	return message
+}
+
+// track records a message read by the sequence tracker and size buckets, when
+// enabled.
+func (s *Scheme) track(message []byte, received time.Time) {
+	if s.buckets != nil {
+		s.buckets.Count(len(message))
+	}
+	if s.tracker == nil {
+		return
+	}
+
+	number, first, ok := s.tracker.Observe(message, received)
+	if ok && s.buckets != nil {
+		s.buckets.Track(number, first)
+	}
 }
 
 func (s *Scheme) countMessage(count int, err error) {
 	s.byteCount += uint64(count)
-	if err != nil {
+	if err == nil {
+		s.messageCount++
+	} else {
 		s.errorCount++
 		if s.firstError == nil {
 			s.firstError = err
@@ -172,7 +352,9 @@ func (s *Scheme) countMessage(count int, err error) {
 	}
 }
 
-func (s *Scheme) outputReport() {
+// outputReport reports the run's summary, including the stats of the closed
+// adapter.
+func (s *Scheme) outputReport(role string, adapter io.Closer) {
 	bytesPerSec := utils.ByteSize(s.ByteCount()) * utils.ByteSize(time.Second) / utils.ByteSize(s.RunTime().Nanoseconds())
 	messagesPerSec := float64(s.messagesPerRun) * float64(time.Second) / float64(s.RunTime().Nanoseconds())
 
@@ -183,4 +365,30 @@ func (s *Scheme) outputReport() {
 	if s.FirstError() != nil {
 		logs.Logger.Info("First error: %s", s.FirstError().Error())
 	}
+
+	record := results.Record{
+		Kind:         results.KindSummary,
+		Role:         role,
+		Start:        s.startTime,
+		End:          s.startTime.Add(s.runTime),
+		MessageCount: s.messageCount,
+		ByteCount:    s.byteCount,
+		ErrorCount:   uint64(s.errorCount),
+	}
+	if stats, ok := s.SequenceStats(); ok {
+		logs.Logger.Info("Sequence: %d received, %d lost, %d out of order, %d duplicate, %d late",
+			stats.Received, stats.Lost, stats.OutOfOrder, stats.Duplicate, stats.Late)
+		record.Sequence = &stats
+	}
+	if s.buckets != nil {
+		record.SizeBuckets = s.buckets.Stats()
+		for _, bucket := range record.SizeBuckets {
+			logs.Logger.Info("%s", bucket.Describe(s.runTime))
+		}
+	}
+	record.AdapterStats = factory.CollectStats(adapter)
+	if len(record.AdapterStats) > 0 {
+		logs.Logger.Info("Adapter: %s", factory.DescribeStats(record.AdapterStats))
+	}
+	results.Emit(record)
 }
@@ -6,8 +6,12 @@ import (
 	"time"
 
 	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/factory"
+	"github.com/myshkin5/netspel/payload"
+	"github.com/myshkin5/netspel/results"
 	"github.com/myshkin5/netspel/schemes/internal/mocks"
 	"github.com/myshkin5/netspel/schemes/simple"
+	"github.com/myshkin5/netspel/sequence"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -57,6 +61,7 @@ var _ = Describe("Scheme", func() {
 			Expect(scheme.ByteCount()).To(BeEquivalentTo(100 * 1000))
 			Expect(scheme.ErrorCount()).To(BeZero())
 			Expect(scheme.RunTime()).To(BeNumerically(">", 0))
+			Expect(scheme.Summary().MessageCount).To(BeEquivalentTo(100))
 		})
 
 		It("reads messages from a reader", func() {
@@ -71,6 +76,38 @@ var _ = Describe("Scheme", func() {
 			Expect(scheme.ErrorCount()).To(BeEquivalentTo(1))
 			Expect(scheme.RunTime()).To(BeNumerically(">", time.Duration(0)))
 			Expect(scheme.FirstError()).To(Equal(firstError))
+
+			summary := scheme.Summary()
+			Expect(summary.MessageCount).To(BeEquivalentTo(2))
+			Expect(summary.ByteCount).To(BeEquivalentTo(1010))
+			Expect(summary.ErrorCount).To(BeEquivalentTo(1))
+			Expect(summary.RunTime).To(Equal(scheme.RunTime()))
+		})
+
+		It("stops a reader that never reads a message once closed", func() {
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				scheme.RunReader(reader)
+			}()
+
+			Consistently(done, 200*time.Millisecond).ShouldNot(BeClosed())
+
+			Expect(scheme.Close()).To(Succeed())
+			Eventually(done).Should(BeClosed())
+			Expect(scheme.Summary().MessageCount).To(BeZero())
+		})
+
+		It("reports the stats of a reader that collects them", func() {
+			sink := &recordingSink{}
+			results.SetSink(sink, factory.Config{})
+			defer results.SetSink(nil, factory.Config{})
+
+			reader.ReadMessages <- mocks.ReadMessage{Buffer: make([]byte, 1000), Error: nil}
+			scheme.RunReader(statsReader{reader})
+
+			Expect(sink.records).To(HaveLen(1))
+			Expect(sink.records[0].AdapterStats).To(Equal([]factory.Stat{{Name: "socket drops", Value: 3}}))
 		})
 
 		It("can read upto twice the size message as it is expected to read", func() {
@@ -155,4 +192,116 @@ var _ = Describe("Scheme", func() {
 			Eventually(scheme.ErrorCount).Should(BeEquivalentTo(0))
 		})
 	})
+
+	Context("with sequence headers", func() {
+		JustBeforeEach(func() {
+			config.SetString(simple.SequenceHeader, "true")
+			err := scheme.Init(config)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("stamps each message with a sequence number", func() {
+			wg := sync.WaitGroup{}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				scheme.RunWriter(writer)
+			}()
+
+			var sentMessage []byte
+			for i := 0; i < 100; i++ {
+				Eventually(writer.Messages).Should(Receive(&sentMessage))
+				number, sent, ok := sequence.Parse(sentMessage)
+				Expect(ok).To(BeTrue())
+				Expect(number).To(BeEquivalentTo(i))
+				Expect(sent).To(BeTemporally("~", time.Now(), time.Second))
+			}
+
+			wg.Wait()
+		})
+
+		It("reports lost, out of order and duplicate messages", func() {
+			for _, number := range []uint64{0, 1, 3, 2, 2, 6} {
+				message := make([]byte, 1000)
+				sequence.Stamp(message, number, time.Now())
+				reader.ReadMessages <- mocks.ReadMessage{Buffer: message, Error: nil}
+			}
+
+			scheme.RunReader(reader)
+
+			stats, ok := scheme.SequenceStats()
+			Expect(ok).To(BeTrue())
+			Expect(stats).To(Equal(sequence.Stats{
+				Received:   6,
+				Lost:       95,
+				OutOfOrder: 1,
+				Duplicate:  1,
+			}))
+		})
+
+		It("counts messages lost before the first and after the last received", func() {
+			config.SetInt(simple.MessagesPerRun, 5)
+			config.SetInt(simple.WarmupMessagesPerRun, 2)
+			Expect(scheme.Init(config)).To(Succeed())
+
+			for _, number := range []uint64{0, 1, 4, 5} {
+				message := make([]byte, 1000)
+				sequence.Stamp(message, number, time.Now())
+				reader.ReadMessages <- mocks.ReadMessage{Buffer: message, Error: nil}
+			}
+
+			scheme.RunReader(reader)
+
+			stats, ok := scheme.SequenceStats()
+			Expect(ok).To(BeTrue())
+			Expect(stats).To(Equal(sequence.Stats{Received: 2, Lost: 3}))
+		})
+
+		It("requires messages large enough for a header", func() {
+			config.SetInt(simple.BytesPerMessage, sequence.HeaderSize-1)
+			err := scheme.Init(config)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("with a payload", func() {
+		It("fills messages from the payload generator", func() {
+			config.SetInt(simple.BytesPerMessage, 6)
+			config.SetInt(simple.MessagesPerRun, 2)
+			config.SetString(payload.Type, payload.Text)
+			config.SetString(payload.Pattern, "abcd")
+			Expect(scheme.Init(config)).To(Succeed())
+
+			scheme.RunWriter(writer)
+
+			Expect(writer.Messages).To(Receive(Equal([]byte("abcdab"))))
+			Expect(writer.Messages).To(Receive(Equal([]byte("cdabcd"))))
+		})
+
+		It("rejects an unknown payload type", func() {
+			config.SetString(payload.Type, "emoji")
+			Expect(scheme.Init(config)).To(MatchError("Unknown payload type, emoji"))
+		})
+	})
 })
+
+type statsReader struct {
+	*mocks.MockReader
+}
+
+func (statsReader) Stats() []factory.Stat {
+	return []factory.Stat{{Name: "socket drops", Value: 3}}
+}
+
+type recordingSink struct {
+	records []results.Record
+}
+
+func (s *recordingSink) Write(record results.Record) error {
+	s.records = append(s.records, record)
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	return nil
+}
@@ -1,9 +1,16 @@
 package streaming
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
+	"github.com/myshkin5/netspel/clock"
+	"github.com/myshkin5/netspel/factory"
+	"github.com/myshkin5/netspel/histogram"
 	"github.com/myshkin5/netspel/logs"
+	"github.com/myshkin5/netspel/sequence"
+	"github.com/myshkin5/netspel/sizes"
 	"github.com/myshkin5/netspel/utils"
 )
 
@@ -22,6 +29,67 @@ type Report struct {
 	MessageCount uint32
 	ByteCount    uint64
 	ErrorCount   uint32
+
+	// Sequence holds the changes in sequence stats over the report cycle, nil
+	// unless the reader is tracking sequence headers.
+	Sequence *sequence.Stats
+
+	// Latency holds the one-way latencies, from the send timestamp to being
+	// read, of the messages read during the report cycle. It is nil unless the
+	// reader is tracking sequence headers and belongs to the reporter once
+	// reported.
+	Latency *histogram.Histogram
+
+	// Clock holds the estimated offset of the reader's clock from the
+	// writer's that latencies are corrected by, nil unless clock sync is
+	// enabled and the writer has sent an estimate.
+	Clock *clock.Estimate
+}
+
+// Summary holds the totals of a run. The per second rates are calculated
+// from each full report cycle.
+type Summary struct {
+	MessageCount uint64
+	ByteCount    uint64
+	ErrorCount   uint64
+	Elapsed      time.Duration
+
+	AverageMessagesPerSecond float64
+	MinMessagesPerSecond     float64
+	MaxMessagesPerSecond     float64
+
+	// Sequence holds the sequence stats for the whole run, nil unless the
+	// reader is tracking sequence headers.
+	Sequence *sequence.Stats
+
+	// Latency holds the one-way latencies of the whole run, nil unless the
+	// reader is tracking sequence headers.
+	Latency *histogram.Histogram
+
+	// Clock holds the clock offset estimate latencies are corrected by and
+	// ClockEstimates all the estimates the writer sent, usually one from
+	// before and one from after the run. Both are empty unless clock sync is
+	// enabled.
+	Clock          *clock.Estimate
+	ClockEstimates []clock.Estimate
+
+	// NegativeLatencies counts the latencies that were below zero once
+	// corrected by the clock offset and were recorded as zero. Any at all
+	// suggest the offset was overestimated.
+	NegativeLatencies uint64
+
+	// UncorrectedLatencies counts the messages read before the reader had a
+	// clock offset estimate. Their latencies can't be corrected and are left
+	// out of Latency.
+	UncorrectedLatencies uint64
+
+	// SizeBuckets holds the counts of messages by size, nil unless a size
+	// distribution other than fixed is used.
+	SizeBuckets []sizes.BucketStats
+
+	// AdapterStats holds the stats collected by adapters implementing
+	// factory.StatsCollector.
+	AdapterStats []factory.Stat
 }
 
 type Logger interface {
@@ -38,5 +106,80 @@ func (r *ReporterImpl) Report(report Report) {
 	percent := messagesPerSecond / float64(r.expectedMessagesPerSecond) * 100.0
 	errorsPerSecond := float64(report.ErrorCount) / r.secondsPerCycle
 	bytesPerSecond := utils.ByteSize(report.ByteCount) / utils.ByteSize(r.secondsPerCycle)
-	ReporterLogger.Info("%8d messages/s (%6.2f%%), %8d errors/s, %s/s", uint64(messagesPerSecond), percent, uint64(errorsPerSecond), bytesPerSecond.String())
+	if report.Sequence == nil {
+		ReporterLogger.Info("%8d messages/s (%6.2f%%), %8d errors/s, %s/s", uint64(messagesPerSecond), percent, uint64(errorsPerSecond), bytesPerSecond.String())
+		return
+	}
+
+	stats := report.Sequence
+	if report.Latency == nil || report.Latency.Count() == 0 {
+		ReporterLogger.Info("%8d messages/s (%6.2f%%), %8d errors/s, %s/s, %d lost, %d out of order, %d duplicate, %d late",
+			uint64(messagesPerSecond), percent, uint64(errorsPerSecond), bytesPerSecond.String(),
+			stats.Lost, stats.OutOfOrder, stats.Duplicate, stats.Late)
+		return
+	}
+
+	latency := report.Latency.Stats()
+	ReporterLogger.Info("%8d messages/s (%6.2f%%), %8d errors/s, %s/s, %d lost, %d out of order, %d duplicate, %d late, latency p50 %s, p99 %s, p99.9 %s, max %s%s",
+		uint64(messagesPerSecond), percent, uint64(errorsPerSecond), bytesPerSecond.String(),
+		stats.Lost, stats.OutOfOrder, stats.Duplicate, stats.Late,
+		latency.P50, latency.P99, latency.P999, latency.Max, errorBound(report.Clock))
+}
+
+// errorBound describes the error in latencies corrected by the clock offset
+// estimate, if any.
+func errorBound(estimate *clock.Estimate) string {
+	if estimate == nil {
+		return ""
+	}
+	return fmt.Sprintf(" (±%s)", estimate.ErrorBound())
+}
+
+func (r *ReporterImpl) Summarize(summary Summary) {
+	var bytesPerSecond utils.ByteSize
+	if summary.Elapsed > 0 {
+		bytesPerSecond = utils.ByteSize(summary.ByteCount) * utils.ByteSize(time.Second) / utils.ByteSize(summary.Elapsed)
+	}
+
+	ReporterLogger.Info("Total: %d messages, %d errors, %s in %s (%s/s)",
+		summary.MessageCount, summary.ErrorCount, utils.ByteSize(summary.ByteCount).String(), summary.Elapsed.String(), bytesPerSecond.String())
+	ReporterLogger.Info("Messages/s per report cycle: %.1f average, %.1f min, %.1f max",
+		summary.AverageMessagesPerSecond, summary.MinMessagesPerSecond, summary.MaxMessagesPerSecond)
+
+	if summary.Sequence != nil {
+		stats := summary.Sequence
+		ReporterLogger.Info("Sequence: %d received, %d lost, %d out of order, %d duplicate, %d late",
+			stats.Received, stats.Lost, stats.OutOfOrder, stats.Duplicate, stats.Late)
+	}
+
+	if summary.Latency != nil && summary.Latency.Count() > 0 {
+		latency := summary.Latency
+		ReporterLogger.Info("Latency: %d messages, p50 %s, p90 %s, p99 %s, p99.9 %s, max %s, mean %s%s",
+			latency.Count(), latency.Percentile(50), latency.Percentile(90), latency.Percentile(99),
+			latency.Percentile(99.9), latency.Max(), latency.Mean(), errorBound(summary.Clock))
+	}
+
+	if len(summary.ClockEstimates) > 0 {
+		estimates := make([]string, len(summary.ClockEstimates))
+		for i, estimate := range summary.ClockEstimates {
+			estimates[i] = estimate.String()
+		}
+		ReporterLogger.Info("Reader clock offsets from the writer: %s", strings.Join(estimates, ", "))
+	}
+	if summary.NegativeLatencies > 0 {
+		ReporterLogger.Info("Negative latencies: %d messages arrived before they were sent once corrected by the clock offset and were recorded as 0, the offset may be overestimated",
+			summary.NegativeLatencies)
+	}
+	if summary.UncorrectedLatencies > 0 {
+		ReporterLogger.Info("Uncorrected latencies: %d messages arrived before the first clock offset estimate and their latencies weren't recorded",
+			summary.UncorrectedLatencies)
+	}
+
+	for _, bucket := range summary.SizeBuckets {
+		ReporterLogger.Info("%s", bucket.Describe(summary.Elapsed))
+	}
+
+	if len(summary.AdapterStats) > 0 {
+		ReporterLogger.Info("Adapter: %s", factory.DescribeStats(summary.AdapterStats))
+	}
 }
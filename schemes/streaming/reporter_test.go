@@ -1,7 +1,12 @@
 package streaming_test
 
 import (
+	"github.com/myshkin5/netspel/clock"
+	"github.com/myshkin5/netspel/factory"
+	"github.com/myshkin5/netspel/histogram"
 	"github.com/myshkin5/netspel/schemes/streaming"
+	"github.com/myshkin5/netspel/sequence"
+	"github.com/myshkin5/netspel/sizes"
 
 	"fmt"
 	"time"
@@ -41,6 +46,151 @@ var _ = Describe("Reporter", func() {
 		expectLog("     500 messages/s ( 50.00%),      100 errors/s, 10.00 KB/s", 50, 1024, 10, 1000, 100*time.Millisecond)
 		expectLog("       5 messages/s (  0.50%),        1 errors/s, 1.00 KB/s", 50, 10240, 10, 1000, 10*time.Second)
 	})
+
+	It("reports sequence stats when present", func() {
+		reporter := streaming.ReporterImpl{}
+		reporter.Init(100, time.Second)
+		reporter.Report(streaming.Report{
+			MessageCount: 100,
+			ByteCount:    1024,
+			Sequence: &sequence.Stats{
+				Received:   100,
+				Lost:       3,
+				OutOfOrder: 2,
+				Duplicate:  1,
+				Late:       4,
+			},
+		})
+		Expect(logger.logs).To(Receive(Equal("     100 messages/s (100.00%),        0 errors/s, 1.00 KB/s, 3 lost, 2 out of order, 1 duplicate, 4 late")))
+	})
+
+	It("reports latency percentiles when present", func() {
+		latency := histogram.New()
+		for i := 1; i <= 1000; i++ {
+			latency.Record(time.Duration(i))
+		}
+
+		reporter := streaming.ReporterImpl{}
+		reporter.Init(100, time.Second)
+		reporter.Report(streaming.Report{
+			MessageCount: 100,
+			ByteCount:    1024,
+			Sequence:     &sequence.Stats{Received: 100},
+			Latency:      latency,
+		})
+		Expect(logger.logs).To(Receive(Equal("     100 messages/s (100.00%),        0 errors/s, 1.00 KB/s, 0 lost, 0 out of order, 0 duplicate, 0 late, " +
+			"latency p50 500ns, p99 990ns, p99.9 1µs, max 1µs")))
+	})
+
+	It("summarizes a run", func() {
+		reporter := streaming.ReporterImpl{}
+		reporter.Init(100, time.Second)
+		reporter.Summarize(streaming.Summary{
+			MessageCount:             300,
+			ByteCount:                3072,
+			ErrorCount:               2,
+			Elapsed:                  3 * time.Second,
+			AverageMessagesPerSecond: 100,
+			MinMessagesPerSecond:     90,
+			MaxMessagesPerSecond:     110,
+		})
+		Expect(logger.logs).To(Receive(Equal("Total: 300 messages, 2 errors, 3.00 KB in 3s (1.00 KB/s)")))
+		Expect(logger.logs).To(Receive(Equal("Messages/s per report cycle: 100.0 average, 90.0 min, 110.0 max")))
+		Expect(logger.logs).NotTo(Receive())
+
+		reporter.Summarize(streaming.Summary{
+			Sequence: &sequence.Stats{Received: 10, Lost: 1},
+		})
+		Expect(logger.logs).To(Receive(Equal("Total: 0 messages, 0 errors, 0.00 B in 0s (0.00 B/s)")))
+		Expect(logger.logs).To(Receive())
+		Expect(logger.logs).To(Receive(Equal("Sequence: 10 received, 1 lost, 0 out of order, 0 duplicate, 0 late")))
+	})
+
+	It("summarizes latency when present", func() {
+		latency := histogram.New()
+		latency.Record(1000)
+		latency.Record(2000)
+
+		reporter := streaming.ReporterImpl{}
+		reporter.Init(100, time.Second)
+		reporter.Summarize(streaming.Summary{
+			Latency: latency,
+		})
+		Expect(logger.logs).To(Receive())
+		Expect(logger.logs).To(Receive())
+		Expect(logger.logs).To(Receive(Equal("Latency: 2 messages, p50 1µs, p90 2µs, p99 2µs, p99.9 2µs, max 2µs, mean 1.5µs")))
+	})
+
+	It("states the clock error bound of corrected latencies", func() {
+		latency := histogram.New()
+		latency.Record(1000)
+		estimate := clock.Estimate{Offset: -2 * time.Millisecond, RoundTrip: 100 * time.Microsecond}
+
+		reporter := streaming.ReporterImpl{}
+		reporter.Init(100, time.Second)
+		reporter.Report(streaming.Report{
+			Sequence: &sequence.Stats{Received: 1},
+			Latency:  latency,
+			Clock:    &estimate,
+		})
+		Expect(logger.logs).To(Receive(HaveSuffix("latency p50 1µs, p99 1µs, p99.9 1µs, max 1µs (±50µs)")))
+
+		reporter.Summarize(streaming.Summary{
+			Latency:        latency,
+			Clock:          &estimate,
+			ClockEstimates: []clock.Estimate{estimate, {Offset: -3 * time.Millisecond, RoundTrip: 200 * time.Microsecond}},
+		})
+		Expect(logger.logs).To(Receive())
+		Expect(logger.logs).To(Receive())
+		Expect(logger.logs).To(Receive(HaveSuffix("mean 1µs (±50µs)")))
+		Expect(logger.logs).To(Receive(Equal("Reader clock offsets from the writer: -2ms ±50µs, -3ms ±100µs")))
+	})
+
+	It("summarizes size buckets", func() {
+		reporter := streaming.ReporterImpl{}
+		reporter.Init(100, time.Second)
+		reporter.Summarize(streaming.Summary{
+			Elapsed: time.Second,
+			SizeBuckets: []sizes.BucketStats{
+				{Label: "1-64", Messages: 10, Bytes: 640},
+			},
+		})
+		Expect(logger.logs).To(Receive())
+		Expect(logger.logs).To(Receive())
+		Expect(logger.logs).To(Receive(Equal("Size 1-64 bytes: 10 messages (10.0/s), 640.00 B (640.00 B/s)")))
+	})
+
+	It("summarizes latencies made negative by the clock offset", func() {
+		reporter := streaming.ReporterImpl{}
+		reporter.Init(100, time.Second)
+		reporter.Summarize(streaming.Summary{NegativeLatencies: 4})
+		Expect(logger.logs).To(Receive())
+		Expect(logger.logs).To(Receive())
+		Expect(logger.logs).To(Receive(HavePrefix("Negative latencies: 4 messages")))
+	})
+
+	It("summarizes latencies read before the first clock estimate", func() {
+		reporter := streaming.ReporterImpl{}
+		reporter.Init(100, time.Second)
+		reporter.Summarize(streaming.Summary{UncorrectedLatencies: 2})
+		Expect(logger.logs).To(Receive())
+		Expect(logger.logs).To(Receive())
+		Expect(logger.logs).To(Receive(HavePrefix("Uncorrected latencies: 2 messages")))
+	})
+
+	It("summarizes adapter stats", func() {
+		reporter := streaming.ReporterImpl{}
+		reporter.Init(100, time.Second)
+		reporter.Summarize(streaming.Summary{
+			AdapterStats: []factory.Stat{
+				{Name: "socket drops", Value: 12},
+				{Name: "host RcvbufErrors", Value: 15},
+			},
+		})
+		Expect(logger.logs).To(Receive())
+		Expect(logger.logs).To(Receive())
+		Expect(logger.logs).To(Receive(Equal("Adapter: 12 socket drops, 15 host RcvbufErrors")))
+	})
 })
 
 type mockLogger struct {
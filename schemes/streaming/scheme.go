@@ -1,14 +1,22 @@
 package streaming
 
 import (
+	"fmt"
 	"io"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/clock"
 	"github.com/myshkin5/netspel/factory"
+	"github.com/myshkin5/netspel/histogram"
 	"github.com/myshkin5/netspel/logs"
+	"github.com/myshkin5/netspel/payload"
+	"github.com/myshkin5/netspel/results"
+	"github.com/myshkin5/netspel/sequence"
+	"github.com/myshkin5/netspel/sizes"
+	"github.com/myshkin5/netspel/utils"
 )
 
 const (
@@ -18,56 +26,169 @@ const (
 	ExpectedMessagesPerSecond = prefix + "expected-messages-per-second"
 	BytesPerMessage           = prefix + "bytes-per-message"
 	ReportCycle               = prefix + "report-cycle"
+	SequenceHeader            = prefix + "sequence-header"
+	LateAfter                 = prefix + "late-after"
+	Duration                  = prefix + "duration"
+	MaxMessages               = prefix + "max-messages"
 
 	DefaultMessagesPerSecond         = 1000
 	DefaultExpectedMessagesPerSecond = 0
 	DefaultBytesPerMessage           = 1024
 	DefaultReportCycle               = time.Second
+	DefaultSequenceHeader            = false
+	DefaultLateAfter                 = time.Second
+	DefaultDuration                  = 0
+	DefaultMaxMessages               = 0
 )
 
+var configKeys = append(append(append([]factory.ConfigKey{
+	{Path: MessagesPerSecond, Type: factory.IntType, Default: fmt.Sprint(DefaultMessagesPerSecond), Range: factory.AtLeast(0),
+		Doc: "The count of messages written and read per second. When zero, messages are written and read as quickly as possible."},
+	{Path: ExpectedMessagesPerSecond, Type: factory.IntType, Default: fmt.Sprint(DefaultExpectedMessagesPerSecond), Range: factory.AtLeast(0),
+		Doc: "The count of messages expected per second when calculating throughput percent. When zero, matches messages-per-second."},
+	{Path: BytesPerMessage, Type: factory.IntType, Default: fmt.Sprint(DefaultBytesPerMessage), Range: factory.AtLeast(1),
+		Doc: "The count of bytes per message when using the fixed size distribution."},
+	{Path: ReportCycle, Type: factory.DurationType, Default: fmt.Sprint(DefaultReportCycle),
+		Doc: "The length of time between reports."},
+	{Path: SequenceHeader, Type: factory.BoolType, Default: fmt.Sprint(DefaultSequenceHeader),
+		Doc: "When true, messages are stamped with a sequence number and send timestamp so the reader reports lost, out of order, duplicate and late messages and latency."},
+	{Path: Duration, Type: factory.DurationType, Default: fmt.Sprint(time.Duration(DefaultDuration)), Range: factory.AtLeast(0),
+		Doc: "Stops the run after this length of time. When zero, the run isn't limited by time."},
+	{Path: MaxMessages, Type: factory.IntType, Default: fmt.Sprint(DefaultMaxMessages), Range: factory.AtLeast(0),
+		Doc: "Stops the run after this count of messages. When zero, the run isn't limited by message count."},
+	{Path: LateAfter, Type: factory.DurationType, Default: fmt.Sprint(DefaultLateAfter),
+		Doc: "Messages received longer than this after their send timestamp are counted as late. Used only in read mode."},
+}, payload.ConfigKeys...), sizes.ConfigKeys...), clock.ConfigKeys...)
+
+func init() {
+	factory.RegisterScheme(factory.Descriptor{
+		Name:        "streaming",
+		Description: "Writes messages at a steady rate and reports throughput each cycle.",
+		Config:      configKeys,
+	}, func() factory.Scheme {
+		return &Scheme{}
+	})
+}
+
 type Scheme struct {
 	buffer       []byte
+	payload      payload.Generator
+	static       bool
+	sizes        sizes.Sizes
+	buckets      *sizes.Counter
 	messageCount uint32
 	byteCount    uint64
 	errorCount   uint32
 
+	nextSequence  uint64
+	tracker       *sequence.Tracker
+	previousStats sequence.Stats
+
+	// latencyLock guards latency, clockEstimate and the latency counts which
+	// the reporter collects each cycle while the reader records into them
+	latencyLock          sync.Mutex
+	latency              *histogram.Histogram
+	clockEstimate        *clock.Estimate
+	negativeLatencies    uint64
+	uncorrectedLatencies uint64
+
+	clock       *clock.Config
+	clockServer *clock.Server
+
 	messagesPerSecond int
 	bytesPerMessage   int
 	reportCycle       time.Duration
-
-	tickerTime time.Duration
-	closed     int32
-	done       sync.WaitGroup
+	sequenceHeader    bool
+	lateAfter         time.Duration
+	duration          time.Duration
+	maxMessages       int
+
+	startTime time.Time
+	totals    Summary
+	cycles    int
+
+	tickerTime   time.Duration
+	closed       int32
+	stopOnce     sync.Once
+	stopping     chan struct{}
+	reporterDone chan struct{}
+	done         sync.WaitGroup
+	reporter     Reporter
+
+	// closerLock guards closer which Close reads from another goroutine
+	closerLock sync.Mutex
 	closer     io.Closer
-	reporter   Reporter
 }
 
 type Reporter interface {
 	Init(expectedMessagesPerSecond int, reportCycle time.Duration)
 	Report(report Report)
+	Summarize(summary Summary)
 }
 
 func (s *Scheme) Init(config jsonstruct.JSONStruct) error {
 	s.messagesPerSecond = config.IntWithDefault(MessagesPerSecond, DefaultMessagesPerSecond)
 	expectedMessagesPerSecond := config.IntWithDefault(ExpectedMessagesPerSecond, DefaultExpectedMessagesPerSecond)
 	s.bytesPerMessage = config.IntWithDefault(BytesPerMessage, DefaultBytesPerMessage)
+	s.maxMessages = config.IntWithDefault(MaxMessages, DefaultMaxMessages)
 
 	var err error
 	s.reportCycle, err = config.DurationWithDefault(ReportCycle, DefaultReportCycle)
 	if err != nil {
 		return err
 	}
+	s.duration, err = config.DurationWithDefault(Duration, DefaultDuration)
+	if err != nil {
+		return err
+	}
+
+	s.payload, err = payload.New(config)
+	if err != nil {
+		return err
+	}
+
+	s.sizes, err = sizes.New(config, s.bytesPerMessage)
+	if err != nil {
+		return err
+	}
+	s.buckets, err = sizes.NewCounter(config, s.sizes)
+	if err != nil {
+		return err
+	}
+
+	s.sequenceHeader, err = utils.BoolWithDefault(config, SequenceHeader, DefaultSequenceHeader)
+	if err != nil {
+		return err
+	}
+	if s.sequenceHeader && s.sizes.Min() < sequence.HeaderSize {
+		return fmt.Errorf("Messages must be at least %d bytes to hold a sequence header, %d", sequence.HeaderSize, s.sizes.Min())
+	}
+	s.lateAfter, err = config.DurationWithDefault(LateAfter, DefaultLateAfter)
+	if err != nil {
+		return err
+	}
+	s.clock, err = clock.NewConfig(config)
+	if err != nil {
+		return err
+	}
+	if s.clock != nil && !s.sequenceHeader {
+		return fmt.Errorf("Clock sync requires sequence headers, %s", SequenceHeader)
+	}
 
 	if expectedMessagesPerSecond == 0 {
 		expectedMessagesPerSecond = s.messagesPerSecond
 	}
 
-	s.buffer = make([]byte, s.bytesPerMessage)
+	s.buffer = make([]byte, s.sizes.Max())
+	s.static = payload.Static(s.payload)
+	if s.static {
+		s.payload.Fill(s.buffer)
+	}
 	if s.messagesPerSecond > 0 {
 		s.tickerTime = time.Second / time.Duration(s.messagesPerSecond)
 	}
 
-	s.done.Add(1)
+	s.stopping = make(chan struct{})
 
 	if s.reporter == nil {
 		s.reporter = &ReporterImpl{}
@@ -81,10 +202,27 @@ func (s *Scheme) SetReporter(reporter Reporter) {
 	s.reporter = reporter
 }
 
+// MessageSizes returns the sizes of the smallest and largest messages written.
+func (s *Scheme) MessageSizes() (int, int) {
+	return s.sizes.Min(), s.sizes.Max()
+}
+
+// Summary returns the totals of a finished run.
+func (s *Scheme) Summary() factory.Summary {
+	return factory.Summary{
+		MessageCount: s.totals.MessageCount,
+		ByteCount:    s.totals.ByteCount,
+		ErrorCount:   s.totals.ErrorCount,
+		RunTime:      s.totals.Elapsed,
+	}
+}
+
 func (s *Scheme) RunWriter(writer factory.Writer) {
-	s.closer = writer
-	defer s.done.Done()
-	s.startReporter()
+	if s.begin(writer) {
+		defer s.done.Done()
+	}
+	s.probeClock("before")
+	s.start(results.RoleWriter)
 
 	var ticker *time.Ticker
 	if s.tickerTime > 0 {
@@ -92,7 +230,7 @@ func (s *Scheme) RunWriter(writer factory.Writer) {
 		defer ticker.Stop()
 	}
 
-	for {
+	for i := 0; s.maxMessages == 0 || i < s.maxMessages; i++ {
 		if ticker != nil {
 			<-ticker.C
 		}
@@ -101,17 +239,48 @@ func (s *Scheme) RunWriter(writer factory.Writer) {
 			break
 		}
 
-		count, err := writer.Write(s.buffer)
+		message := s.buffer[:s.sizes.Size(s.nextSequence)]
+		if !s.static {
+			s.payload.Fill(message)
+		}
+		if s.sequenceHeader {
+			sequence.Stamp(message, s.nextSequence, time.Now())
+		}
+		s.nextSequence++
+
+		count, err := writer.Write(message)
+		if err != nil && s.isClosed() {
+			break
+		}
 		s.countMessage(count, err)
+		if err == nil && s.buckets != nil {
+			s.buckets.Count(count)
+		}
 	}
+
+	s.probeClock("after")
+	s.finish(results.RoleWriter, writer)
 }
 
 func (s *Scheme) RunReader(reader factory.Reader) {
-	s.closer = reader
-	defer s.done.Done()
-	s.startReporter()
+	if s.begin(reader) {
+		defer s.done.Done()
+	}
+	if s.sequenceHeader {
+		s.tracker = sequence.NewTracker(s.lateAfter)
+		s.latency = histogram.New()
+		s.totals.Latency = histogram.New()
+	}
+	if s.clock != nil {
+		var err error
+		s.clockServer, err = clock.Listen(*s.clock)
+		if err != nil {
+			logs.Logger.Warning("Error starting the clock server, latencies won't be corrected, %s", err.Error())
+		}
+	}
+	s.start(results.RoleReader)
 
-	buffer := make([]byte, s.bytesPerMessage*2)
+	buffer := make([]byte, s.sizes.Max()*2)
 
 	var ticker *time.Ticker
 	if s.tickerTime > 0 {
@@ -119,7 +288,7 @@ func (s *Scheme) RunReader(reader factory.Reader) {
 		defer ticker.Stop()
 	}
 
-	for {
+	for i := 0; s.maxMessages == 0 || i < s.maxMessages; {
 		if ticker != nil {
 			<-ticker.C
 		}
@@ -129,26 +298,127 @@ func (s *Scheme) RunReader(reader factory.Reader) {
 		}
 
 		count, err := reader.Read(buffer)
+		if err == io.EOF || (err != nil && s.isClosed()) {
+			break
+		}
 		s.countMessage(count, err)
+		if err == nil {
+			i++
+			s.track(buffer[:count])
+		}
 	}
+
+	s.finish(results.RoleReader, reader)
 }
 
+// Close stops a run early. The run still reports its summary before
+// RunWriter or RunReader returns. Close only waits for a run that has begun; a
+// run begun after Close stops straight away.
 func (s *Scheme) Close() error {
-	atomic.StoreInt32(&s.closed, 1)
-	if s.closer != nil {
-		err := s.closer.Close()
+	err := s.stop()
+	s.done.Wait()
+	return err
+}
+
+func (s *Scheme) stop() error {
+	var err error
+	s.stopOnce.Do(func() {
+		atomic.StoreInt32(&s.closed, 1)
+		close(s.stopping)
+
+		s.closerLock.Lock()
+		closer := s.closer
+		s.closerLock.Unlock()
+		if closer != nil {
+			err = closer.Close()
+		}
+	})
+	return err
+}
+
+// begin sets the adapter Close closes and returns true when Close must wait
+// for the run. The adapter is closed instead when the scheme already is.
+func (s *Scheme) begin(closer io.Closer) bool {
+	s.closerLock.Lock()
+	defer s.closerLock.Unlock()
+
+	if s.isClosed() {
+		err := closer.Close()
 		if err != nil {
-			return err
+			logs.Logger.Warning("Error closing adapter, %s", err.Error())
 		}
+		return false
 	}
-	s.done.Wait()
-	return nil
+
+	s.closer = closer
+	s.done.Add(1)
+	return true
 }
 
 func (s *Scheme) isClosed() bool {
 	return atomic.LoadInt32(&s.closed) == 1
 }
 
+// probeClock estimates the offset of the reader's clock, when enabled, and
+// sends the estimate to the reader to correct its latencies.
+func (s *Scheme) probeClock(when string) {
+	if s.clock == nil {
+		return
+	}
+
+	estimate, err := clock.Probe(*s.clock)
+	if err != nil {
+		logs.Logger.Warning("Error estimating the reader's clock offset %s the run, %s", when, err.Error())
+		return
+	}
+	logs.Logger.Info("Reader clock offset %s the run: %s (round trip %s)", when, estimate, estimate.RoundTrip)
+}
+
+// track records a message read by the sequence tracker, latency histogram and
+// size buckets, when enabled. With clock sync, latencies of messages read
+// before the first clock estimate arrives are counted but not recorded so the
+// histogram only holds corrected latencies.
+func (s *Scheme) track(message []byte) {
+	if s.buckets != nil {
+		s.buckets.Count(len(message))
+	}
+	if s.tracker == nil {
+		return
+	}
+
+	received := time.Now()
+	number, first, ok := s.tracker.Observe(message, received)
+	if !ok {
+		return
+	}
+
+	_, sent, _ := sequence.Parse(message)
+	s.latencyLock.Lock()
+	if s.clockEstimate == nil && s.clockServer != nil {
+		estimate, ok := s.clockServer.First()
+		if ok {
+			s.clockEstimate = &estimate
+		}
+	}
+	latency := received.Sub(sent)
+	if s.clockEstimate != nil {
+		latency -= s.clockEstimate.Offset
+		if latency < 0 {
+			s.negativeLatencies++
+		}
+	}
+	if s.clockServer != nil && s.clockEstimate == nil {
+		s.uncorrectedLatencies++
+	} else {
+		s.latency.Record(latency)
+	}
+	s.latencyLock.Unlock()
+
+	if s.buckets != nil {
+		s.buckets.Track(number, first)
+	}
+}
+
 func (s *Scheme) countMessage(count int, err error) {
 	if err != nil {
 		logs.Logger.Debug("Adapter error, %v", err)
@@ -162,24 +432,155 @@ func (s *Scheme) countMessage(count int, err error) {
 	}
 }
 
-func (s *Scheme) startReporter() {
-	s.done.Add(1)
+func (s *Scheme) start(role string) {
+	s.startTime = time.Now()
+	s.reporterDone = make(chan struct{})
+
+	if s.duration > 0 {
+		time.AfterFunc(s.duration, func() {
+			err := s.stop()
+			if err != nil {
+				logs.Logger.Warning("Error closing adapter, %s", err.Error())
+			}
+		})
+	}
 
 	go func() {
-		defer s.done.Done()
+		defer close(s.reporterDone)
 
+		lastReport := s.startTime
 		ticker := time.NewTicker(s.reportCycle)
+		defer ticker.Stop()
 		for {
-			<-ticker.C
-			if s.isClosed() {
-				break
+			select {
+			case now := <-ticker.C:
+				if s.isClosed() {
+					return
+				}
+
+				report := s.collect()
+				s.countCycle(report)
+				s.reporter.Report(report)
+
+				var latency *histogram.Stats
+				if report.Latency != nil {
+					stats := report.Latency.Stats()
+					latency = &stats
+				}
+				results.Emit(results.Record{
+					Kind:         results.KindInterval,
+					Role:         role,
+					Start:        lastReport,
+					End:          now,
+					MessageCount: uint64(report.MessageCount),
+					ByteCount:    report.ByteCount,
+					ErrorCount:   uint64(report.ErrorCount),
+					Sequence:     report.Sequence,
+					Latency:      latency,
+					Clock:        report.Clock,
+				})
+				lastReport = now
+			case <-s.stopping:
+				return
 			}
-
-			report := Report{}
-			report.MessageCount = atomic.SwapUint32(&s.messageCount, 0)
-			report.ByteCount = atomic.SwapUint64(&s.byteCount, 0)
-			report.ErrorCount = atomic.SwapUint32(&s.errorCount, 0)
-			s.reporter.Report(report)
 		}
 	}()
 }
+
+// collect takes the counts since the last collection and adds them to the
+// run's totals.
+func (s *Scheme) collect() Report {
+	report := Report{}
+	report.MessageCount = atomic.SwapUint32(&s.messageCount, 0)
+	report.ByteCount = atomic.SwapUint64(&s.byteCount, 0)
+	report.ErrorCount = atomic.SwapUint32(&s.errorCount, 0)
+	if s.tracker != nil {
+		stats := s.tracker.Stats()
+		delta := stats.Sub(s.previousStats)
+		s.previousStats = stats
+		report.Sequence = &delta
+	}
+	if s.latency != nil {
+		s.latencyLock.Lock()
+		report.Latency = s.latency
+		report.Clock = s.clockEstimate
+		s.latency = histogram.New()
+		s.latencyLock.Unlock()
+		s.totals.Latency.Merge(report.Latency)
+	}
+
+	s.totals.MessageCount += uint64(report.MessageCount)
+	s.totals.ByteCount += report.ByteCount
+	s.totals.ErrorCount += uint64(report.ErrorCount)
+
+	return report
+}
+
+func (s *Scheme) countCycle(report Report) {
+	rate := float64(report.MessageCount) / s.reportCycle.Seconds()
+	if s.cycles == 0 || rate < s.totals.MinMessagesPerSecond {
+		s.totals.MinMessagesPerSecond = rate
+	}
+	if s.cycles == 0 || rate > s.totals.MaxMessagesPerSecond {
+		s.totals.MaxMessagesPerSecond = rate
+	}
+	s.totals.AverageMessagesPerSecond = (s.totals.AverageMessagesPerSecond*float64(s.cycles) + rate) / float64(s.cycles+1)
+	s.cycles++
+}
+
+// finish stops the reporter and reports the run's summary. Counts from a
+// partial final report cycle are included in the totals but not in the per
+// cycle rates.
+func (s *Scheme) finish(role string, adapter io.Closer) {
+	err := s.stop()
+	if err != nil {
+		logs.Logger.Warning("Error closing adapter, %s", err.Error())
+	}
+	<-s.reporterDone
+
+	s.collect()
+	s.totals.Elapsed = time.Since(s.startTime)
+	if s.tracker != nil {
+		stats := s.tracker.Stats()
+		s.totals.Sequence = &stats
+	}
+	if s.buckets != nil {
+		s.totals.SizeBuckets = s.buckets.Stats()
+	}
+	if s.clockServer != nil {
+		s.totals.Clock = s.clockEstimate
+		s.totals.ClockEstimates = s.clockServer.Estimates()
+		s.latencyLock.Lock()
+		s.totals.NegativeLatencies = s.negativeLatencies
+		s.totals.UncorrectedLatencies = s.uncorrectedLatencies
+		s.latencyLock.Unlock()
+		err = s.clockServer.Close()
+		if err != nil {
+			logs.Logger.Warning("Error closing the clock server, %s", err.Error())
+		}
+	}
+	s.totals.AdapterStats = factory.CollectStats(adapter)
+
+	s.reporter.Summarize(s.totals)
+
+	var latency *histogram.Stats
+	if s.totals.Latency != nil {
+		stats := s.totals.Latency.Stats()
+		latency = &stats
+	}
+
+	results.Emit(results.Record{
+		Kind:         results.KindSummary,
+		Role:         role,
+		Start:        s.startTime,
+		End:          s.startTime.Add(s.totals.Elapsed),
+		MessageCount: s.totals.MessageCount,
+		ByteCount:    s.totals.ByteCount,
+		ErrorCount:   s.totals.ErrorCount,
+		Sequence:     s.totals.Sequence,
+		Latency:      latency,
+		Clock:        s.totals.Clock,
+		SizeBuckets:  s.totals.SizeBuckets,
+		AdapterStats: s.totals.AdapterStats,
+	})
+}
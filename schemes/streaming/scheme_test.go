@@ -2,8 +2,12 @@ package streaming_test
 
 import (
 	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/clock"
+	"github.com/myshkin5/netspel/payload"
 	"github.com/myshkin5/netspel/schemes/internal/mocks"
 	"github.com/myshkin5/netspel/schemes/streaming"
+	"github.com/myshkin5/netspel/sequence"
+	"github.com/myshkin5/netspel/sizes"
 
 	"sync"
 	"time"
@@ -27,7 +31,8 @@ var _ = Describe("Scheme", func() {
 		scheme = &streaming.Scheme{}
 		config = jsonstruct.New()
 		reporter = &mockReporter{
-			reports: make(chan streaming.Report, 100),
+			reports:   make(chan streaming.Report, 100),
+			summaries: make(chan streaming.Summary, 1),
 		}
 		scheme.SetReporter(reporter)
 	})
@@ -140,10 +145,437 @@ var _ = Describe("Scheme", func() {
 	})
 })
 
+var _ = Describe("Scheme summaries and limits", func() {
+	var (
+		writer   *mocks.MockWriter
+		reader   *mocks.MockReader
+		scheme   *streaming.Scheme
+		config   jsonstruct.JSONStruct
+		reporter *mockReporter
+	)
+
+	BeforeEach(func() {
+		writer = mocks.NewMockWriter()
+		reader = mocks.NewMockReader()
+		scheme = &streaming.Scheme{}
+		config = jsonstruct.New()
+		config.SetInt(streaming.MessagesPerSecond, 0)
+		config.SetDuration(streaming.ReportCycle, 50*time.Millisecond)
+		reporter = &mockReporter{
+			reports:   make(chan streaming.Report, 100),
+			summaries: make(chan streaming.Summary, 1),
+		}
+		scheme.SetReporter(reporter)
+	})
+
+	It("summarizes the run when closed", func() {
+		Expect(scheme.Init(config)).To(Succeed())
+		for i := 0; i < 3; i++ {
+			reader.ReadMessages <- mocks.ReadMessage{Buffer: make([]byte, 100), Error: nil}
+		}
+
+		done := make(chan struct{})
+		go func() {
+			scheme.RunReader(reader)
+			close(done)
+		}()
+
+		var report streaming.Report
+		Eventually(reporter.reports, 100*time.Millisecond).Should(Receive(&report))
+		Expect(report.MessageCount).To(BeEquivalentTo(3))
+
+		reader.ReadMessages <- mocks.ReadMessage{Buffer: make([]byte, 100), Error: nil}
+		Eventually(reader.ReadMessages).Should(BeEmpty())
+
+		Expect(scheme.Close()).To(Succeed())
+		Eventually(done).Should(BeClosed())
+
+		var summary streaming.Summary
+		Expect(reporter.summaries).To(Receive(&summary))
+		Expect(summary.MessageCount).To(BeEquivalentTo(4))
+		Expect(summary.ByteCount).To(BeEquivalentTo(400))
+		Expect(summary.ErrorCount).To(BeZero())
+		Expect(summary.Elapsed).To(BeNumerically(">=", 50*time.Millisecond))
+		Expect(summary.MaxMessagesPerSecond).To(BeNumerically(">=", 60))
+		Expect(summary.MinMessagesPerSecond).To(BeNumerically("<=", summary.AverageMessagesPerSecond))
+
+		Expect(scheme.Summary().MessageCount).To(BeEquivalentTo(4))
+		Expect(scheme.Summary().RunTime).To(Equal(summary.Elapsed))
+	})
+
+	It("closes without waiting when no run has begun", func() {
+		Expect(scheme.Init(config)).To(Succeed())
+
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			Expect(scheme.Close()).To(Succeed())
+		}()
+		Eventually(closed).Should(BeClosed())
+
+		scheme.RunWriter(writer)
+		Expect(writer.Messages).To(BeEmpty())
+		Expect(reporter.summaries).To(Receive())
+	})
+
+	It("stops writing after the maximum count of messages", func() {
+		config.SetInt(streaming.MaxMessages, 25)
+		Expect(scheme.Init(config)).To(Succeed())
+
+		scheme.RunWriter(writer)
+
+		Expect(writer.Messages).To(HaveLen(25))
+		var summary streaming.Summary
+		Expect(reporter.summaries).To(Receive(&summary))
+		Expect(summary.MessageCount).To(BeEquivalentTo(25))
+		Expect(summary.ByteCount).To(BeEquivalentTo(25 * 1024))
+	})
+
+	It("stops reading after the maximum count of messages", func() {
+		config.SetInt(streaming.MaxMessages, 2)
+		Expect(scheme.Init(config)).To(Succeed())
+		for i := 0; i < 3; i++ {
+			reader.ReadMessages <- mocks.ReadMessage{Buffer: make([]byte, 10), Error: nil}
+		}
+
+		scheme.RunReader(reader)
+
+		var summary streaming.Summary
+		Expect(reporter.summaries).To(Receive(&summary))
+		Expect(summary.MessageCount).To(BeEquivalentTo(2))
+	})
+
+	It("stops after the configured duration", func() {
+		config.SetInt(streaming.MessagesPerSecond, 100)
+		config.SetDuration(streaming.Duration, 120*time.Millisecond)
+		Expect(scheme.Init(config)).To(Succeed())
+
+		done := make(chan struct{})
+		go func() {
+			scheme.RunWriter(writer)
+			close(done)
+		}()
+
+		Eventually(done, time.Second).Should(BeClosed())
+		var summary streaming.Summary
+		Expect(reporter.summaries).To(Receive(&summary))
+		Expect(summary.Elapsed).To(BeNumerically("~", 120*time.Millisecond, 60*time.Millisecond))
+		Expect(summary.MessageCount).To(BeNumerically("~", 12, 3))
+
+		Expect(scheme.Close()).To(Succeed())
+	})
+
+	It("fills messages from the payload generator", func() {
+		config.SetInt(streaming.BytesPerMessage, 6)
+		config.SetInt(streaming.MaxMessages, 2)
+		config.SetString(payload.Type, payload.Text)
+		config.SetString(payload.Pattern, "abcd")
+		Expect(scheme.Init(config)).To(Succeed())
+
+		scheme.RunWriter(writer)
+
+		Expect(writer.Messages).To(Receive(Equal([]byte("abcdab"))))
+		Expect(writer.Messages).To(Receive(Equal([]byte("cdabcd"))))
+	})
+
+	It("sizes messages by the size distribution", func() {
+		config.SetInt(streaming.MaxMessages, 200)
+		config.SetString(sizes.Distribution, sizes.Uniform)
+		config.SetInt(sizes.Min, 16)
+		config.SetInt(sizes.Max, 100)
+		config.SetString(sizes.Buckets, "50")
+		Expect(scheme.Init(config)).To(Succeed())
+
+		scheme.RunWriter(writer)
+
+		seen := map[int]bool{}
+		for i := 0; i < 200; i++ {
+			var message []byte
+			Expect(writer.Messages).To(Receive(&message))
+			Expect(len(message)).To(BeNumerically(">=", 16))
+			Expect(len(message)).To(BeNumerically("<=", 100))
+			seen[len(message)] = true
+		}
+		Expect(len(seen)).To(BeNumerically(">", 10))
+
+		var summary streaming.Summary
+		Expect(reporter.summaries).To(Receive(&summary))
+		Expect(summary.SizeBuckets).To(HaveLen(2))
+		Expect(summary.SizeBuckets[0].Label).To(Equal("1-50"))
+		Expect(summary.SizeBuckets[0].Messages + summary.SizeBuckets[1].Messages).To(BeEquivalentTo(200))
+		Expect(summary.SizeBuckets[0].Bytes + summary.SizeBuckets[1].Bytes).To(Equal(summary.ByteCount))
+	})
+
+	It("counts lost messages by size when reading sequence headers", func() {
+		config.SetString(sizes.Distribution, sizes.Weighted)
+		config.SetString(sizes.Table, "20:1,1000:1")
+		config.SetString(sizes.Buckets, "64")
+		config.SetString(streaming.SequenceHeader, "true")
+		config.SetInt(streaming.MaxMessages, 2)
+		Expect(scheme.Init(config)).To(Succeed())
+
+		distribution, err := sizes.New(config, 0)
+		Expect(err).NotTo(HaveOccurred())
+		var lostSmall, lostLarge int64
+		for number := uint64(0); number < 3; number++ {
+			if number == 1 {
+				if distribution.Size(number) == 20 {
+					lostSmall++
+				} else {
+					lostLarge++
+				}
+				continue
+			}
+			message := make([]byte, distribution.Size(number))
+			sequence.Stamp(message, number, time.Now())
+			reader.ReadMessages <- mocks.ReadMessage{Buffer: message, Error: nil}
+		}
+
+		scheme.RunReader(reader)
+
+		var summary streaming.Summary
+		Expect(reporter.summaries).To(Receive(&summary))
+		lost := map[string]int64{}
+		for _, bucket := range summary.SizeBuckets {
+			Expect(bucket.Lost).NotTo(BeNil())
+			lost[bucket.Label] = *bucket.Lost
+		}
+		Expect(lost["1-64"]).To(Equal(lostSmall))
+		Expect(lost["65+"]).To(Equal(lostLarge))
+	})
+
+	It("stops a reader waiting for messages after the configured duration", func() {
+		config.SetDuration(streaming.Duration, 50*time.Millisecond)
+		Expect(scheme.Init(config)).To(Succeed())
+
+		done := make(chan struct{})
+		go func() {
+			scheme.RunReader(reader)
+			close(done)
+		}()
+
+		Eventually(done, time.Second).Should(BeClosed())
+		Expect(reporter.summaries).To(Receive())
+	})
+})
+
+var _ = Describe("Scheme with sequence headers", func() {
+	var (
+		writer   *mocks.MockWriter
+		reader   *mocks.MockReader
+		scheme   *streaming.Scheme
+		reporter *mockReporter
+	)
+
+	BeforeEach(func() {
+		writer = mocks.NewMockWriter()
+		reader = mocks.NewMockReader()
+		scheme = &streaming.Scheme{}
+		reporter = &mockReporter{
+			reports:   make(chan streaming.Report, 100),
+			summaries: make(chan streaming.Summary, 1),
+		}
+		scheme.SetReporter(reporter)
+
+		config := jsonstruct.New()
+		config.SetInt(streaming.MessagesPerSecond, 0)
+		config.SetDuration(streaming.ReportCycle, 50*time.Millisecond)
+		config.SetString(streaming.SequenceHeader, "true")
+
+		err := scheme.Init(config)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("stamps each message with a sequence number", func() {
+		go scheme.RunWriter(writer)
+
+		var sentMessage []byte
+		for i := 0; i < 10; i++ {
+			Eventually(writer.Messages).Should(Receive(&sentMessage))
+			number, _, ok := sequence.Parse(sentMessage)
+			Expect(ok).To(BeTrue())
+			Expect(number).To(BeEquivalentTo(i))
+		}
+
+		messages := writer.Messages
+		go func() {
+			for range messages {
+			}
+		}()
+		scheme.Close()
+	})
+
+	It("reports sequence stats for each cycle", func() {
+		for _, number := range []uint64{0, 2, 2} {
+			message := make([]byte, 1024)
+			sequence.Stamp(message, number, time.Now())
+			reader.ReadMessages <- mocks.ReadMessage{Buffer: message, Error: nil}
+		}
+
+		go scheme.RunReader(reader)
+
+		var report streaming.Report
+		Eventually(reporter.reports, 100*time.Millisecond).Should(Receive(&report))
+		Expect(report.MessageCount).To(BeEquivalentTo(3))
+		Expect(report.Sequence).To(Equal(&sequence.Stats{
+			Received:  3,
+			Lost:      1,
+			Duplicate: 1,
+		}))
+
+		message := make([]byte, 1024)
+		sequence.Stamp(message, 1, time.Now())
+		reader.ReadMessages <- mocks.ReadMessage{Buffer: message, Error: nil}
+
+		Eventually(reporter.reports, 100*time.Millisecond).Should(Receive(&report))
+		Expect(report.Sequence).To(Equal(&sequence.Stats{
+			Received:   1,
+			Lost:       -1,
+			OutOfOrder: 1,
+		}))
+
+		scheme.Close()
+	})
+
+	It("records one-way latencies for each cycle and the run", func() {
+		for number := uint64(0); number < 2; number++ {
+			message := make([]byte, 1024)
+			sequence.Stamp(message, number, time.Now().Add(-10*time.Millisecond))
+			reader.ReadMessages <- mocks.ReadMessage{Buffer: message, Error: nil}
+		}
+
+		go scheme.RunReader(reader)
+
+		var report streaming.Report
+		Eventually(reporter.reports, 100*time.Millisecond).Should(Receive(&report))
+		Expect(report.Latency).NotTo(BeNil())
+		Expect(report.Latency.Count()).To(BeEquivalentTo(2))
+		Expect(report.Latency.Min()).To(BeNumerically(">=", 10*time.Millisecond))
+
+		message := make([]byte, 1024)
+		sequence.Stamp(message, 2, time.Now().Add(-time.Second))
+		reader.ReadMessages <- mocks.ReadMessage{Buffer: message, Error: nil}
+
+		Eventually(reporter.reports, 100*time.Millisecond).Should(Receive(&report))
+		Expect(report.Latency.Count()).To(BeEquivalentTo(1))
+		Expect(report.Latency.Max()).To(BeNumerically(">=", time.Second))
+
+		scheme.Close()
+
+		var summary streaming.Summary
+		Expect(reporter.summaries).To(Receive(&summary))
+		Expect(summary.Latency.Count()).To(BeEquivalentTo(3))
+		Expect(summary.Latency.Percentile(50)).To(BeNumerically("<", time.Second))
+		Expect(summary.Latency.Max()).To(BeNumerically(">=", time.Second))
+	})
+})
+
+var _ = Describe("Scheme with clock sync", func() {
+	It("requires sequence headers", func() {
+		config := jsonstruct.New()
+		config.SetString(clock.Sync, "true")
+
+		scheme := &streaming.Scheme{}
+		Expect(scheme.Init(config)).To(MatchError("Clock sync requires sequence headers, " + streaming.SequenceHeader))
+	})
+
+	It("corrects latencies by the clock offset the writer estimates", func() {
+		config := jsonstruct.New()
+		config.SetInt(streaming.MessagesPerSecond, 0)
+		config.SetInt(streaming.MaxMessages, 3)
+		config.SetString(streaming.SequenceHeader, "true")
+		config.SetString(clock.Sync, "true")
+		config.SetInt(clock.Port, 51160)
+
+		readerScheme := &streaming.Scheme{}
+		readerReporter := &mockReporter{
+			reports:   make(chan streaming.Report, 100),
+			summaries: make(chan streaming.Summary, 1),
+		}
+		readerScheme.SetReporter(readerReporter)
+		Expect(readerScheme.Init(config)).To(Succeed())
+
+		writerScheme := &streaming.Scheme{}
+		writerScheme.SetReporter(&mockReporter{
+			reports:   make(chan streaming.Report, 100),
+			summaries: make(chan streaming.Summary, 1),
+		})
+		Expect(writerScheme.Init(config)).To(Succeed())
+
+		reader := mocks.NewMockReader()
+		go readerScheme.RunReader(reader)
+
+		writer := mocks.NewMockWriter()
+		writerScheme.RunWriter(writer)
+		for i := 0; i < 3; i++ {
+			var message []byte
+			Expect(writer.Messages).To(Receive(&message))
+			reader.ReadMessages <- mocks.ReadMessage{Buffer: message, Error: nil}
+		}
+
+		var summary streaming.Summary
+		Eventually(readerReporter.summaries).Should(Receive(&summary))
+		Expect(summary.ClockEstimates).To(HaveLen(2))
+		Expect(summary.Clock).NotTo(BeNil())
+		Expect(*summary.Clock).To(Equal(summary.ClockEstimates[0]))
+		Expect(summary.Clock.Offset).To(BeNumerically("~", 0, summary.Clock.ErrorBound()+time.Microsecond))
+		Expect(summary.Latency.Count()).To(BeEquivalentTo(3))
+		Expect(summary.UncorrectedLatencies).To(BeZero())
+	})
+
+	It("leaves latencies read before the first clock estimate out of the histogram", func() {
+		newConfig := func() jsonstruct.JSONStruct {
+			config := jsonstruct.New()
+			config.SetInt(streaming.MessagesPerSecond, 0)
+			config.SetInt(streaming.MaxMessages, 3)
+			config.SetString(streaming.SequenceHeader, "true")
+			return config
+		}
+		writerConfig := newConfig()
+		readerConfig := newConfig()
+		readerConfig.SetString(clock.Sync, "true")
+		readerConfig.SetInt(clock.Port, 51161)
+
+		readerScheme := &streaming.Scheme{}
+		readerReporter := &mockReporter{
+			reports:   make(chan streaming.Report, 100),
+			summaries: make(chan streaming.Summary, 1),
+		}
+		readerScheme.SetReporter(readerReporter)
+		Expect(readerScheme.Init(readerConfig)).To(Succeed())
+
+		// The writer never probes the reader's clock
+		writerScheme := &streaming.Scheme{}
+		writerScheme.SetReporter(&mockReporter{
+			reports:   make(chan streaming.Report, 100),
+			summaries: make(chan streaming.Summary, 1),
+		})
+		Expect(writerScheme.Init(writerConfig)).To(Succeed())
+
+		reader := mocks.NewMockReader()
+		go readerScheme.RunReader(reader)
+
+		writer := mocks.NewMockWriter()
+		writerScheme.RunWriter(writer)
+		for i := 0; i < 3; i++ {
+			var message []byte
+			Expect(writer.Messages).To(Receive(&message))
+			reader.ReadMessages <- mocks.ReadMessage{Buffer: message, Error: nil}
+		}
+
+		var summary streaming.Summary
+		Eventually(readerReporter.summaries).Should(Receive(&summary))
+		Expect(summary.Clock).To(BeNil())
+		Expect(summary.UncorrectedLatencies).To(BeEquivalentTo(3))
+		Expect(summary.Latency.Count()).To(BeZero())
+	})
+})
+
 type mockReporter struct {
 	expectedMessagesPerSecond int
 	reportCycle               time.Duration
 	reports                   chan streaming.Report
+	summaries                 chan streaming.Summary
 }
 
 func (m *mockReporter) Init(expectedMessagesPerSecond int, reportCycle time.Duration) {
@@ -154,3 +586,7 @@ func (m *mockReporter) Init(expectedMessagesPerSecond int, reportCycle time.Dura
 func (m *mockReporter) Report(report streaming.Report) {
 	m.reports <- report
 }
+
+func (m *mockReporter) Summarize(summary streaming.Summary) {
+	m.summaries <- summary
+}
@@ -0,0 +1,301 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/myshkin5/netspel/factory"
+	"github.com/myshkin5/netspel/logs"
+	"github.com/myshkin5/netspel/loopback"
+	"github.com/myshkin5/netspel/schemes/streaming"
+	"github.com/myshkin5/netspel/utils"
+)
+
+const (
+	prefix = ".search."
+
+	MinRate       = prefix + "min-rate"
+	MaxRate       = prefix + "max-rate"
+	Resolution    = prefix + "resolution"
+	LossTolerance = prefix + "loss-tolerance"
+	RateTolerance = prefix + "rate-tolerance"
+	TrialDuration = prefix + "trial-duration"
+	MaxTrials     = prefix + "max-trials"
+
+	DefaultMinRate       = 1000
+	DefaultMaxRate       = 100000
+	DefaultResolution    = 1000
+	DefaultLossTolerance = 0.0
+	DefaultRateTolerance = 5.0
+	DefaultTrialDuration = 5 * time.Second
+	DefaultMaxTrials     = 20
+
+	SchemeType = "streaming"
+)
+
+// ConfigKeys are read by the search command.
+var ConfigKeys = []factory.ConfigKey{
+	{Path: MinRate, Type: factory.IntType, Default: fmt.Sprint(DefaultMinRate), Range: factory.AtLeast(1),
+		Doc: "The lowest rate tried in messages per second."},
+	{Path: MaxRate, Type: factory.IntType, Default: fmt.Sprint(DefaultMaxRate), Range: factory.AtLeast(1),
+		Doc: "The highest rate tried in messages per second."},
+	{Path: Resolution, Type: factory.IntType, Default: fmt.Sprint(DefaultResolution), Range: factory.AtLeast(1),
+		Doc: "The search stops once the passing and failing rates are this close in messages per second."},
+	{Path: LossTolerance, Type: factory.FloatType, Default: fmt.Sprint(DefaultLossTolerance), Range: factory.Between(0, 100),
+		Doc: "The percent of sent messages a trial may lose and still pass."},
+	{Path: RateTolerance, Type: factory.FloatType, Default: fmt.Sprint(DefaultRateTolerance), Range: factory.Between(0, 100),
+		Doc: "The percent the sent rate may fall short of the offered rate and still pass."},
+	{Path: TrialDuration, Type: factory.DurationType, Default: fmt.Sprint(DefaultTrialDuration), Range: factory.AtLeast(0),
+		Doc: "The length of each trial."},
+	{Path: MaxTrials, Type: factory.IntType, Default: fmt.Sprint(DefaultMaxTrials), Range: factory.AtLeast(0),
+		Doc: "The search stops after this many trials even when the resolution hasn't been reached."},
+}
+
+// RunLoopback runs a single trial. Tests replace it to avoid real networking.
+var RunLoopback = loopback.RunSplit
+
+// Trial is the outcome of running at a single offered rate.
+type Trial struct {
+	Rate     int
+	Sent     uint64
+	Received uint64
+	RunTime  time.Duration
+	Loss     float64
+	Passed   bool
+}
+
+// SentPerSecond returns the rate the writer actually achieved, which may be
+// lower than the offered rate when the writer can't keep up.
+func (t Trial) SentPerSecond() float64 {
+	if t.RunTime <= 0 {
+		return 0
+	}
+	return float64(t.Sent) * float64(time.Second) / float64(t.RunTime)
+}
+
+// Result holds every trial in the order run. Rate is the highest rate the
+// writer kept up with and whose loss was within tolerance; Found is false when
+// even the minimum rate failed.
+type Result struct {
+	Trials []Trial
+	Rate   int
+	Found  bool
+}
+
+type byRate []Trial
+
+func (t byRate) Len() int           { return len(t) }
+func (t byRate) Less(i, j int) bool { return t[i].Rate < t[j].Rate }
+func (t byRate) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+
+type config struct {
+	minRate       int
+	maxRate       int
+	resolution    int
+	lossTolerance float64
+	rateTolerance float64
+	trialDuration time.Duration
+	maxTrials     int
+}
+
+// Run searches for the maximum rate the writer and reader sustain with loss
+// within tolerance, in the style of RFC 2544's throughput test. Each trial runs
+// the streaming scheme in a single process at one rate for the trial duration
+// and compares the messages sent with the messages received. The rate is
+// binary searched between the minimum and maximum rates until the search
+// narrows to the resolution. Closing stop ends the search after the current
+// trial.
+func Run(runConfig factory.Config, stop <-chan struct{}) (Result, error) {
+	if runConfig.SchemeType == "" {
+		runConfig.SchemeType = SchemeType
+	}
+	if runConfig.SchemeType != SchemeType {
+		return Result{}, fmt.Errorf("Searching requires the %s scheme, %s", SchemeType, runConfig.SchemeType)
+	}
+
+	c, err := parseConfig(runConfig)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := Result{}
+	trial := func(rate int) (Trial, bool, error) {
+		if stopped(stop) {
+			return Trial{}, false, nil
+		}
+
+		t, err := runTrial(runConfig, c, rate, stop)
+		if err != nil {
+			return Trial{}, false, err
+		}
+		// An interrupted trial's counts don't reflect the rate
+		if stopped(stop) {
+			logs.Logger.Info("Search stopped")
+			return Trial{}, false, nil
+		}
+		result.Trials = append(result.Trials, t)
+		logTrial(len(result.Trials), t)
+		return t, true, nil
+	}
+
+	t, ok, err := trial(c.minRate)
+	if err != nil || !ok {
+		return result, err
+	}
+	if !t.Passed {
+		return result, nil
+	}
+	low := c.minRate
+	result.Rate, result.Found = low, true
+
+	t, ok, err = trial(c.maxRate)
+	if err != nil || !ok {
+		return result, err
+	}
+	if t.Passed {
+		result.Rate = c.maxRate
+		return result, nil
+	}
+	high := c.maxRate
+
+	for high-low > c.resolution && len(result.Trials) < c.maxTrials {
+		rate := low + (high-low)/2
+		t, ok, err = trial(rate)
+		if err != nil || !ok {
+			return result, err
+		}
+
+		if t.Passed {
+			low = rate
+			result.Rate = rate
+		} else {
+			high = rate
+		}
+	}
+
+	return result, nil
+}
+
+// LogReport logs the rate curve, ordered by rate, and the final answer.
+func LogReport(result Result) {
+	trials := make(byRate, len(result.Trials))
+	copy(trials, result.Trials)
+	sort.Sort(trials)
+
+	logs.Logger.Info("%12s %14s %12s %12s %9s", "Offered/s", "Sent/s", "Sent", "Received", "Lost")
+	for _, t := range trials {
+		logs.Logger.Info("%12d %14.1f %12d %12d %8.3f%%", t.Rate, t.SentPerSecond(), t.Sent, t.Received, t.Loss)
+	}
+
+	if !result.Found {
+		logs.Logger.Info("No rate found, the minimum rate lost too many messages or wasn't sent in full")
+		return
+	}
+	logs.Logger.Info("Maximum rate sent in full within loss tolerance: %d messages/s", result.Rate)
+}
+
+func parseConfig(runConfig factory.Config) (config, error) {
+	c := config{}
+	c.minRate = runConfig.Additional.IntWithDefault(MinRate, DefaultMinRate)
+	c.maxRate = runConfig.Additional.IntWithDefault(MaxRate, DefaultMaxRate)
+	c.resolution = runConfig.Additional.IntWithDefault(Resolution, DefaultResolution)
+	c.maxTrials = runConfig.Additional.IntWithDefault(MaxTrials, DefaultMaxTrials)
+	if c.minRate <= 0 || c.maxRate <= c.minRate {
+		return config{}, fmt.Errorf("The maximum rate must be greater than the minimum rate and both must be positive, %d and %d", c.minRate, c.maxRate)
+	}
+	if c.resolution <= 0 {
+		return config{}, fmt.Errorf("The resolution must be positive, %d", c.resolution)
+	}
+
+	var err error
+	c.lossTolerance, err = utils.Float64WithDefault(runConfig.Additional, LossTolerance, DefaultLossTolerance)
+	if err != nil {
+		return config{}, err
+	}
+	c.rateTolerance, err = utils.Float64WithDefault(runConfig.Additional, RateTolerance, DefaultRateTolerance)
+	if err != nil {
+		return config{}, err
+	}
+	c.trialDuration, err = runConfig.Additional.DurationWithDefault(TrialDuration, DefaultTrialDuration)
+	if err != nil {
+		return config{}, err
+	}
+
+	return c, nil
+}
+
+func runTrial(runConfig factory.Config, c config, rate int, stop <-chan struct{}) (Trial, error) {
+	logs.Logger.Info("Running trial at %d messages/s for %s...", rate, c.trialDuration)
+
+	writerConfig, err := copyConfig(runConfig)
+	if err != nil {
+		return Trial{}, err
+	}
+	writerConfig.Additional.SetInt(streaming.MessagesPerSecond, rate)
+	writerConfig.Additional.SetDuration(streaming.Duration, c.trialDuration)
+	writerConfig.Additional.SetInt(streaming.MaxMessages, 0)
+
+	// The reader reads as quickly as possible so only the transport limits the
+	// rate. It starts first so limiting it would cut off the writer's last
+	// messages; it is closed once the writer finishes and the drain wait passes
+	// instead.
+	readerConfig, err := copyConfig(writerConfig)
+	if err != nil {
+		return Trial{}, err
+	}
+	readerConfig.Additional.SetInt(streaming.MessagesPerSecond, 0)
+	readerConfig.Additional.SetInt(streaming.ExpectedMessagesPerSecond, rate)
+	readerConfig.Additional.SetDuration(streaming.Duration, 0)
+
+	result, err := RunLoopback(writerConfig, readerConfig, stop)
+	if err != nil {
+		return Trial{}, err
+	}
+	if result.Writer == nil || result.Reader == nil {
+		return Trial{}, fmt.Errorf("Scheme doesn't summarize runs, %s", runConfig.SchemeType)
+	}
+
+	t := Trial{
+		Rate:     rate,
+		Sent:     result.Writer.MessageCount,
+		Received: result.Reader.MessageCount,
+		RunTime:  result.Writer.RunTime,
+	}
+	if t.Sent > 0 {
+		t.Loss = float64(result.Lost()) / float64(t.Sent) * 100
+	}
+	// A writer that can't keep up offers less than the rate, so its loss
+	// doesn't show the rate is sustained
+	t.Passed = t.Sent > 0 && t.Loss <= c.lossTolerance &&
+		t.SentPerSecond() >= float64(rate)*(1-c.rateTolerance/100)
+
+	return t, nil
+}
+
+func copyConfig(config factory.Config) (factory.Config, error) {
+	buffer, err := json.Marshal(config)
+	if err != nil {
+		return factory.Config{}, err
+	}
+	return factory.Parse(buffer)
+}
+
+func stopped(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func logTrial(number int, t Trial) {
+	outcome := "passed"
+	if !t.Passed {
+		outcome = "failed"
+	}
+	logs.Logger.Info("Trial %d at %d messages/s %s: %d sent (%.1f/s), %d received, %.3f%% lost",
+		number, t.Rate, outcome, t.Sent, t.SentPerSecond(), t.Received, t.Loss)
+}
@@ -0,0 +1,224 @@
+package search_test
+
+import (
+	"time"
+
+	"github.com/myshkin5/netspel/adapters/tcp"
+	"github.com/myshkin5/netspel/factory"
+	"github.com/myshkin5/netspel/loopback"
+	"github.com/myshkin5/netspel/schemes/streaming"
+	"github.com/myshkin5/netspel/search"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Search", func() {
+	var (
+		config  factory.Config
+		rates   []int
+		maxLoss int
+		maxSent int
+	)
+
+	// fakeLoopback loses messages in proportion to how far the rate exceeds
+	// maxLoss and sends no more than maxSent messages a second
+	fakeLoopback := func(config, readerConfig factory.Config, stop <-chan struct{}) (loopback.Result, error) {
+		rate := config.Additional.IntWithDefault(streaming.MessagesPerSecond, 0)
+		rates = append(rates, rate)
+
+		sent := rate
+		if sent > maxSent {
+			sent = maxSent
+		}
+		received := sent
+		if sent > maxLoss {
+			received = maxLoss
+		}
+		return loopback.Result{
+			Writer: &factory.Summary{MessageCount: uint64(sent), RunTime: time.Second},
+			Reader: &factory.Summary{MessageCount: uint64(received), RunTime: time.Second},
+		}, nil
+	}
+
+	BeforeEach(func() {
+		var err error
+		config, err = factory.Parse([]byte(`{"writer-type": "udp", "reader-type": "udp"}`))
+		Expect(err).NotTo(HaveOccurred())
+		config.Additional.SetInt(search.MinRate, 1000)
+		config.Additional.SetInt(search.MaxRate, 100000)
+		config.Additional.SetInt(search.Resolution, 1000)
+
+		rates = nil
+		maxSent = 1000000
+		search.RunLoopback = fakeLoopback
+	})
+
+	AfterEach(func() {
+		search.RunLoopback = loopback.RunSplit
+	})
+
+	It("binary searches for the highest loss-free rate", func() {
+		maxLoss = 40000
+
+		result, err := search.Run(config, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(result.Found).To(BeTrue())
+		Expect(result.Rate).To(BeNumerically("<=", 40000))
+		Expect(result.Rate).To(BeNumerically(">", 40000-1000))
+		Expect(rates[:4]).To(Equal([]int{1000, 100000, 50500, 25750}))
+		Expect(result.Trials).To(HaveLen(len(rates)))
+		Expect(result.Trials[1].Passed).To(BeFalse())
+		Expect(result.Trials[1].Loss).To(BeNumerically("~", 60, 0.001))
+	})
+
+	It("stops at the maximum rate when it is loss-free", func() {
+		maxLoss = 200000
+
+		result, err := search.Run(config, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(result.Found).To(BeTrue())
+		Expect(result.Rate).To(Equal(100000))
+		Expect(rates).To(Equal([]int{1000, 100000}))
+	})
+
+	It("finds nothing when the minimum rate loses messages", func() {
+		maxLoss = 500
+
+		result, err := search.Run(config, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(result.Found).To(BeFalse())
+		Expect(rates).To(Equal([]int{1000}))
+	})
+
+	It("accepts loss within the tolerance", func() {
+		maxLoss = 40000
+		config.Additional.SetString(search.LossTolerance, "50")
+
+		result, err := search.Run(config, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(result.Rate).To(BeNumerically(">=", 79000))
+		Expect(result.Rate).To(BeNumerically("<=", 80000))
+	})
+
+	It("fails trials the writer can't keep up with", func() {
+		maxLoss = 200000
+		maxSent = 30000
+
+		result, err := search.Run(config, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(result.Found).To(BeTrue())
+		Expect(result.Rate).To(BeNumerically(">", 30000-1000))
+		Expect(float64(result.Rate) * 0.95).To(BeNumerically("<=", 30000))
+		Expect(result.Trials[1].Passed).To(BeFalse())
+		Expect(result.Trials[1].Loss).To(BeZero())
+	})
+
+	It("accepts a sent rate short of the offered rate within the tolerance", func() {
+		maxLoss = 200000
+		maxSent = 30000
+		config.Additional.SetString(search.RateTolerance, "50")
+
+		result, err := search.Run(config, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(result.Rate).To(BeNumerically(">=", 59000))
+		Expect(result.Rate).To(BeNumerically("<=", 60000))
+	})
+
+	It("limits the count of trials", func() {
+		maxLoss = 40000
+		config.Additional.SetInt(search.MaxTrials, 3)
+
+		result, err := search.Run(config, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(rates).To(Equal([]int{1000, 100000, 50500}))
+		Expect(result.Rate).To(Equal(1000))
+	})
+
+	It("runs each trial with the streaming scheme at the trial's rate", func() {
+		maxLoss = 200000
+		config.Additional.SetString(search.TrialDuration, "3s")
+		var schemeTypes []string
+		var durations, readerDurations []time.Duration
+		var readerRates []int
+		search.RunLoopback = func(config, readerConfig factory.Config, stop <-chan struct{}) (loopback.Result, error) {
+			schemeTypes = append(schemeTypes, config.SchemeType)
+			duration, err := config.Additional.DurationWithDefault(streaming.Duration, 0)
+			Expect(err).NotTo(HaveOccurred())
+			durations = append(durations, duration)
+			duration, err = readerConfig.Additional.DurationWithDefault(streaming.Duration, time.Hour)
+			Expect(err).NotTo(HaveOccurred())
+			readerDurations = append(readerDurations, duration)
+			readerRates = append(readerRates, readerConfig.Additional.IntWithDefault(streaming.MessagesPerSecond, -1))
+			return fakeLoopback(config, readerConfig, stop)
+		}
+
+		_, err := search.Run(config, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(schemeTypes).To(Equal([]string{"streaming", "streaming"}))
+		Expect(durations).To(Equal([]time.Duration{3 * time.Second, 3 * time.Second}))
+		Expect(readerDurations).To(Equal([]time.Duration{0, 0}))
+		Expect(readerRates).To(Equal([]int{0, 0}))
+		Expect(config.Additional.IntWithDefault(streaming.MessagesPerSecond, 0)).To(BeZero())
+	})
+
+	It("stops searching when told to", func() {
+		maxLoss = 40000
+		stop := make(chan struct{})
+		search.RunLoopback = func(config, readerConfig factory.Config, s <-chan struct{}) (loopback.Result, error) {
+			if len(rates) == 1 {
+				close(stop)
+			}
+			return fakeLoopback(config, readerConfig, s)
+		}
+
+		result, err := search.Run(config, stop)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(rates).To(HaveLen(2))
+		Expect(result.Trials).To(HaveLen(1))
+	})
+
+	It("requires the streaming scheme", func() {
+		config.SchemeType = "simple"
+
+		_, err := search.Run(config, nil)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rejects invalid rate ranges", func() {
+		config.Additional.SetInt(search.MaxRate, 1000)
+
+		_, err := search.Run(config, nil)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("searches with real adapters", func() {
+		search.RunLoopback = loopback.RunSplit
+
+		config.WriterType = "tcp"
+		config.ReaderType = "tcp"
+		config.Additional.SetInt(tcp.Port, 53201)
+		config.Additional.SetInt(search.MinRate, 100)
+		config.Additional.SetInt(search.MaxRate, 200)
+		config.Additional.SetString(search.TrialDuration, "200ms")
+		// Starting takes a noticeable part of such short trials
+		config.Additional.SetString(search.RateTolerance, "25")
+		config.Additional.SetString(loopback.DrainWait, "50ms")
+
+		result, err := search.Run(config, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(result.Found).To(BeTrue())
+		Expect(result.Rate).To(Equal(200))
+		Expect(result.Trials[1].Sent).To(BeNumerically("~", 40, 10))
+	})
+})
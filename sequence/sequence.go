@@ -0,0 +1,197 @@
+package sequence
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+const (
+	// HeaderSize is the count of bytes at the start of a message used by the
+	// sequence number and the send timestamp.
+	HeaderSize = 16
+
+	windowSize = 1 << 16
+)
+
+// Stamp writes the sequence number and send time into the header at the start
+// of message. The message must be at least HeaderSize bytes long.
+func Stamp(message []byte, sequence uint64, sent time.Time) {
+	binary.BigEndian.PutUint64(message[0:8], sequence)
+	binary.BigEndian.PutUint64(message[8:16], uint64(sent.UnixNano()))
+}
+
+// Parse reads the header written by Stamp. ok is false when the message is too
+// short to contain a header.
+func Parse(message []byte) (sequence uint64, sent time.Time, ok bool) {
+	if len(message) < HeaderSize {
+		return 0, time.Time{}, false
+	}
+
+	sequence = binary.BigEndian.Uint64(message[0:8])
+	sent = time.Unix(0, int64(binary.BigEndian.Uint64(message[8:16])))
+	return sequence, sent, true
+}
+
+type Stats struct {
+	Received   uint64 `json:"received"`
+	Lost       int64  `json:"lost"`
+	OutOfOrder uint64 `json:"out-of-order"`
+	Duplicate  uint64 `json:"duplicate"`
+	Late       uint64 `json:"late"`
+}
+
+// Sub returns the change in stats since previous. Lost may be negative when
+// messages previously counted as lost arrive late.
+func (s Stats) Sub(previous Stats) Stats {
+	return Stats{
+		Received:   s.Received - previous.Received,
+		Lost:       s.Lost - previous.Lost,
+		OutOfOrder: s.OutOfOrder - previous.OutOfOrder,
+		Duplicate:  s.Duplicate - previous.Duplicate,
+		Late:       s.Late - previous.Late,
+	}
+}
+
+// Tracker classifies received messages by their sequence headers. A message is
+// lost while its sequence number is missing from between the lowest and
+// highest sequence numbers received or, when set, expected. It is out of order
+// when it arrives after a higher sequence number, a duplicate when its
+// sequence number was already received and late when it arrives more than
+// lateAfter after it was sent.
+// Duplicates are only detected within the most recent 65536 sequence numbers.
+// A message older than that can't be told apart from a duplicate, so it is
+// counted as out of order but its sequence number stays lost.
+type Tracker struct {
+	lateAfter time.Duration
+
+	mutex    sync.Mutex
+	started  bool
+	lowest   uint64
+	highest  uint64
+	expected bool
+	first    uint64
+	last     uint64
+	unique   uint64
+	window   []uint64
+	stats    Stats
+}
+
+func NewTracker(lateAfter time.Duration) *Tracker {
+	return &Tracker{
+		lateAfter: lateAfter,
+		window:    make([]uint64, windowSize/64),
+	}
+}
+
+// Expect sets the range of sequence numbers sent, first to last inclusive, so
+// messages lost before the first or after the last message received are
+// counted as lost too.
+func (t *Tracker) Expect(first, last uint64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.expected = true
+	t.first = first
+	t.last = last
+}
+
+// Track records a received message and returns false if the message doesn't
+// contain a header.
+func (t *Tracker) Track(message []byte, received time.Time) bool {
+	_, _, ok := t.Observe(message, received)
+	return ok
+}
+
+// Observe records a received message like Track and also returns its sequence
+// number and whether this is the first time it was received.
+func (t *Tracker) Observe(message []byte, received time.Time) (sequence uint64, first bool, ok bool) {
+	sequence, sent, ok := Parse(message)
+	if !ok {
+		return 0, false, false
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.stats.Received++
+	if t.lateAfter > 0 && received.Sub(sent) > t.lateAfter {
+		t.stats.Late++
+	}
+
+	switch {
+	case !t.started:
+		t.started = true
+		t.lowest = sequence
+		t.highest = sequence
+		t.mark(sequence)
+	case sequence > t.highest:
+		t.advance(sequence)
+		t.mark(sequence)
+	case t.highest-sequence < windowSize:
+		if t.isMarked(sequence) {
+			t.stats.Duplicate++
+			return sequence, false, true
+		}
+		t.stats.OutOfOrder++
+		t.mark(sequence)
+	case sequence < t.lowest:
+		// Nothing below the lowest has been received so it can't be a
+		// duplicate
+		t.stats.OutOfOrder++
+		t.unique++
+	default:
+		t.stats.OutOfOrder++
+		return sequence, false, true
+	}
+
+	if sequence < t.lowest {
+		t.lowest = sequence
+	}
+
+	return sequence, true, true
+}
+
+func (t *Tracker) Stats() Stats {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	stats := t.stats
+	if !t.started && !t.expected {
+		return stats
+	}
+
+	lowest, highest := t.lowest, t.highest
+	if t.expected {
+		if !t.started || t.first < lowest {
+			lowest = t.first
+		}
+		if !t.started || t.last > highest {
+			highest = t.last
+		}
+	}
+	stats.Lost = int64(highest-lowest+1) - int64(t.unique)
+	return stats
+}
+
+func (t *Tracker) advance(sequence uint64) {
+	if sequence-t.highest >= windowSize {
+		for i := range t.window {
+			t.window[i] = 0
+		}
+	} else {
+		for s := t.highest + 1; s < sequence; s++ {
+			t.window[(s%windowSize)/64] &^= 1 << (s % 64)
+		}
+	}
+	t.highest = sequence
+}
+
+func (t *Tracker) mark(sequence uint64) {
+	t.window[(sequence%windowSize)/64] |= 1 << (sequence % 64)
+	t.unique++
+}
+
+func (t *Tracker) isMarked(sequence uint64) bool {
+	return t.window[(sequence%windowSize)/64]&(1<<(sequence%64)) != 0
+}
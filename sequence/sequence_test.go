@@ -0,0 +1,164 @@
+package sequence_test
+
+import (
+	"time"
+
+	"github.com/myshkin5/netspel/sequence"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Sequence", func() {
+	It("stamps and parses a header", func() {
+		message := make([]byte, 100)
+		sent := time.Unix(1234, 5678)
+		sequence.Stamp(message, 42, sent)
+
+		number, parsedSent, ok := sequence.Parse(message)
+		Expect(ok).To(BeTrue())
+		Expect(number).To(BeEquivalentTo(42))
+		Expect(parsedSent.Equal(sent)).To(BeTrue())
+	})
+
+	It("doesn't parse messages too short for a header", func() {
+		_, _, ok := sequence.Parse(make([]byte, sequence.HeaderSize-1))
+		Expect(ok).To(BeFalse())
+	})
+
+	Describe("Tracker", func() {
+		var (
+			tracker *sequence.Tracker
+			now     time.Time
+		)
+
+		BeforeEach(func() {
+			tracker = sequence.NewTracker(time.Second)
+			now = time.Now()
+		})
+
+		track := func(number uint64, sent time.Time) {
+			message := make([]byte, sequence.HeaderSize)
+			sequence.Stamp(message, number, sent)
+			ExpectWithOffset(1, tracker.Track(message, now)).To(BeTrue())
+		}
+
+		It("ignores messages without a header", func() {
+			Expect(tracker.Track([]byte("short"), now)).To(BeFalse())
+			Expect(tracker.Stats()).To(Equal(sequence.Stats{}))
+		})
+
+		It("observes each message's sequence number and whether it was seen before", func() {
+			message := make([]byte, sequence.HeaderSize)
+			sequence.Stamp(message, 7, now)
+
+			number, first, ok := tracker.Observe(message, now)
+			Expect(ok).To(BeTrue())
+			Expect(number).To(BeEquivalentTo(7))
+			Expect(first).To(BeTrue())
+
+			_, first, ok = tracker.Observe(message, now)
+			Expect(ok).To(BeTrue())
+			Expect(first).To(BeFalse())
+
+			_, _, ok = tracker.Observe([]byte("short"), now)
+			Expect(ok).To(BeFalse())
+		})
+
+		It("counts messages received in order", func() {
+			for i := uint64(10); i < 20; i++ {
+				track(i, now)
+			}
+
+			Expect(tracker.Stats()).To(Equal(sequence.Stats{Received: 10}))
+		})
+
+		It("counts gaps as lost", func() {
+			track(0, now)
+			track(1, now)
+			track(5, now)
+
+			Expect(tracker.Stats()).To(Equal(sequence.Stats{Received: 3, Lost: 3}))
+		})
+
+		It("no longer counts lost messages that arrive out of order", func() {
+			track(0, now)
+			track(3, now)
+			track(1, now)
+
+			Expect(tracker.Stats()).To(Equal(sequence.Stats{Received: 3, Lost: 1, OutOfOrder: 1}))
+		})
+
+		It("counts messages lost before the first and after the last received when expected", func() {
+			tracker.Expect(10, 19)
+			track(12, now)
+			track(14, now)
+			track(17, now)
+
+			Expect(tracker.Stats()).To(Equal(sequence.Stats{Received: 3, Lost: 7}))
+		})
+
+		It("counts every expected message as lost when none are received", func() {
+			tracker.Expect(10, 19)
+
+			Expect(tracker.Stats()).To(Equal(sequence.Stats{Lost: 10}))
+		})
+
+		It("counts duplicates", func() {
+			track(0, now)
+			track(1, now)
+			track(1, now)
+			track(0, now)
+
+			Expect(tracker.Stats()).To(Equal(sequence.Stats{Received: 4, Duplicate: 2}))
+		})
+
+		It("counts messages older than the late threshold", func() {
+			track(0, now.Add(-2*time.Second))
+			track(1, now.Add(-500*time.Millisecond))
+
+			Expect(tracker.Stats()).To(Equal(sequence.Stats{Received: 2, Late: 1}))
+		})
+
+		It("handles gaps larger than the duplicate window", func() {
+			track(0, now)
+			track(1000000, now)
+			track(1000000, now)
+			track(1, now)
+
+			Expect(tracker.Stats()).To(Equal(sequence.Stats{
+				Received:   4,
+				Lost:       999999,
+				OutOfOrder: 1,
+				Duplicate:  1,
+			}))
+		})
+
+		It("doesn't reduce the lost count for messages older than the duplicate window", func() {
+			track(1, now)
+			track(1000000, now)
+			for i := 0; i < 3; i++ {
+				track(1, now)
+			}
+			track(0, now)
+
+			stats := tracker.Stats()
+			Expect(stats.Lost).To(BeEquivalentTo(999998))
+			Expect(stats.OutOfOrder).To(BeEquivalentTo(4))
+		})
+
+		It("subtracts previous stats", func() {
+			track(0, now)
+			track(2, now)
+			previous := tracker.Stats()
+			track(1, now)
+			track(3, now)
+
+			Expect(tracker.Stats().Sub(previous)).To(Equal(sequence.Stats{
+				Received:   2,
+				Lost:       -1,
+				OutOfOrder: 1,
+			}))
+		})
+	})
+})
@@ -0,0 +1,166 @@
+package sizes
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/utils"
+)
+
+// maxGap limits how many missing sequence numbers are attributed to buckets
+// at once, so a corrupt header can't stall the reader
+const maxGap = 1 << 24
+
+// BucketStats holds the counts of messages within a range of sizes. Lost is
+// only counted by readers tracking sequence headers.
+type BucketStats struct {
+	Label    string `json:"label"`
+	Messages uint64 `json:"messages"`
+	Bytes    uint64 `json:"bytes"`
+	Lost     *int64 `json:"lost,omitempty"`
+}
+
+// Describe returns the bucket's counts and rates over the elapsed time.
+func (s BucketStats) Describe(elapsed time.Duration) string {
+	var messagesPerSecond float64
+	var bytesPerSecond utils.ByteSize
+	if elapsed > 0 {
+		messagesPerSecond = float64(s.Messages) * float64(time.Second) / float64(elapsed)
+		bytesPerSecond = utils.ByteSize(s.Bytes) * utils.ByteSize(time.Second) / utils.ByteSize(elapsed)
+	}
+
+	description := fmt.Sprintf("Size %s bytes: %d messages (%.1f/s), %s (%s/s)",
+		s.Label, s.Messages, messagesPerSecond, utils.ByteSize(s.Bytes).String(), bytesPerSecond.String())
+	if s.Lost != nil {
+		description += fmt.Sprintf(", %d lost", *s.Lost)
+	}
+	return description
+}
+
+// Counter counts messages by size bucket. A reader tracking sequence headers
+// also counts lost messages by the size they would have been.
+type Counter struct {
+	sizes  Sizes
+	bounds []int
+	stats  []BucketStats
+
+	tracking bool
+	started  bool
+	overflow bool
+	lowest   uint64
+	highest  uint64
+	expected []uint64
+	unique   []uint64
+}
+
+// NewCounter returns nil for fixed sizes as every message would be in the
+// same bucket.
+func NewCounter(config jsonstruct.JSONStruct, sizes Sizes) (*Counter, error) {
+	if _, ok := sizes.(fixed); ok {
+		return nil, nil
+	}
+
+	bounds, err := parseBuckets(config.StringWithDefault(Buckets, DefaultBuckets))
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Counter{
+		sizes:    sizes,
+		bounds:   bounds,
+		stats:    make([]BucketStats, len(bounds)+1),
+		expected: make([]uint64, len(bounds)+1),
+		unique:   make([]uint64, len(bounds)+1),
+	}
+	lower := 1
+	for i, bound := range bounds {
+		c.stats[i].Label = fmt.Sprintf("%d-%d", lower, bound)
+		lower = bound + 1
+	}
+	c.stats[len(bounds)].Label = fmt.Sprintf("%d+", lower)
+
+	return c, nil
+}
+
+// Count records a message written or read.
+func (c *Counter) Count(size int) {
+	bucket := c.bucket(size)
+	c.stats[bucket].Messages++
+	c.stats[bucket].Bytes += uint64(size)
+}
+
+// Track records the sequence number of a message read and whether it was the
+// first time it was received. Every sequence number between the lowest and
+// highest received is expected, so those missing are lost.
+func (c *Counter) Track(sequence uint64, first bool) {
+	c.tracking = true
+	switch {
+	case !c.started:
+		c.started = true
+		c.lowest = sequence
+		c.highest = sequence
+		c.expect(sequence, sequence)
+	case sequence > c.highest:
+		c.expect(c.highest+1, sequence)
+		c.highest = sequence
+	case sequence < c.lowest:
+		c.expect(sequence, c.lowest-1)
+		c.lowest = sequence
+	}
+
+	if first {
+		c.unique[c.bucket(c.sizes.Size(sequence))]++
+	}
+}
+
+// Stats returns the buckets that saw any messages.
+func (c *Counter) Stats() []BucketStats {
+	var stats []BucketStats
+	for i, s := range c.stats {
+		if c.tracking && !c.overflow {
+			lost := int64(c.expected[i]) - int64(c.unique[i])
+			s.Lost = &lost
+		}
+		if s.Messages > 0 || c.expected[i] > 0 {
+			stats = append(stats, s)
+		}
+	}
+	return stats
+}
+
+func (c *Counter) expect(from, to uint64) {
+	if to-from >= maxGap {
+		c.overflow = true
+		return
+	}
+	for sequence := from; ; sequence++ {
+		c.expected[c.bucket(c.sizes.Size(sequence))]++
+		if sequence == to {
+			return
+		}
+	}
+}
+
+func (c *Counter) bucket(size int) int {
+	return sort.SearchInts(c.bounds, size)
+}
+
+func parseBuckets(buckets string) ([]int, error) {
+	var bounds []int
+	for _, field := range strings.Split(buckets, ",") {
+		bound, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid size bucket, %s", field)
+		}
+		if bound <= 0 || (len(bounds) > 0 && bound <= bounds[len(bounds)-1]) {
+			return nil, fmt.Errorf("Size buckets must be positive and increasing, %s", buckets)
+		}
+		bounds = append(bounds, bound)
+	}
+
+	return bounds, nil
+}
@@ -0,0 +1,95 @@
+package sizes_test
+
+import (
+	"time"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/sizes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Counter", func() {
+	var (
+		config jsonstruct.JSONStruct
+		s      sizes.Sizes
+	)
+
+	BeforeEach(func() {
+		config = jsonstruct.New()
+		config.SetString(sizes.Distribution, sizes.Weighted)
+		config.SetString(sizes.Table, "50:1,1000:1,2000:1")
+		config.SetString(sizes.Buckets, "64,1472")
+
+		var err error
+		s, err = sizes.New(config, 1024)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("isn't needed for fixed sizes", func() {
+		fixed, err := sizes.New(jsonstruct.New(), 1024)
+		Expect(err).NotTo(HaveOccurred())
+
+		counter, err := sizes.NewCounter(jsonstruct.New(), fixed)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(counter).To(BeNil())
+	})
+
+	It("counts messages and bytes by bucket", func() {
+		counter, err := sizes.NewCounter(config, s)
+		Expect(err).NotTo(HaveOccurred())
+
+		counter.Count(50)
+		counter.Count(64)
+		counter.Count(2000)
+
+		Expect(counter.Stats()).To(Equal([]sizes.BucketStats{
+			{Label: "1-64", Messages: 2, Bytes: 114},
+			{Label: "1473+", Messages: 1, Bytes: 2000},
+		}))
+	})
+
+	It("counts lost messages by the size they would have been", func() {
+		counter, err := sizes.NewCounter(config, s)
+		Expect(err).NotTo(HaveOccurred())
+
+		expected := map[string]int64{}
+		for number := uint64(0); number < 30; number++ {
+			size := s.Size(number)
+			label := "1-64"
+			if size > 1472 {
+				label = "1473+"
+			} else if size > 64 {
+				label = "65-1472"
+			}
+
+			if number%3 == 0 && number != 0 && number != 29 {
+				expected[label]++
+				continue
+			}
+			counter.Count(size)
+			counter.Track(number, true)
+		}
+		counter.Track(5, false)
+
+		stats := counter.Stats()
+		Expect(stats).To(HaveLen(3))
+		for _, bucket := range stats {
+			Expect(bucket.Lost).NotTo(BeNil())
+			Expect(*bucket.Lost).To(Equal(expected[bucket.Label]), bucket.Label)
+		}
+	})
+
+	It("describes a bucket", func() {
+		lost := int64(3)
+		bucket := sizes.BucketStats{Label: "65-1472", Messages: 20, Bytes: 2048, Lost: &lost}
+		Expect(bucket.Describe(2 * time.Second)).To(Equal("Size 65-1472 bytes: 20 messages (10.0/s), 2.00 KB (1.00 KB/s), 3 lost"))
+	})
+
+	It("rejects buckets that don't increase", func() {
+		config.SetString(sizes.Buckets, "64,32")
+		_, err := sizes.NewCounter(config, s)
+		Expect(err).To(MatchError("Size buckets must be positive and increasing, 64,32"))
+	})
+})
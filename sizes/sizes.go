@@ -0,0 +1,364 @@
+package sizes
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/factory"
+	"github.com/myshkin5/netspel/utils"
+)
+
+const (
+	prefix = ".size."
+
+	Distribution = prefix + "distribution"
+	Min          = prefix + "min"
+	Max          = prefix + "max"
+	Mean         = prefix + "mean"
+	StdDev       = prefix + "std-dev"
+	Table        = prefix + "table"
+	Path         = prefix + "path"
+	Seed         = prefix + "seed"
+	Buckets      = prefix + "buckets"
+
+	DefaultDistribution = Fixed
+	DefaultMin          = 16
+	DefaultMax          = 1472
+	DefaultMean         = 512.0
+	DefaultStdDev       = 128.0
+	DefaultTable        = "40:7,576:4,1500:1"
+	DefaultPath         = ""
+	DefaultSeed         = 1
+	DefaultBuckets      = "64,256,512,1024,1472,4096,8972,65507"
+
+	Fixed       = "fixed"
+	Uniform     = "uniform"
+	Normal      = "normal"
+	Exponential = "exponential"
+	Weighted    = "table"
+	Histogram   = "histogram"
+)
+
+// ConfigKeys are read by schemes that vary the size of their messages.
+var ConfigKeys = []factory.ConfigKey{
+	{Path: Distribution, Type: factory.StringType, Default: DefaultDistribution, Values: []string{Fixed, Uniform, Normal, Exponential, Weighted, Histogram},
+		Doc: "The distribution message sizes are picked from. The fixed distribution uses the scheme's bytes-per-message."},
+	{Path: Min, Type: factory.IntType, Default: fmt.Sprint(DefaultMin), Range: factory.AtLeast(1),
+		Doc: "The smallest size of the uniform, normal and exponential distributions."},
+	{Path: Max, Type: factory.IntType, Default: fmt.Sprint(DefaultMax), Range: factory.AtLeast(1),
+		Doc: "The largest size of the uniform, normal and exponential distributions."},
+	{Path: Mean, Type: factory.FloatType, Default: fmt.Sprint(DefaultMean),
+		Doc: "The mean size of the normal and exponential distributions."},
+	{Path: StdDev, Type: factory.FloatType, Default: fmt.Sprint(DefaultStdDev), Range: factory.AtLeast(0),
+		Doc: "The standard deviation of the normal distribution."},
+	{Path: Table, Type: factory.StringType, Default: DefaultTable,
+		Doc: "Comma separated size:weight pairs used by the table distribution."},
+	{Path: Path, Type: factory.StringType,
+		Doc: "The file read by the histogram distribution. Required by it."},
+	{Path: Seed, Type: factory.IntType, Default: fmt.Sprint(DefaultSeed),
+		Doc: "The seed sizes are picked with. Must be the same for the writer and the reader."},
+	{Path: Buckets, Type: factory.StringType, Default: DefaultBuckets,
+		Doc: "Comma separated upper bounds of the size buckets reported at the end of a run."},
+}
+
+// Sizes gives the size of each message by its sequence number. The size of a
+// sequence number is the same every time it is asked for, so a reader with the
+// same config knows the size of messages it never received.
+type Sizes interface {
+	Size(sequence uint64) int
+	Min() int
+	Max() int
+}
+
+// New returns the configured distribution. The fixed distribution sends every
+// message with bytesPerMessage bytes.
+func New(config jsonstruct.JSONStruct, bytesPerMessage int) (Sizes, error) {
+	distribution := config.StringWithDefault(Distribution, DefaultDistribution)
+	if distribution == Fixed {
+		if bytesPerMessage <= 0 {
+			return nil, fmt.Errorf("Messages must have at least 1 byte, %d", bytesPerMessage)
+		}
+		return fixed(bytesPerMessage), nil
+	}
+
+	seed := uint64(config.IntWithDefault(Seed, DefaultSeed))
+	switch distribution {
+	case Uniform, Normal, Exponential:
+		return newClamped(config, distribution, seed)
+	case Weighted:
+		entries, err := parseTable(config.StringWithDefault(Table, DefaultTable))
+		if err != nil {
+			return nil, err
+		}
+		return newWeighted(entries, seed)
+	case Histogram:
+		entries, err := readHistogram(config.StringWithDefault(Path, DefaultPath))
+		if err != nil {
+			return nil, err
+		}
+		return newWeighted(entries, seed)
+	default:
+		return nil, fmt.Errorf("Unknown size distribution, %s", distribution)
+	}
+}
+
+// newClamped returns one of the distributions limited to the configured
+// minimum and maximum.
+func newClamped(config jsonstruct.JSONStruct, distribution string, seed uint64) (Sizes, error) {
+	bounds := clamped{
+		min: config.IntWithDefault(Min, DefaultMin),
+		max: config.IntWithDefault(Max, DefaultMax),
+	}
+	if bounds.min <= 0 || bounds.max < bounds.min {
+		return nil, fmt.Errorf("Sizes must be between a positive minimum and a maximum no less than it, %d and %d", bounds.min, bounds.max)
+	}
+
+	switch distribution {
+	case Normal:
+		mean, err := utils.Float64WithDefault(config, Mean, DefaultMean)
+		if err != nil {
+			return nil, err
+		}
+		stdDev, err := utils.Float64WithDefault(config, StdDev, DefaultStdDev)
+		if err != nil {
+			return nil, err
+		}
+		if stdDev < 0 {
+			return nil, fmt.Errorf("Standard deviation must not be negative, %g", stdDev)
+		}
+		return &normal{clamped: bounds, seed: seed, mean: mean, stdDev: stdDev}, nil
+	case Exponential:
+		mean, err := utils.Float64WithDefault(config, Mean, DefaultMean)
+		if err != nil {
+			return nil, err
+		}
+		if mean <= 0 {
+			return nil, fmt.Errorf("Mean must be positive, %g", mean)
+		}
+		return &exponential{clamped: bounds, seed: seed, mean: mean}, nil
+	default:
+		return &uniform{clamped: bounds, seed: seed}, nil
+	}
+}
+
+type fixed int
+
+func (f fixed) Size(sequence uint64) int {
+	return int(f)
+}
+
+func (f fixed) Min() int {
+	return int(f)
+}
+
+func (f fixed) Max() int {
+	return int(f)
+}
+
+// clamped limits the sizes of unbounded distributions
+type clamped struct {
+	min int
+	max int
+}
+
+func (c clamped) clamp(size float64) int {
+	rounded := int(math.Round(size))
+	if rounded < c.min {
+		return c.min
+	}
+	if rounded > c.max {
+		return c.max
+	}
+	return rounded
+}
+
+func (c clamped) Min() int {
+	return c.min
+}
+
+func (c clamped) Max() int {
+	return c.max
+}
+
+type uniform struct {
+	clamped
+	seed uint64
+}
+
+func (u *uniform) Size(sequence uint64) int {
+	return u.min + int(random(u.seed, sequence, 0)*float64(u.max-u.min+1))
+}
+
+type normal struct {
+	clamped
+	seed   uint64
+	mean   float64
+	stdDev float64
+}
+
+// Size uses the Box-Muller transform
+func (n *normal) Size(sequence uint64) int {
+	u1 := 1 - random(n.seed, sequence, 0)
+	u2 := random(n.seed, sequence, 1)
+	z := math.Sqrt(-2*math.Log(u1)) * math.Cos(2*math.Pi*u2)
+	return n.clamp(n.mean + z*n.stdDev)
+}
+
+type exponential struct {
+	clamped
+	seed uint64
+	mean float64
+}
+
+func (e *exponential) Size(sequence uint64) int {
+	return e.clamp(-e.mean * math.Log(1-random(e.seed, sequence, 0)))
+}
+
+type entry struct {
+	size   int
+	weight float64
+}
+
+// weighted picks sizes in proportion to their weights
+type weighted struct {
+	seed       uint64
+	sizes      []int
+	cumulative []float64
+	min        int
+	max        int
+}
+
+func newWeighted(entries []entry, seed uint64) (*weighted, error) {
+	w := &weighted{seed: seed}
+	total := 0.0
+	for _, e := range entries {
+		if e.size <= 0 {
+			return nil, fmt.Errorf("Sizes must be positive, %d", e.size)
+		}
+		if e.weight < 0 {
+			return nil, fmt.Errorf("Weights must not be negative, %g", e.weight)
+		}
+		if e.weight == 0 {
+			continue
+		}
+
+		total += e.weight
+		w.sizes = append(w.sizes, e.size)
+		w.cumulative = append(w.cumulative, total)
+		if w.min == 0 || e.size < w.min {
+			w.min = e.size
+		}
+		if e.size > w.max {
+			w.max = e.size
+		}
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("At least one size must have a positive weight")
+	}
+
+	return w, nil
+}
+
+func (w *weighted) Size(sequence uint64) int {
+	target := random(w.seed, sequence, 0) * w.cumulative[len(w.cumulative)-1]
+	return w.sizes[sort.SearchFloat64s(w.cumulative, target)]
+}
+
+func (w *weighted) Min() int {
+	return w.min
+}
+
+func (w *weighted) Max() int {
+	return w.max
+}
+
+// parseTable parses comma separated size:weight pairs.
+func parseTable(table string) ([]entry, error) {
+	var entries []entry
+	for _, pair := range strings.Split(table, ",") {
+		fields := strings.Split(strings.TrimSpace(pair), ":")
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("Invalid size table entry, %s", pair)
+		}
+		e, err := parseEntry(fields[0], fields[1])
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// readHistogram reads a file with a size and a weight, such as a count of
+// messages seen, on each line. Blank lines and lines starting with # are
+// skipped.
+func readHistogram(path string) ([]entry, error) {
+	if path == "" {
+		return nil, fmt.Errorf("A path is required for %s sizes", Histogram)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []entry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("Invalid histogram line, %s", line)
+		}
+		e, err := parseEntry(fields[0], fields[1])
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	if scanner.Err() != nil {
+		return nil, scanner.Err()
+	}
+
+	return entries, nil
+}
+
+func parseEntry(size, weight string) (entry, error) {
+	parsedSize, err := strconv.Atoi(size)
+	if err != nil {
+		return entry{}, fmt.Errorf("Invalid size, %s", size)
+	}
+	parsedWeight, err := strconv.ParseFloat(weight, 64)
+	if err != nil {
+		return entry{}, fmt.Errorf("Invalid weight, %s", weight)
+	}
+
+	return entry{size: parsedSize, weight: parsedWeight}, nil
+}
+
+// random returns a number in [0, 1) derived from the seed, sequence number and
+// stream using the SplitMix64 finalizer. Distributions needing more than one
+// number per message use a different stream for each.
+func random(seed, sequence, stream uint64) float64 {
+	x := seed + sequence*0x9e3779b97f4a7c15 + stream*0xd1b54a32d192ed03
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return float64(x>>11) / (1 << 53)
+}
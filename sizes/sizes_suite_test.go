@@ -0,0 +1,13 @@
+package sizes_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestSizes(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Sizes Suite")
+}
@@ -0,0 +1,168 @@
+package sizes_test
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/sizes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Sizes", func() {
+	var (
+		config jsonstruct.JSONStruct
+	)
+
+	BeforeEach(func() {
+		config = jsonstruct.New()
+	})
+
+	newSizes := func() sizes.Sizes {
+		s, err := sizes.New(config, 1024)
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+		return s
+	}
+
+	sample := func(s sizes.Sizes, count int) []int {
+		samples := make([]int, count)
+		for i := range samples {
+			samples[i] = s.Size(uint64(i))
+		}
+		return samples
+	}
+
+	mean := func(samples []int) float64 {
+		total := 0.0
+		for _, sample := range samples {
+			total += float64(sample)
+		}
+		return total / float64(len(samples))
+	}
+
+	It("uses bytes per message by default", func() {
+		s := newSizes()
+		Expect(s.Size(0)).To(Equal(1024))
+		Expect(s.Size(99)).To(Equal(1024))
+		Expect(s.Min()).To(Equal(1024))
+		Expect(s.Max()).To(Equal(1024))
+	})
+
+	It("gives the same size for a sequence number every time", func() {
+		config.SetString(sizes.Distribution, sizes.Uniform)
+		first := sample(newSizes(), 100)
+		Expect(sample(newSizes(), 100)).To(Equal(first))
+
+		config.SetInt(sizes.Seed, 2)
+		Expect(sample(newSizes(), 100)).NotTo(Equal(first))
+	})
+
+	It("picks uniformly from a range", func() {
+		config.SetString(sizes.Distribution, sizes.Uniform)
+		config.SetInt(sizes.Min, 100)
+		config.SetInt(sizes.Max, 200)
+
+		samples := sample(newSizes(), 10000)
+		for _, size := range samples {
+			Expect(size).To(BeNumerically(">=", 100))
+			Expect(size).To(BeNumerically("<=", 200))
+		}
+		Expect(samples).To(ContainElement(100))
+		Expect(samples).To(ContainElement(200))
+		Expect(mean(samples)).To(BeNumerically("~", 150, 2))
+	})
+
+	It("picks from a normal distribution", func() {
+		config.SetString(sizes.Distribution, sizes.Normal)
+		config.SetString(sizes.Mean, "500")
+		config.SetString(sizes.StdDev, "50")
+		config.SetInt(sizes.Max, 1000)
+
+		samples := sample(newSizes(), 10000)
+		average := mean(samples)
+		Expect(average).To(BeNumerically("~", 500, 3))
+
+		variance := 0.0
+		for _, size := range samples {
+			variance += (float64(size) - average) * (float64(size) - average)
+		}
+		Expect(math.Sqrt(variance / float64(len(samples)))).To(BeNumerically("~", 50, 3))
+	})
+
+	It("picks from an exponential distribution clamped to the range", func() {
+		config.SetString(sizes.Distribution, sizes.Exponential)
+		config.SetString(sizes.Mean, "200")
+		config.SetInt(sizes.Min, 1)
+		config.SetInt(sizes.Max, 100000)
+
+		s := newSizes()
+		samples := sample(s, 10000)
+		Expect(mean(samples)).To(BeNumerically("~", 200, 10))
+		Expect(s.Min()).To(Equal(1))
+		Expect(s.Max()).To(Equal(100000))
+	})
+
+	It("picks from a weighted table", func() {
+		config.SetString(sizes.Distribution, sizes.Weighted)
+
+		s := newSizes()
+		Expect(s.Min()).To(Equal(40))
+		Expect(s.Max()).To(Equal(1500))
+
+		counts := map[int]int{}
+		for _, size := range sample(s, 12000) {
+			counts[size]++
+		}
+		Expect(counts).To(HaveLen(3))
+		Expect(counts[40]).To(BeNumerically("~", 7000, 200))
+		Expect(counts[576]).To(BeNumerically("~", 4000, 200))
+		Expect(counts[1500]).To(BeNumerically("~", 1000, 100))
+	})
+
+	It("picks from a histogram file", func() {
+		dir, err := ioutil.TempDir("", "sizes")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "histogram.txt")
+		Expect(ioutil.WriteFile(path, []byte("# size count\n100 3\n\n9000, 1\n"), 0644)).To(Succeed())
+		config.SetString(sizes.Distribution, sizes.Histogram)
+		config.SetString(sizes.Path, path)
+
+		counts := map[int]int{}
+		for _, size := range sample(newSizes(), 4000) {
+			counts[size]++
+		}
+		Expect(counts).To(HaveLen(2))
+		Expect(counts[100]).To(BeNumerically("~", 3000, 150))
+	})
+
+	It("rejects invalid configurations", func() {
+		config.SetString(sizes.Distribution, "zipf")
+		_, err := sizes.New(config, 1024)
+		Expect(err).To(MatchError("Unknown size distribution, zipf"))
+
+		config.SetString(sizes.Distribution, sizes.Uniform)
+		config.SetInt(sizes.Min, 10)
+		config.SetInt(sizes.Max, 5)
+		_, err = sizes.New(config, 1024)
+		Expect(err).To(MatchError("Sizes must be between a positive minimum and a maximum no less than it, 10 and 5"))
+
+		config.SetString(sizes.Distribution, sizes.Weighted)
+		config.SetString(sizes.Table, "64:1,big:2")
+		_, err = sizes.New(config, 1024)
+		Expect(err).To(MatchError("Invalid size, big"))
+
+		config.SetString(sizes.Table, "64:0")
+		_, err = sizes.New(config, 1024)
+		Expect(err).To(MatchError("At least one size must have a positive weight"))
+
+		config.SetString(sizes.Distribution, sizes.Histogram)
+		_, err = sizes.New(config, 1024)
+		Expect(err).To(MatchError("A path is required for histogram sizes"))
+	})
+})
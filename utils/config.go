@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/myshkin5/jsonstruct"
+)
+
+// Lookup returns the raw value at the dot path.
+func Lookup(config jsonstruct.JSONStruct, path string) (interface{}, bool) {
+	var value interface{} = map[string]interface{}(config)
+	for _, key := range strings.Split(strings.TrimPrefix(path, "."), ".") {
+		var object map[string]interface{}
+		switch typed := value.(type) {
+		case map[string]interface{}:
+			object = typed
+		case jsonstruct.JSONStruct:
+			object = typed
+		default:
+			return nil, false
+		}
+
+		var ok bool
+		value, ok = object[key]
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return value, true
+}
+
+// BoolWithDefault accepts either a JSON boolean or a string as set with
+// --config-string.
+func BoolWithDefault(config jsonstruct.JSONStruct, path string, defaultValue bool) (bool, error) {
+	value, ok := Lookup(config, path)
+	if !ok {
+		return defaultValue, nil
+	}
+
+	switch typed := value.(type) {
+	case bool:
+		return typed, nil
+	case string:
+		parsed, err := strconv.ParseBool(typed)
+		if err != nil {
+			return false, fmt.Errorf("Invalid boolean at %s, %s", path, typed)
+		}
+		return parsed, nil
+	default:
+		return false, fmt.Errorf("Invalid boolean at %s, %v", path, value)
+	}
+}
+
+// Float64WithDefault accepts either a JSON number or a string as set with
+// --config-string.
+func Float64WithDefault(config jsonstruct.JSONStruct, path string, defaultValue float64) (float64, error) {
+	value, ok := Lookup(config, path)
+	if !ok {
+		return defaultValue, nil
+	}
+
+	switch typed := value.(type) {
+	case float64:
+		return typed, nil
+	case int:
+		return float64(typed), nil
+	case string:
+		parsed, err := strconv.ParseFloat(typed, 64)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid number at %s, %s", path, typed)
+		}
+		return parsed, nil
+	default:
+		return 0, fmt.Errorf("Invalid number at %s, %v", path, value)
+	}
+}
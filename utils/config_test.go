@@ -0,0 +1,80 @@
+package utils_test
+
+import (
+	"github.com/myshkin5/jsonstruct"
+	"github.com/myshkin5/netspel/factory"
+	"github.com/myshkin5/netspel/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Config", func() {
+	It("returns the default when a boolean isn't configured", func() {
+		value, err := utils.BoolWithDefault(jsonstruct.New(), ".some.flag", true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value).To(BeTrue())
+	})
+
+	It("reads JSON booleans", func() {
+		config, err := factory.Parse([]byte(`{"additional": {"some": {"flag": true}}}`))
+		Expect(err).NotTo(HaveOccurred())
+
+		value, err := utils.BoolWithDefault(config.Additional, ".some.flag", false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value).To(BeTrue())
+	})
+
+	It("reads booleans set as strings", func() {
+		config := jsonstruct.New()
+		config.SetString(".some.flag", "true")
+
+		value, err := utils.BoolWithDefault(config, ".some.flag", false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value).To(BeTrue())
+	})
+
+	It("returns an error for values that aren't booleans", func() {
+		config := jsonstruct.New()
+		config.SetString(".some.flag", "maybe")
+
+		_, err := utils.BoolWithDefault(config, ".some.flag", false)
+		Expect(err).To(HaveOccurred())
+
+		config.SetInt(".some.flag", 1)
+
+		_, err = utils.BoolWithDefault(config, ".some.flag", false)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("reads numbers as JSON numbers, integers or strings", func() {
+		config, err := factory.Parse([]byte(`{"additional": {"some": {"number": 0.5}}}`))
+		Expect(err).NotTo(HaveOccurred())
+
+		value, err := utils.Float64WithDefault(config.Additional, ".some.number", 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value).To(Equal(0.5))
+
+		config.Additional.SetInt(".some.number", 2)
+		value, err = utils.Float64WithDefault(config.Additional, ".some.number", 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value).To(Equal(2.0))
+
+		config.Additional.SetString(".some.number", "0.25")
+		value, err = utils.Float64WithDefault(config.Additional, ".some.number", 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value).To(Equal(0.25))
+
+		value, err = utils.Float64WithDefault(config.Additional, ".some.other", 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value).To(Equal(1.0))
+	})
+
+	It("returns an error for values that aren't numbers", func() {
+		config := jsonstruct.New()
+		config.SetString(".some.number", "lots")
+
+		_, err := utils.Float64WithDefault(config, ".some.number", 1)
+		Expect(err).To(HaveOccurred())
+	})
+})